@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/TF2Stadium/Helen/helpers"
@@ -19,6 +20,38 @@ type constants struct {
 	ServerMockUp       bool
 	AllowedCorsOrigins []string
 
+	// running several instances
+	InstanceId string // unique for each instance, the hostname and pid by default
+	MessageBus string // "memory" for a single instance, "postgres" to share messages with the other instances
+
+	LobbyBroadcastDiffs bool // send lobby changes as merge patches (lobbyDataPatch) instead of the whole lobby
+
+	ReadyUpTimeout  int // seconds players have to ready up after the lobby fills
+	ReadyUpCooldown int // seconds players that didn't ready up can't join lobbies, 0 to disable
+
+	// game server logs
+	LogListenAddress string // udp address helen listens on
+	LogAddress       string // address the game servers send their logs to (logaddress_add)
+	LogsUploadUrl    string // logs.tf compatible upload endpoint
+	LogsApiKey       string
+
+	ConfigsReloadInterval int // seconds between checks for changed server configs, 0 to disable
+
+	// chat
+	ChatHistoryLength     int // messages sent to players joining a room
+	ChatRateLimitMessages int // messages a player can send every ChatRateLimitInterval seconds
+	ChatRateLimitInterval int
+
+	// whitelist.tf
+	WhitelistUrl      string // whitelists are downloaded from <url>/<id>.txt
+	WhitelistFixtures string // directory to read <id>.txt from instead, for tests
+
+	// mumble
+	MumbleMockUp   bool
+	MumbleAddress  string // host:port players connect to
+	MumbleAdminUrl string // admin api of the murmur server, see tools/mumble-admin
+	MumbleAdminKey string
+
 	// database
 	DbHost     string
 	DbPort     string
@@ -28,6 +61,12 @@ type constants struct {
 
 	SteamDevApiKey string
 	SteamApiMockUp bool
+
+	AdminSteamIds []string // made admins on startup, admins can grant roles to others
+
+	// used to encrypt the rcon passwords
+	EncryptionKey     string
+	OldEncryptionKeys []string // keys that were replaced, for reencrypting
 }
 
 func overrideFromEnv(constant *string, name string) {
@@ -37,13 +76,28 @@ func overrideFromEnv(constant *string, name string) {
 	}
 }
 
+func overrideIntFromEnv(constant *int, name string) {
+	val, err := strconv.Atoi(os.Getenv(name))
+	if err == nil {
+		*constant = val
+	}
+}
+
+func overrideBoolFromEnv(constant *bool, name string) {
+	val, err := strconv.ParseBool(os.Getenv(name))
+	if err == nil {
+		*constant = val
+	}
+}
+
 var Constants constants
 
 func SetupConstants() {
 	Constants = constants{}
 
 	setupDevelopmentConstants()
-	if val := os.Getenv("DEPLOYMENT_ENV"); strings.ToLower(val) == "production" {
+	production := strings.ToLower(os.Getenv("DEPLOYMENT_ENV")) == "production"
+	if val := os.Getenv("DEPLOYMENT_ENV"); production {
 		setupProductionConstants()
 	} else if val == "test" {
 		setupTestConstants()
@@ -58,14 +112,50 @@ func SetupConstants() {
 	overrideFromEnv(&Constants.DbPort, "DATABASE_PORT")
 	overrideFromEnv(&Constants.DbUsername, "DATABASE_USERNAME")
 	overrideFromEnv(&Constants.DbPassword, "DATABASE_PASSWORD")
+	overrideFromEnv(&Constants.LogListenAddress, "LOG_LISTEN_ADDRESS")
+	overrideFromEnv(&Constants.LogAddress, "LOG_ADDRESS")
+	overrideFromEnv(&Constants.LogsUploadUrl, "LOGS_UPLOAD_URL")
+	overrideFromEnv(&Constants.LogsApiKey, "LOGS_API_KEY")
+	overrideFromEnv(&Constants.WhitelistUrl, "WHITELIST_URL")
+	overrideFromEnv(&Constants.WhitelistFixtures, "WHITELIST_FIXTURES")
+	overrideFromEnv(&Constants.MumbleAddress, "MUMBLE_ADDRESS")
+	overrideFromEnv(&Constants.MumbleAdminUrl, "MUMBLE_ADMIN_URL")
+	overrideFromEnv(&Constants.MumbleAdminKey, "MUMBLE_ADMIN_KEY")
+	overrideFromEnv(&Constants.EncryptionKey, "ENCRYPTION_KEY")
+	overrideFromEnv(&Constants.InstanceId, "INSTANCE_ID")
+	overrideFromEnv(&Constants.MessageBus, "MESSAGE_BUS")
+	overrideBoolFromEnv(&Constants.LobbyBroadcastDiffs, "LOBBY_BROADCAST_DIFFS")
+	overrideIntFromEnv(&Constants.ReadyUpTimeout, "READY_UP_TIMEOUT")
+	overrideIntFromEnv(&Constants.ReadyUpCooldown, "READY_UP_COOLDOWN")
+	overrideIntFromEnv(&Constants.ConfigsReloadInterval, "CONFIGS_RELOAD_INTERVAL")
+	overrideIntFromEnv(&Constants.ChatHistoryLength, "CHAT_HISTORY_LENGTH")
+	overrideIntFromEnv(&Constants.ChatRateLimitMessages, "CHAT_RATE_LIMIT_MESSAGES")
+	overrideIntFromEnv(&Constants.ChatRateLimitInterval, "CHAT_RATE_LIMIT_INTERVAL")
+
+	if val := os.Getenv("OLD_ENCRYPTION_KEYS"); val != "" {
+		Constants.OldEncryptionKeys = strings.Split(val, ",")
+	}
+
+	if val := os.Getenv("ADMIN_STEAM_IDS"); val != "" {
+		Constants.AdminSteamIds = strings.Split(val, ",")
+	}
 
 	// conditional assignments
 
+	// the server passwords would be encrypted with the key from the source code
+	if production && Constants.EncryptionKey == "" {
+		helpers.Logger.Fatal("ENCRYPTION_KEY has to be set in production")
+	}
+
 	if Constants.SteamDevApiKey == "your steam dev api key" && !Constants.SteamApiMockUp {
 		helpers.Logger.Warning("Steam api key not provided, setting SteamApiMockUp to true")
 		Constants.SteamApiMockUp = true
 	}
 
+	if Constants.MumbleAdminUrl == "" && !Constants.MumbleMockUp {
+		helpers.Logger.Warning("Mumble admin url not provided, setting MumbleMockUp to true")
+		Constants.MumbleMockUp = true
+	}
 }
 
 func setupDevelopmentConstants() {
@@ -79,6 +169,31 @@ func setupDevelopmentConstants() {
 	Constants.SocketMockUp = false
 	Constants.ServerMockUp = false
 	Constants.AllowedCorsOrigins = []string{"*"}
+	hostname, _ := os.Hostname()
+	Constants.InstanceId = hostname + "-" + strconv.Itoa(os.Getpid())
+	Constants.MessageBus = "memory"
+	Constants.LobbyBroadcastDiffs = false
+	Constants.ReadyUpTimeout = 60
+	Constants.ReadyUpCooldown = 300
+
+	Constants.LogListenAddress = ":8081"
+	Constants.LogAddress = "127.0.0.1:8081"
+	Constants.LogsUploadUrl = "http://logs.tf/upload"
+	Constants.LogsApiKey = "your logs.tf api key"
+
+	Constants.ConfigsReloadInterval = 10
+
+	Constants.ChatHistoryLength = 50
+	Constants.ChatRateLimitMessages = 5
+	Constants.ChatRateLimitInterval = 10
+
+	Constants.WhitelistUrl = "http://whitelist.tf/download"
+	Constants.WhitelistFixtures = ""
+
+	Constants.MumbleMockUp = false
+	Constants.MumbleAddress = "127.0.0.1:64738"
+	Constants.MumbleAdminUrl = ""
+	Constants.MumbleAdminKey = "your mumble admin key"
 
 	Constants.DbHost = "127.0.0.1"
 	Constants.DbPort = "5724"
@@ -88,11 +203,19 @@ func setupDevelopmentConstants() {
 
 	Constants.SteamDevApiKey = "your steam dev api key"
 	Constants.SteamApiMockUp = false
+
+	Constants.AdminSteamIds = nil
+
+	Constants.EncryptionKey = "dev encryption key is very secret"
+	Constants.OldEncryptionKeys = nil
 }
 
 func setupProductionConstants() {
 	// override production stuff here
 	Constants.Port = "5555"
+
+	// has to come from ENCRYPTION_KEY
+	Constants.EncryptionKey = ""
 }
 
 func setupTestConstants() {
@@ -103,6 +226,7 @@ func setupTestConstants() {
 
 	Constants.ServerMockUp = true
 	Constants.SteamApiMockUp = true
+	Constants.MumbleMockUp = true
 }
 
 func setupTravisTestConstants() {
@@ -113,4 +237,5 @@ func setupTravisTestConstants() {
 
 	Constants.ServerMockUp = true
 	Constants.SteamApiMockUp = true
+	Constants.MumbleMockUp = true
 }
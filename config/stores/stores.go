@@ -10,6 +10,7 @@ import (
 // var CookieStore = sessions.NewCookieStore([]byte(Constants.SessionName))
 var SessionStore sessions.Store
 
+// the sessions of the sockets connected to this instance
 var SocketAuthStore = make(map[string]*sessions.Session)
 
 func SetupStores() {
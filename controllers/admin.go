@@ -0,0 +1,170 @@
+package controllers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/TF2Stadium/Helen/config"
+	chelpers "github.com/TF2Stadium/Helen/controllers/controllerhelpers"
+	"github.com/TF2Stadium/Helen/controllers/socket"
+	"github.com/TF2Stadium/Helen/decorators"
+	"github.com/TF2Stadium/Helen/helpers"
+	"github.com/TF2Stadium/Helen/helpers/authority"
+	"github.com/TF2Stadium/Helen/models"
+	"github.com/bitly/go-simplejson"
+	"github.com/gorilla/mux"
+)
+
+// the body of the map requests
+type mapRequest struct {
+	Name  string `json:"name"`
+	Modes []struct {
+		Format string `json:"format"`
+		League string `json:"league"`
+		Mode   string `json:"mode"`
+	} `json:"modes"`
+}
+
+func (m *mapRequest) gameMapModes() []models.GameMapMode {
+	var modes []models.GameMapMode
+	for _, mode := range m.Modes {
+		modes = append(modes, models.GameMapMode{Format: mode.Format, League: models.League(mode.League), Mode: mode.Mode})
+	}
+	return modes
+}
+
+func sendError(w http.ResponseWriter, status int, tperr *helpers.TPError) {
+	w.WriteHeader(status)
+	chelpers.SendJSON(w, tperr.ErrorJSON())
+}
+
+// only lets players whose role can do action through. Requests that change
+// something also have to come from helen's own pages
+func adminHandler(action authority.AuthAction, f http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" && r.Method != "HEAD" && !chelpers.IsSameOriginHTTP(r) {
+			sendError(w, http.StatusForbidden, helpers.NewTPError("Request origin isn't allowed.", -5))
+			return
+		}
+
+		if !chelpers.CanHTTP(r, action) {
+			sendError(w, http.StatusForbidden, helpers.NewTPError("Player isn't allowed to do that.", -5))
+			return
+		}
+		f(w, r)
+	}
+}
+
+// the map named in the url
+func getRequestMap(w http.ResponseWriter, r *http.Request) (*models.GameMap, bool) {
+	gameMap, err := models.GetMapByName(mux.Vars(r)["name"])
+	if err != nil {
+		sendError(w, http.StatusNotFound, helpers.NewTPError("The map isn't in the pool.", -1))
+		return nil, false
+	}
+	return gameMap, true
+}
+
+func sendMap(w http.ResponseWriter, gameMap *models.GameMap) {
+	socket.BroadcastMapList()
+	chelpers.SendJSON(w, chelpers.BuildSuccessJSON(decorators.GetMapJSON(*gameMap)))
+}
+
+// GET /admin/maps, retired maps included
+var AdminMapListHandler = adminHandler(chelpers.ActionMapPoolEdit, func(w http.ResponseWriter, r *http.Request) {
+	maps, err := models.GetMaps(true)
+	if err != nil {
+		sendError(w, http.StatusInternalServerError, helpers.NewTPError(err.Error(), -1))
+		return
+	}
+
+	chelpers.SendJSON(w, chelpers.BuildSuccessJSON(decorators.GetMapListJSON(maps)))
+})
+
+// POST /admin/maps {"name": "cp_badlands", "modes": [{"format": "6v6", "league": "etf2l", "mode": "5cp"}]}
+var AdminMapAddHandler = adminHandler(chelpers.ActionMapPoolEdit, func(w http.ResponseWriter, r *http.Request) {
+	var req mapRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, helpers.NewTPError("Malformed JSON syntax.", 0))
+		return
+	}
+
+	gameMap, tperr := models.AddMap(req.Name, req.gameMapModes())
+	if tperr != nil {
+		sendError(w, http.StatusBadRequest, tperr)
+		return
+	}
+
+	sendMap(w, gameMap)
+})
+
+// PUT /admin/maps/{name} {"modes": [...]}
+var AdminMapEditHandler = adminHandler(chelpers.ActionMapPoolEdit, func(w http.ResponseWriter, r *http.Request) {
+	gameMap, ok := getRequestMap(w, r)
+	if !ok {
+		return
+	}
+
+	var req mapRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		sendError(w, http.StatusBadRequest, helpers.NewTPError("Malformed JSON syntax.", 0))
+		return
+	}
+
+	if tperr := gameMap.SetModes(req.gameMapModes()); tperr != nil {
+		sendError(w, http.StatusBadRequest, tperr)
+		return
+	}
+
+	sendMap(w, gameMap)
+})
+
+// POST /admin/maps/{name}/retire
+var AdminMapRetireHandler = adminHandler(chelpers.ActionMapPoolEdit, func(w http.ResponseWriter, r *http.Request) {
+	setMapRetired(w, r, true)
+})
+
+// POST /admin/maps/{name}/restore
+var AdminMapRestoreHandler = adminHandler(chelpers.ActionMapPoolEdit, func(w http.ResponseWriter, r *http.Request) {
+	setMapRetired(w, r, false)
+})
+
+func setMapRetired(w http.ResponseWriter, r *http.Request, retired bool) {
+	gameMap, ok := getRequestMap(w, r)
+	if !ok {
+		return
+	}
+
+	if tperr := gameMap.SetRetired(retired); tperr != nil {
+		sendError(w, http.StatusInternalServerError, tperr)
+		return
+	}
+
+	sendMap(w, gameMap)
+}
+
+// POST /admin/maps/import, adds the maps in maps.json that aren't in the pool
+var AdminMapImportHandler = adminHandler(chelpers.ActionMapPoolEdit, func(w http.ResponseWriter, r *http.Request) {
+	added, err := models.ImportMapsJson(config.Constants.StaticFileLocation + models.ConfigsPath + models.MapsFile)
+	if err != nil {
+		sendError(w, http.StatusInternalServerError, helpers.NewTPError(err.Error(), -1))
+		return
+	}
+
+	socket.BroadcastMapList()
+
+	result := simplejson.New()
+	result.Set("added", added)
+	chelpers.SendJSON(w, chelpers.BuildSuccessJSON(result))
+})
+
+// POST /admin/configs/reload, the old configs are kept if the new ones have errors
+var AdminConfigsReloadHandler = adminHandler(chelpers.ActionConfigsReload, func(w http.ResponseWriter, r *http.Request) {
+	if err := models.ReloadServerConfigs(); err != nil {
+		sendError(w, http.StatusInternalServerError, helpers.NewTPError(err.Error(), -1))
+		return
+	}
+
+	socket.BroadcastMapList()
+	chelpers.SendJSON(w, chelpers.BuildSuccessJSON(simplejson.New()))
+})
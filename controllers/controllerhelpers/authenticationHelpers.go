@@ -55,6 +55,7 @@ func AuthenticateSocket(socketid string, r *http.Request) error {
 
 func DeauthenticateSocket(socketid string) {
 	delete(stores.SocketAuthStore, socketid)
+	forgetSocket(socketid)
 }
 
 func IsLoggedInSocket(socketid string) bool {
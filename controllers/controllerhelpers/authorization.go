@@ -0,0 +1,224 @@
+package controllerhelpers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TF2Stadium/Helen/config"
+	"github.com/TF2Stadium/Helen/helpers"
+	"github.com/TF2Stadium/Helen/helpers/authority"
+	"github.com/TF2Stadium/Helen/models"
+)
+
+// one action per socket event, and the extra ones checked by the handlers
+const (
+	ActionServerRegionList   authority.AuthAction = iota
+	ActionLobbyCreate        authority.AuthAction = iota
+	ActionLobbyClose         authority.AuthAction = iota
+	ActionLobbyJoin          authority.AuthAction = iota
+	ActionLobbyJoinSub       authority.AuthAction = iota
+	ActionLobbyRemovePlayer  authority.AuthAction = iota
+	ActionLobbySpectatorJoin authority.AuthAction = iota
+	ActionPlayerReady        authority.AuthAction = iota
+	ActionPlayerUnready      authority.AuthAction = iota
+	ActionPlayerSettingsGet  authority.AuthAction = iota
+	ActionPlayerSettingsSet  authority.AuthAction = iota
+	ActionPlayerProfile      authority.AuthAction = iota
+	ActionChatSend           authority.AuthAction = iota
+	ActionChatHistory        authority.AuthAction = iota
+	ActionPlayerBanList      authority.AuthAction = iota // the player's own bans
+	ActionPlayerBanAppeal    authority.AuthAction = iota
+
+	// moderators
+	ActionLobbyCloseAny  authority.AuthAction = iota // close lobbies created by others
+	ActionLobbyKickAny   authority.AuthAction = iota // remove players from lobbies created by others
+	ActionPlayerRoleList authority.AuthAction = iota
+	ActionBanIssue       authority.AuthAction = iota
+	ActionBanList        authority.AuthAction = iota
+	ActionBanLift        authority.AuthAction = iota
+	ActionChatDelete     authority.AuthAction = iota
+	ActionChatMute       authority.AuthAction = iota
+
+	// admins
+	ActionMapPoolEdit   authority.AuthAction = iota
+	ActionConfigsReload authority.AuthAction = iota
+	ActionServerPool    authority.AuthAction = iota
+	ActionPlayerRoleSet authority.AuthAction = iota // only to roles below their own
+)
+
+func init() {
+	models.RolePlayer.
+		Allow(ActionServerRegionList).
+		Allow(ActionLobbyCreate).
+		Allow(ActionLobbyClose).
+		Allow(ActionLobbyJoin).
+		Allow(ActionLobbyJoinSub).
+		Allow(ActionLobbyRemovePlayer).
+		Allow(ActionLobbySpectatorJoin).
+		Allow(ActionPlayerReady).
+		Allow(ActionPlayerUnready).
+		Allow(ActionPlayerSettingsGet).
+		Allow(ActionPlayerSettingsSet).
+		Allow(ActionPlayerProfile).
+		Allow(ActionChatSend).
+		Allow(ActionChatHistory).
+		Allow(ActionPlayerBanList).
+		Allow(ActionPlayerBanAppeal)
+
+	models.RoleModerator.Inherit(models.RolePlayer).
+		Allow(ActionLobbyCloseAny).
+		Allow(ActionLobbyKickAny).
+		Allow(ActionPlayerRoleList).
+		Allow(ActionBanIssue).
+		Allow(ActionBanList).
+		Allow(ActionBanLift).
+		Allow(ActionChatDelete).
+		Allow(ActionChatMute)
+
+	models.RoleAdmin.Inherit(models.RoleModerator).
+		Allow(ActionMapPoolEdit).
+		Allow(ActionConfigsReload).
+		Allow(ActionServerPool).
+		Allow(ActionPlayerRoleSet)
+
+	models.RoleDeveloper.Inherit(models.RoleAdmin)
+}
+
+// the actions fully banned players can still do
+var bannedActions = map[authority.AuthAction]bool{
+	ActionPlayerBanList:   true,
+	ActionPlayerBanAppeal: true,
+}
+
+// authorize returns why the player can't do action, or nil if they can.
+// fullBan is the error of the player's full ban, nil if they don't have one
+func authorize(player *models.Player, fullBan *helpers.TPError, action authority.AuthAction) *helpers.TPError {
+	if !player.Role.Can(action) {
+		return helpers.NewTPError("Player isn't allowed to do that.", -5)
+	}
+
+	if !bannedActions[action] {
+		return fullBan
+	}
+	return nil
+}
+
+// how long a socket keeps its player's role and full ban. Changes made
+// through another instance are seen after that
+const socketAuthTTL = time.Minute
+
+// the socket's player and full ban, loaded by the first event that needs them
+type socketAuth struct {
+	player  *models.Player
+	fullBan *helpers.TPError
+	expires time.Time // the TTL, or when the ban runs out if that's sooner
+}
+
+var socketAuths = make(map[string]*socketAuth) // socket id ->
+var socketAuthsMutex sync.Mutex
+
+func getSocketAuth(socketid string) (*socketAuth, *helpers.TPError) {
+	socketAuthsMutex.Lock()
+	auth, ok := socketAuths[socketid]
+	socketAuthsMutex.Unlock()
+
+	if ok && time.Now().Before(auth.expires) {
+		return auth, nil
+	}
+
+	player, tperr := models.GetPlayerBySteamId(GetSteamId(socketid))
+	if tperr != nil {
+		return nil, tperr
+	}
+
+	auth = &socketAuth{player: player, expires: time.Now().Add(socketAuthTTL)}
+	if ban, banned := player.GetActiveBan(models.PlayerBanFull); banned {
+		auth.fullBan = ban.TPError()
+		if ban.Until.Before(auth.expires) {
+			auth.expires = ban.Until
+		}
+	}
+
+	socketAuthsMutex.Lock()
+	socketAuths[socketid] = auth
+	socketAuthsMutex.Unlock()
+
+	return auth, nil
+}
+
+// ForgetSocketAuth makes the player's sockets load their role and full ban
+// again, after either was changed
+func ForgetSocketAuth(steamid string) {
+	socketAuthsMutex.Lock()
+	defer socketAuthsMutex.Unlock()
+
+	for socketid, auth := range socketAuths {
+		if auth.player.SteamId == steamid {
+			delete(socketAuths, socketid)
+		}
+	}
+}
+
+func forgetSocket(socketid string) {
+	socketAuthsMutex.Lock()
+	delete(socketAuths, socketid)
+	socketAuthsMutex.Unlock()
+}
+
+// AuthorizeSocket returns why the socket's player can't do action, or nil if they can.
+// The player's role and full ban are loaded once per socket, see ForgetSocketAuth
+func AuthorizeSocket(socketid string, action authority.AuthAction) *helpers.TPError {
+	if !IsLoggedInSocket(socketid) {
+		return helpers.NewTPError("Player isn't logged in.", -4)
+	}
+
+	auth, tperr := getSocketAuth(socketid)
+	if tperr != nil {
+		return tperr
+	}
+	return authorize(auth.player, auth.fullBan, action)
+}
+
+// CanHTTP returns true if the request's player is allowed to do action
+func CanHTTP(r *http.Request, action authority.AuthAction) bool {
+	if !IsLoggedInHTTP(r) {
+		return false
+	}
+
+	session, _ := GetSessionHTTP(r)
+	steamid, ok := session.Values["steam_id"].(string)
+	if !ok {
+		return false
+	}
+
+	player, tperr := models.GetPlayerBySteamId(steamid)
+	return tperr == nil && authorize(player, player.BanError(models.PlayerBanFull), action) == nil
+}
+
+// IsSameOriginHTTP returns true if the request was sent by a page on helen's domain,
+// or one of the allowed cors origins. Requests with neither an Origin nor a Referer
+// header are refused, so cookies alone can't change anything
+func IsSameOriginHTTP(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		origin = r.Header.Get("Referer")
+	}
+
+	u, err := url.Parse(origin)
+	if origin == "" || err != nil || u.Host == "" {
+		return false
+	}
+	origin = u.Scheme + "://" + u.Host
+
+	allowed := append([]string{config.Constants.Domain}, config.Constants.AllowedCorsOrigins...)
+	for _, o := range allowed {
+		// "*" lets other sites read responses, it doesn't make them trusted
+		if o != "*" && strings.TrimSuffix(o, "/") == origin {
+			return true
+		}
+	}
+	return false
+}
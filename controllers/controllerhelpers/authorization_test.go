@@ -0,0 +1,84 @@
+package controllerhelpers
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/TF2Stadium/Helen/config"
+	"github.com/TF2Stadium/Helen/helpers"
+	"github.com/TF2Stadium/Helen/helpers/authority"
+	"github.com/TF2Stadium/Helen/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRolePermissions(t *testing.T) {
+	assert.True(t, models.RolePlayer.Can(ActionLobbyJoin))
+	assert.True(t, models.RolePlayer.Can(ActionChatSend))
+	assert.False(t, models.RolePlayer.Can(ActionLobbyKickAny))
+	assert.False(t, models.RolePlayer.Can(ActionMapPoolEdit))
+
+	assert.True(t, models.RoleModerator.Can(ActionLobbyJoin))
+	assert.True(t, models.RoleModerator.Can(ActionLobbyKickAny))
+	assert.True(t, models.RoleModerator.Can(ActionLobbyCloseAny))
+	assert.False(t, models.RoleModerator.Can(ActionServerPool))
+	assert.False(t, models.RoleModerator.Can(ActionPlayerRoleSet))
+
+	for _, role := range []authority.AuthRole{models.RoleAdmin, models.RoleDeveloper} {
+		assert.True(t, role.Can(ActionLobbyJoin))
+		assert.True(t, role.Can(ActionLobbyKickAny))
+		assert.True(t, role.Can(ActionMapPoolEdit))
+		assert.True(t, role.Can(ActionConfigsReload))
+		assert.True(t, role.Can(ActionServerPool))
+		assert.True(t, role.Can(ActionPlayerRoleSet))
+	}
+}
+
+func TestSocketAuthCache(t *testing.T) {
+	player := &models.Player{SteamId: "76561197999073985", Role: models.RoleModerator}
+	banned := helpers.NewTPError("Player is banned", 4)
+	socketAuths["socket1"] = &socketAuth{player: player, expires: time.Now().Add(socketAuthTTL)}
+	socketAuths["socket2"] = &socketAuth{player: player, fullBan: banned, expires: time.Now().Add(socketAuthTTL)}
+
+	// no database query while it's cached
+	cached, tperr := getSocketAuth("socket1")
+	assert.Nil(t, tperr)
+	assert.Equal(t, player, cached.player)
+
+	cached, tperr = getSocketAuth("socket2")
+	assert.Nil(t, tperr)
+	assert.Equal(t, banned, authorize(cached.player, cached.fullBan, ActionLobbyJoin))
+	assert.Nil(t, authorize(cached.player, cached.fullBan, ActionPlayerBanAppeal))
+
+	forgetSocket("socket1")
+	_, ok := socketAuths["socket1"]
+	assert.False(t, ok)
+
+	// the role or the bans changed
+	ForgetSocketAuth(player.SteamId)
+	assert.Equal(t, 0, len(socketAuths))
+}
+
+func TestIsSameOriginHTTP(t *testing.T) {
+	config.SetupConstants()
+	config.Constants.Domain = "http://localhost:8080"
+	config.Constants.AllowedCorsOrigins = []string{"*", "http://tf2stadium.com/"}
+
+	request := func(header, value string) *http.Request {
+		r, _ := http.NewRequest("POST", "http://localhost:8080/admin/maps", nil)
+		if header != "" {
+			r.Header.Set(header, value)
+		}
+		return r
+	}
+
+	assert.True(t, IsSameOriginHTTP(request("Origin", "http://localhost:8080")))
+	assert.True(t, IsSameOriginHTTP(request("Origin", "http://tf2stadium.com")))
+	assert.True(t, IsSameOriginHTTP(request("Referer", "http://localhost:8080/admin")))
+
+	assert.False(t, IsSameOriginHTTP(request("Origin", "http://evil.com")))
+	assert.False(t, IsSameOriginHTTP(request("Origin", "https://localhost:8080")))
+	assert.False(t, IsSameOriginHTTP(request("Referer", "http://localhost:8080.evil.com/")))
+	assert.False(t, IsSameOriginHTTP(request("Origin", "null")))
+	assert.False(t, IsSameOriginHTTP(request("", "")))
+}
@@ -6,54 +6,43 @@ import (
 )
 
 var teamMap = map[string]int{"red": 0, "blu": 1}
-var sixesClassMap = map[string]int{
-	"scout1":  0,
-	"scout2":  1,
-	"roamer":  2,
-	"pocket":  3,
-	"demoman": 4,
-	"medic":   5,
-}
-
-var hlClassMap = map[string]int{
-	"scout":    0,
-	"soldier":  1,
-	"pyro":     2,
-	"demoman":  3,
-	"heavy":    4,
-	"engineer": 5,
-	"medic":    6,
-	"sniper":   7,
-	"spy":      8,
-}
 
+// GetPlayerSlot returns the lobby slot for the team and the format's class slot name
 func GetPlayerSlot(lobbytype models.LobbyType, teamStr string, classStr string) (int, *helpers.TPError) {
 	team, ok := teamMap[teamStr]
 	if !ok {
 		return -1, helpers.NewTPError("Invalid team", -1)
 	}
 
-	var classMap map[string]int
-	switch lobbytype {
-	case models.LobbyTypeHighlander:
-		classMap = hlClassMap
-	case models.LobbyTypeSixes:
-		classMap = sixesClassMap
+	format := models.GetFormat(lobbytype)
+	if format == nil {
+		return -1, helpers.NewTPError("Invalid lobby type", -1)
 	}
 
-	class, ok := classMap[classStr]
-
-	if !ok {
+	class := format.SlotIndex(classStr)
+	if class == -1 {
 		return -1, helpers.NewTPError("Invalid class", -1)
 	}
 
-	return team*len(classMap) + class, nil
+	return team*len(format.Slots) + class, nil
 }
 
-func FormatClassMap(format models.LobbyType) map[string]int {
-	if format == models.LobbyTypeHighlander {
-		return hlClassMap
+// GetSlotTeamClass does the opposite of GetPlayerSlot
+func GetSlotTeamClass(lobbytype models.LobbyType, slot int) (string, string, *helpers.TPError) {
+	format := models.GetFormat(lobbytype)
 
+	if format == nil || slot < 0 || slot >= format.SlotCount() {
+		return "", "", helpers.NewTPError("Invalid slot", -1)
 	}
-	return sixesClassMap
+
+	teamId, formatSlot := format.SlotTeam(slot)
+
+	var team string
+	for teamStr, id := range teamMap {
+		if id == teamId {
+			team = teamStr
+		}
+	}
+
+	return team, formatSlot.Name, nil
 }
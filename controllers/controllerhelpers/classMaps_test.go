@@ -27,3 +27,48 @@ func TestUgcHighlander(t *testing.T) {
 	res, err = GetPlayerSlot(models.LobbyTypeSixes, "ylw", "demoman")
 	assert.NotNil(t, err)
 }
+
+func TestGetSlotTeamClass(t *testing.T) {
+	team, class, err := GetSlotTeamClass(models.LobbyTypeHighlander, 13)
+	assert.Nil(t, err)
+	assert.Equal(t, "blu", team)
+	assert.Equal(t, "heavy", class)
+
+	team, class, err = GetSlotTeamClass(models.LobbyTypeSixes, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "red", team)
+	assert.Equal(t, "scout1", class)
+
+	_, _, err = GetSlotTeamClass(models.LobbyTypeSixes, 12)
+	assert.NotNil(t, err)
+}
+
+func TestFormatSlots(t *testing.T) {
+	res, err := GetPlayerSlot(models.LobbyTypeUltiduo, "blu", "medic")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, res)
+
+	res, err = GetPlayerSlot(models.LobbyTypeBball, "red", "soldier2")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, res)
+
+	res, err = GetPlayerSlot(models.LobbyTypeFours, "blu", "demoman")
+	assert.Nil(t, err)
+	assert.Equal(t, 6, res)
+
+	_, err = GetPlayerSlot(models.LobbyTypeFours, "red", "pyro")
+	assert.NotNil(t, err)
+
+	// prolander has a slot for every class, 7 of them can be picked
+	res, err = GetPlayerSlot(models.LobbyTypeProlander, "blu", "spy")
+	assert.Nil(t, err)
+	assert.Equal(t, 17, res)
+
+	team, class, err := GetSlotTeamClass(models.LobbyTypeProlander, 17)
+	assert.Nil(t, err)
+	assert.Equal(t, "blu", team)
+	assert.Equal(t, "spy", class)
+
+	_, _, err = GetSlotTeamClass(models.LobbyType(42), 0)
+	assert.NotNil(t, err)
+}
@@ -4,6 +4,7 @@ import (
 	"strings"
 
 	"github.com/TF2Stadium/Helen/helpers"
+	"github.com/TF2Stadium/Helen/helpers/authority"
 	"github.com/bitly/go-simplejson"
 )
 
@@ -87,3 +88,14 @@ func JsonVerifiedFilter(p map[string]Param, f func(*simplejson.Json) string) fun
 		return f(js)
 	})
 }
+
+// AuthorizationFilter only runs f for logged in players whose role can do action, and aren't fully banned
+func AuthorizationFilter(socketid string, action authority.AuthAction, f func(string) string) func(string) string {
+	return AuthFilter(socketid, func(data string) string {
+		if tperr := AuthorizeSocket(socketid, action); tperr != nil {
+			bytes, _ := tperr.ErrorJSON().Encode()
+			return string(bytes)
+		}
+		return f(data)
+	})
+}
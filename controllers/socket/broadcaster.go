@@ -1,13 +1,14 @@
 package socket
 
 import (
+	"encoding/json"
 	"strconv"
 	"time"
 
-	db "github.com/TF2Stadium/Helen/database"
-	"github.com/TF2Stadium/Helen/decorators"
 	"github.com/TF2Stadium/Helen/helpers"
+	"github.com/TF2Stadium/Helen/helpers/bus"
 	"github.com/TF2Stadium/Helen/models"
+	"github.com/bitly/go-simplejson"
 	"github.com/googollee/go-socket.io"
 )
 
@@ -18,69 +19,94 @@ type broadcastMessage struct {
 	Content string
 }
 
+// the bus channel messages are published to, every instance delivers them to its own sockets
+const socketBusChannel = "helen_socket_messages"
+
+// the sockets connected to this instance
 var SteamIdSocketMap = make(map[string]*socketio.Socket)
-var broadcasterTicker *time.Ticker
+var mumblePresenceTicker *time.Ticker
 var broadcastStopChannel chan bool
 var broadcastMessageChannel chan broadcastMessage
 var socketServer *socketio.Server
+var messageBus bus.Bus
 
-func InitBroadcaster(server *socketio.Server) {
-	broadcasterTicker = time.NewTicker(time.Millisecond * 500)
+func InitBroadcaster(server *socketio.Server, b bus.Bus) {
+	mumblePresenceTicker = time.NewTicker(mumblePresenceInterval)
 	broadcastStopChannel = make(chan bool)
 	broadcastMessageChannel = make(chan broadcastMessage)
 	socketServer = server
+	messageBus = b
+	models.OnLobbyStateChange(broadcastLobbyState)
 	go broadcaster()
+
+	err := messageBus.Subscribe(socketBusChannel, func(payload string) {
+		var message broadcastMessage
+		if err := json.Unmarshal([]byte(payload), &message); err != nil {
+			helpers.Logger.Warning("Failed to read message from the bus: %s", err.Error())
+			return
+		}
+		broadcastMessageChannel <- message
+	})
+	if err != nil {
+		helpers.Logger.Fatal(err.Error())
+	}
+
+	initLobbyBroadcaster()
 }
 
 func StopBroadcaster() {
-	broadcasterTicker.Stop()
+	mumblePresenceTicker.Stop()
 	broadcastStopChannel <- true
 }
 
+// publishes the message to every instance, the player's socket could be connected to any of them
+func publishMessage(message broadcastMessage) {
+	bytes, _ := json.Marshal(message)
+	if err := messageBus.Publish(socketBusChannel, string(bytes)); err != nil {
+		helpers.Logger.Warning("Failed to publish %s message: %s", message.Event, err.Error())
+	}
+}
+
 func SendMessage(steamid string, event string, content string) {
-	broadcastMessageChannel <- broadcastMessage{
+	publishMessage(broadcastMessage{
 		Room:    "",
 		SteamId: steamid,
 		Event:   event,
 		Content: content,
-	}
+	})
 }
 
 func SendMessageToRoom(room string, event string, content string) {
-	broadcastMessageChannel <- broadcastMessage{
+	publishMessage(broadcastMessage{
 		Room:    room,
 		SteamId: "",
 		Event:   event,
 		Content: content,
-	}
+	})
+}
+
+// lets the lobby's players know right away when the lobby changes state
+func broadcastLobbyState(lobby *models.Lobby, from models.LobbyState, to models.LobbyState) {
+	state := simplejson.New()
+	state.Set("id", lobby.ID)
+	state.Set("state", int(to))
+	state.Set("stateString", to.String())
+	bytes, _ := state.Encode()
+
+	SendMessageToRoom(strconv.FormatUint(uint64(lobby.ID), 10), "lobbyState", string(bytes))
 }
 
 func broadcaster() {
 	for {
 		select {
-		case <-broadcasterTicker.C:
-			var lobbies []models.Lobby
-			db.DB.Where("state = ?", models.LobbyStateWaiting).Order("id desc").Find(&lobbies)
-			list, err := decorators.GetLobbyListData(lobbies)
-			if err != nil {
-				helpers.Logger.Warning("Failed to send lobby list: %s", err.Error())
-			} else {
-				socketServer.BroadcastTo("-1", "lobbyListData", list)
-			}
-
-			var activeStates = []models.LobbyState{models.LobbyStateWaiting, models.LobbyStateInProgress}
-			db.DB.Where("state IN (?)", activeStates).
-				Find(&lobbies)
-			for _, lobby := range lobbies {
-				bytes, _ := decorators.GetLobbyDataJSON(lobby).Encode()
-				socketServer.BroadcastTo(strconv.FormatUint(uint64(lobby.ID), 10), "lobbyData", string(bytes))
-			}
+		case <-mumblePresenceTicker.C:
+			go markMumbleLobbiesChanged()
 
 		case message := <-broadcastMessageChannel:
 			if message.Room == "" {
 				socket, ok := SteamIdSocketMap[message.SteamId]
 				if !ok {
-					helpers.Logger.Warning("Failed to get user's socket: %d", message.SteamId)
+					// connected to another instance, or not at all
 					continue
 				}
 				(*socket).Emit(message.Event, message.Content)
@@ -0,0 +1,67 @@
+package socket
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/TF2Stadium/Helen/config"
+	"github.com/TF2Stadium/Helen/decorators"
+	"github.com/TF2Stadium/Helen/helpers"
+	"github.com/TF2Stadium/Helen/helpers/ratelimit"
+	"github.com/TF2Stadium/Helen/models"
+	"github.com/googollee/go-socket.io"
+)
+
+var chatLimiter *ratelimit.Limiter
+var chatLimiterOnce sync.Once
+
+// flood protection, see config.Constants.ChatRateLimitMessages
+func allowChatMessage(player *models.Player) bool {
+	chatLimiterOnce.Do(func() {
+		chatLimiter = ratelimit.NewLimiter(config.Constants.ChatRateLimitMessages,
+			time.Duration(config.Constants.ChatRateLimitInterval)*time.Second)
+	})
+
+	return chatLimiter.Allow(player.SteamId)
+}
+
+// getChatRoom returns the room the player can chat in, room is a lobby id
+// or anything below 1 for the lobby list room
+func getChatRoom(player *models.Player, room int) (int, *helpers.TPError) {
+	if room <= 0 {
+		return -1, nil
+	}
+
+	//Check if player has either joined, or is spectating lobby
+	lobbyId, tperr := player.GetLobbyId()
+	if tperr != nil && !player.IsSpectatingId(uint(room)) {
+		return 0, tperr
+	} else if lobbyId != uint(room) && !player.IsSpectatingId(uint(room)) {
+		return 0, helpers.NewTPError("Player is not in the lobby.", 5)
+	}
+
+	return room, nil
+}
+
+func getChatHistory(room int) (string, error) {
+	messages, err := models.GetRoomMessages(room, config.Constants.ChatHistoryLength)
+	if err != nil {
+		return "", err
+	}
+
+	bytes, err := decorators.GetChatHistoryJSON(room, messages).Encode()
+	return string(bytes), err
+}
+
+// joins the room and sends the last messages sent to it
+func joinChatRoom(so socketio.Socket, room int) {
+	so.Join(strconv.Itoa(room))
+
+	history, err := getChatHistory(room)
+	if err != nil {
+		helpers.Logger.Warning("Failed to send chat history: %s", err.Error())
+		return
+	}
+	so.Emit("chatHistory", history)
+}
@@ -0,0 +1,248 @@
+package socket
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/TF2Stadium/Helen/config"
+	db "github.com/TF2Stadium/Helen/database"
+	"github.com/TF2Stadium/Helen/decorators"
+	"github.com/TF2Stadium/Helen/helpers"
+	"github.com/TF2Stadium/Helen/helpers/mergepatch"
+	"github.com/TF2Stadium/Helen/models"
+	"github.com/googollee/go-socket.io"
+)
+
+// changes are collected for this long after the first one before the lobbies are sent,
+// a player joining changes the lobby several times
+const lobbyBroadcastDelay = 100 * time.Millisecond
+
+// mumble presence changes outside of helen, so lobbies that need it are checked this often
+const mumblePresenceInterval = 5 * time.Second
+
+// the bus channel lobby data is published to, every instance sends it to its own sockets
+const lobbyBusChannel = "helen_lobby_data"
+
+// the data of a lobby, or of the lobby list if Id is 0
+type lobbyDataMessage struct {
+	Id   uint
+	Data json.RawMessage
+}
+
+var changedLobbies = make(map[uint]bool)
+var changedLobbiesTimer *time.Timer
+var changedLobbiesMutex sync.Mutex
+
+// the last data sent to this instance's sockets, patches are made against it
+var lobbyDataCache = make(map[uint][]byte)
+var lobbyDataCacheMutex sync.Mutex
+
+func initLobbyBroadcaster() {
+	models.OnLobbyChange(markLobbyChanged)
+
+	err := messageBus.Subscribe(lobbyBusChannel, func(payload string) {
+		var message lobbyDataMessage
+		if err := json.Unmarshal([]byte(payload), &message); err != nil {
+			helpers.Logger.Warning("Failed to read lobby data from the bus: %s", err.Error())
+			return
+		}
+		deliverLobbyData(message.Id, message.Data)
+	})
+	if err != nil {
+		helpers.Logger.Fatal(err.Error())
+	}
+}
+
+// the lobby is sent with the other lobbies changed in the next lobbyBroadcastDelay
+func markLobbyChanged(lobbyId uint) {
+	changedLobbiesMutex.Lock()
+	defer changedLobbiesMutex.Unlock()
+
+	changedLobbies[lobbyId] = true
+	if changedLobbiesTimer == nil {
+		changedLobbiesTimer = time.AfterFunc(lobbyBroadcastDelay, flushChangedLobbies)
+	}
+}
+
+// the players' mumble presence is part of the lobby data while they're getting ready
+func markMumbleLobbiesChanged() {
+	var ids []uint
+	var states = []models.LobbyState{models.LobbyStateWaiting, models.LobbyStateReadyingUp}
+	db.DB.Model(&models.Lobby{}).Where("mumble_required = ? AND state IN (?)", true, states).Pluck("id", &ids)
+
+	// only the lobbies where someone joined or left the channel are sent again
+	for _, id := range ids {
+		lobby, tperr := models.GetLobbyById(id)
+		if tperr != nil {
+			continue
+		}
+
+		changed, err := lobby.RefreshMumblePresence()
+		if err != nil {
+			helpers.Logger.Warning("Failed to get the mumble presence of lobby %d: %s", id, err.Error())
+			continue
+		}
+		if changed {
+			markLobbyChanged(id)
+		}
+	}
+}
+
+func flushChangedLobbies() {
+	changedLobbiesMutex.Lock()
+	ids := changedLobbies
+	changedLobbies = make(map[uint]bool)
+	changedLobbiesTimer = nil
+	changedLobbiesMutex.Unlock()
+
+	for id := range ids {
+		data, err := getLobbyData(id)
+		if err != nil {
+			// deleted
+			continue
+		}
+		publishLobbyData(id, data)
+	}
+
+	list, err := getLobbyList()
+	if err != nil {
+		helpers.Logger.Warning("Failed to send lobby list: %s", err.Error())
+		return
+	}
+	publishLobbyData(0, list)
+}
+
+func publishLobbyData(id uint, data []byte) {
+	bytes, _ := json.Marshal(lobbyDataMessage{
+		Id:   id,
+		Data: data,
+	})
+	if err := messageBus.Publish(lobbyBusChannel, string(bytes)); err != nil {
+		helpers.Logger.Warning("Failed to publish lobby %d: %s", id, err.Error())
+	}
+}
+
+func getLobbyData(id uint) ([]byte, error) {
+	lobby, tperr := models.GetLobbyById(id)
+	if tperr != nil {
+		return nil, tperr
+	}
+
+	return decorators.GetLobbyDataJSON(*lobby).Encode()
+}
+
+func getLobbyList() ([]byte, error) {
+	var lobbies []models.Lobby
+	var openStates = []models.LobbyState{models.LobbyStateWaiting, models.LobbyStateReadyingUp}
+	err := db.DB.Where("state IN (?)", openStates).Order("id desc").Find(&lobbies).Error
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := decorators.GetLobbyListData(lobbies)
+	return []byte(list), err
+}
+
+// sends the data to this instance's sockets if it changed since it was last sent.
+// With config.Constants.LobbyBroadcastDiffs the lobby's room gets a merge patch
+// (RFC 7386) instead of the whole lobby
+func deliverLobbyData(id uint, data []byte) {
+	// the broadcaster can be busy, sockets that join meanwhile shouldn't wait on it.
+	// The bus calls this from one goroutine, so the messages stay in order
+	if message, changed := lobbyDataBroadcast(id, data); changed {
+		broadcastMessageChannel <- message
+	}
+}
+
+// updates the cache and returns what its sockets get, or false if the data didn't change
+func lobbyDataBroadcast(id uint, data []byte) (broadcastMessage, bool) {
+	lobbyDataCacheMutex.Lock()
+	defer lobbyDataCacheMutex.Unlock()
+
+	last, sent := lobbyDataCache[id]
+	if sent && bytes.Equal(last, data) {
+		return broadcastMessage{}, false
+	}
+	lobbyDataCache[id] = data
+
+	if id == 0 {
+		return broadcastMessage{Room: "-1", Event: "lobbyListData", Content: string(data)}, true
+	}
+
+	room := strconv.FormatUint(uint64(id), 10)
+
+	var lobby struct {
+		State models.LobbyState `json:"state"`
+	}
+	if json.Unmarshal(data, &lobby) == nil && lobby.State.IsFinished() {
+		// won't change anymore
+		delete(lobbyDataCache, id)
+	}
+
+	if config.Constants.LobbyBroadcastDiffs && sent {
+		patch, err := mergepatch.Diff(last, data)
+		if err == nil {
+			bytes, _ := json.Marshal(map[string]interface{}{
+				"id":    id,
+				"patch": json.RawMessage(patch),
+			})
+			return broadcastMessage{Room: room, Event: "lobbyDataPatch", Content: string(bytes)}, true
+		}
+		helpers.Logger.Warning("Failed to diff lobby %d: %s", id, err.Error())
+	}
+
+	return broadcastMessage{Room: room, Event: "lobbyData", Content: string(data)}, true
+}
+
+// sendFullLobbyData sends the socket the data the patches are made against,
+// id 0 is the lobby list. Patches the socket gets afterwards apply to it
+// even if they were made before, applying a merge patch twice changes nothing.
+// If nothing was sent yet the next change is sent whole.
+// The lock isn't held while loading or sending, if the lobby changed meanwhile
+// the socket could have missed the patch, so it gets the new data too
+func sendFullLobbyData(so socketio.Socket, id uint) {
+	data, ok := getCachedLobbyData(id)
+	if !ok {
+		var err error
+		if id == 0 {
+			data, err = getLobbyList()
+		} else {
+			data, err = getLobbyData(id)
+		}
+		if err != nil {
+			helpers.Logger.Warning("Failed to send lobby %d: %s", id, err.Error())
+			return
+		}
+	}
+
+	for {
+		if id == 0 {
+			so.Emit("lobbyListData", string(data))
+		} else {
+			so.Emit("lobbyData", string(data))
+		}
+
+		last, ok := getCachedLobbyData(id)
+		if !ok || bytes.Equal(last, data) {
+			return
+		}
+		data = last
+	}
+}
+
+func getCachedLobbyData(id uint) ([]byte, bool) {
+	lobbyDataCacheMutex.Lock()
+	defer lobbyDataCacheMutex.Unlock()
+
+	data, ok := lobbyDataCache[id]
+	return data, ok
+}
+
+// joins the lobby's chat room, which also gets the lobby's changes
+func joinLobbyRoom(so socketio.Socket, lobbyId uint) {
+	joinChatRoom(so, int(lobbyId))
+	sendFullLobbyData(so, lobbyId)
+}
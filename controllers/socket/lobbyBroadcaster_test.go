@@ -0,0 +1,30 @@
+package socket
+
+import (
+	"testing"
+
+	"github.com/TF2Stadium/Helen/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLobbyDataBroadcast(t *testing.T) {
+	config.SetupConstants()
+	config.Constants.LobbyBroadcastDiffs = true
+	defer delete(lobbyDataCache, 1)
+
+	message, changed := lobbyDataBroadcast(1, []byte(`{"id":1,"state":1,"players":1}`))
+	assert.True(t, changed)
+	assert.Equal(t, broadcastMessage{Room: "1", Event: "lobbyData", Content: `{"id":1,"state":1,"players":1}`}, message)
+
+	_, changed = lobbyDataBroadcast(1, []byte(`{"id":1,"state":1,"players":1}`))
+	assert.False(t, changed)
+
+	message, changed = lobbyDataBroadcast(1, []byte(`{"id":1,"state":1,"players":2}`))
+	assert.True(t, changed)
+	assert.Equal(t, "lobbyDataPatch", message.Event)
+
+	// the lock isn't held after, sockets joining can read the cache
+	lobbyDataCacheMutex.Lock()
+	assert.Equal(t, `{"id":1,"state":1,"players":2}`, string(lobbyDataCache[1]))
+	lobbyDataCacheMutex.Unlock()
+}
@@ -0,0 +1,37 @@
+package socket
+
+import (
+	chelpers "github.com/TF2Stadium/Helen/controllers/controllerhelpers"
+	"github.com/TF2Stadium/Helen/helpers"
+	syncRun "github.com/TF2Stadium/Helen/helpers/syncRun"
+	"github.com/TF2Stadium/Helen/models"
+)
+
+// adds the player to the lobby's slot for the team and class. The joins to a lobby
+// run one at a time in this instance, AddPlayer locks the rows for the other instances
+func joinLobby(player *models.Player, lobbyId uint, team string, class string) (*models.Lobby, *helpers.TPError) {
+	var lob *models.Lobby
+	var tperr *helpers.TPError
+
+	err := syncRun.SyncRunOnLobby(lobbyId, func(lobby *models.Lobby) {
+		lob = lobby
+
+		if lobby.State == models.LobbyStateInProgress {
+			tperr = helpers.NewTPError("Lobby is in progress, join as a substitute.", 7)
+			return
+		}
+
+		slot, slotErr := chelpers.GetPlayerSlot(lobby.Type, team, class)
+		if slotErr != nil {
+			tperr = slotErr
+			return
+		}
+
+		tperr = lobby.AddPlayer(player, slot)
+	})
+	if err != nil {
+		return nil, helpers.NewTPError("Lobby not in the database", -1)
+	}
+
+	return lob, tperr
+}
@@ -0,0 +1,96 @@
+package socket
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	db "github.com/TF2Stadium/Helen/database"
+	"github.com/TF2Stadium/Helen/database/migrations"
+	"github.com/TF2Stadium/Helen/helpers"
+	"github.com/TF2Stadium/Helen/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	helpers.InitLogger()
+}
+
+func TestLobbyJoinRace(t *testing.T) {
+	migrations.TestCleanup()
+	lobby := models.NewLobby("cp_badlands", models.LobbyTypeSixes, models.ServerRecord{}, 0)
+	lobby.Save()
+
+	var players []*models.Player
+	for i := 0; i < 12; i++ {
+		player, playErr := models.NewPlayer("p" + fmt.Sprint(i))
+		assert.Nil(t, playErr)
+		player.Save()
+		players = append(players, player)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]*helpers.TPError, len(players))
+	for i := range players {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = joinLobby(players[i], lobby.ID, "red", "scout1")
+		}(i)
+	}
+	wg.Wait()
+
+	var winner *models.Player
+	for i, err := range errs {
+		if err == nil {
+			assert.Nil(t, winner, "slot taken twice")
+			winner = players[i]
+		}
+	}
+	assert.NotNil(t, winner)
+
+	id, err := lobby.GetPlayerIdBySlot(0)
+	assert.Nil(t, err)
+	assert.Equal(t, winner.ID, id)
+	assert.Equal(t, 1, lobby.GetPlayerNumber())
+}
+
+func TestLobbyJoinRaceLobbies(t *testing.T) {
+	migrations.TestCleanup()
+	player, playErr := models.NewPlayer("p0")
+	assert.Nil(t, playErr)
+	player.Save()
+
+	var lobbies []*models.Lobby
+	for i := 0; i < 6; i++ {
+		lobby := models.NewLobby("cp_badlands", models.LobbyTypeSixes, models.ServerRecord{}, 0)
+		lobby.Save()
+		lobbies = append(lobbies, lobby)
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]*helpers.TPError, len(lobbies))
+	for i := range lobbies {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = joinLobby(player, lobbies[i].ID, "blu", "scout1")
+		}(i)
+	}
+	wg.Wait()
+
+	joined := 0
+	for _, err := range errs {
+		if err == nil {
+			joined++
+		}
+	}
+	assert.Equal(t, 1, joined)
+
+	count := 0
+	db.DB.Model(&models.LobbySlot{}).Where("player_id = ?", player.ID).Count(&count)
+	assert.Equal(t, 1, count)
+
+	_, tperr := joinLobby(player, 4242, "red", "scout1")
+	assert.NotNil(t, tperr)
+}
@@ -0,0 +1,62 @@
+package socket
+
+import (
+	chelpers "github.com/TF2Stadium/Helen/controllers/controllerhelpers"
+	"github.com/TF2Stadium/Helen/helpers"
+	"github.com/TF2Stadium/Helen/models"
+)
+
+// takes the player out of the lobby's slots or spectators. Players in a match
+// that's running keep their slot until a substitute takes it
+func leaveLobby(lob *models.Lobby, player *models.Player) *helpers.TPError {
+	slot, err := lob.GetPlayerSlot(player)
+	if err == nil && lob.State == models.LobbyStateInProgress {
+		// someone has to take their place
+		team, class, tperr := chelpers.GetSlotTeamClass(lob.Type, slot)
+		if tperr != nil {
+			return tperr
+		}
+
+		_, tperr = lob.RequestSubstitute(player, team, class)
+		if tperr != nil {
+			return tperr
+		}
+		broadcastSubList()
+	} else if err == nil {
+		lob.RemovePlayer(player)
+	} else if player.IsSpectatingId(lob.ID) {
+		lob.RemoveSpectator(player)
+	} else {
+		return helpers.NewTPError("Player neither playing nor spectating", 2)
+	}
+
+	if lob.IsReadyingUp() && !lob.IsFull() {
+		stopReadyUp(lob)
+	}
+	return nil
+}
+
+// fully banned players leave their lobby and are kicked from its game server
+func removeBannedPlayer(player *models.Player) {
+	lobbyId, tperr := player.GetLobbyId()
+	if tperr != nil {
+		// not in a lobby
+		return
+	}
+
+	lob, tperr := models.GetLobbyById(lobbyId)
+	if tperr != nil {
+		return
+	}
+
+	if tperr := leaveLobby(lob, player); tperr != nil {
+		helpers.Logger.Warning("Failed to remove banned player %s from lobby %d: %s", player.SteamId, lobbyId, tperr.Error())
+	}
+
+	// the instance that owns the server kicks them once it sees they're not in the lobby anymore
+	if lob.Server != nil {
+		if err := lob.Server.KickPlayer(player.SteamId, "[tf2stadium.com]: You're banned"); err != nil {
+			helpers.Logger.Warning("Failed to kick banned player %s from lobby %d: %s", player.SteamId, lobbyId, err.Error())
+		}
+	}
+}
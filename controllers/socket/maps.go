@@ -0,0 +1,52 @@
+package socket
+
+import (
+	"github.com/TF2Stadium/Helen/decorators"
+	"github.com/TF2Stadium/Helen/helpers"
+	"github.com/TF2Stadium/Helen/models"
+	"github.com/bitly/go-simplejson"
+)
+
+func getMapList() (string, error) {
+	maps, err := models.GetMaps(false)
+	if err != nil {
+		return "", err
+	}
+
+	return decorators.GetMapListData(maps)
+}
+
+// sends the map pool to everyone, after an admin changed it
+func BroadcastMapList() {
+	list, err := getMapList()
+	if err != nil {
+		helpers.Logger.Warning("Failed to send map list: %s", err.Error())
+		return
+	}
+
+	SendMessageToRoom("-1", "mapList", list)
+}
+
+// reads the "modes" param, [{"format": "6v6", "league": "etf2l", "mode": "koth"}, ...]
+func getMapModesParam(js *simplejson.Json) ([]models.GameMapMode, *helpers.TPError) {
+	list, err := js.Get("modes").Array()
+	if err != nil {
+		return nil, helpers.NewTPError("Missing argument: 'modes'", 0)
+	}
+
+	var modes []models.GameMapMode
+	for i := range list {
+		modeJs := js.Get("modes").GetIndex(i)
+		format, err1 := modeJs.Get("format").String()
+		league, err2 := modeJs.Get("league").String()
+		mode, err3 := modeJs.Get("mode").String()
+
+		if err1 != nil || err2 != nil || err3 != nil {
+			return nil, helpers.NewTPError("Modes need a format, league and mode", 0)
+		}
+
+		modes = append(modes, models.GameMapMode{Format: format, League: models.League(league), Mode: mode})
+	}
+
+	return modes, nil
+}
@@ -0,0 +1,129 @@
+package socket
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/TF2Stadium/Helen/config"
+	"github.com/TF2Stadium/Helen/helpers"
+	"github.com/TF2Stadium/Helen/models"
+	"github.com/bitly/go-simplejson"
+)
+
+var readyUpTimers = make(map[uint]*time.Timer)
+var readyUpTimersMutex sync.Mutex
+
+// starts the ready up window once the lobby is full
+func startReadyUp(lobby *models.Lobby) {
+	readyUpTimersMutex.Lock()
+	defer readyUpTimersMutex.Unlock()
+
+	if _, ok := readyUpTimers[lobby.ID]; ok {
+		return
+	}
+
+	timeout := time.Duration(config.Constants.ReadyUpTimeout) * time.Second
+	tperr := lobby.StartReadyUp(timeout)
+	if tperr != nil {
+		helpers.Logger.Warning("[ReadyUp]: %s", tperr.Error())
+		return
+	}
+
+	lobbyid := lobby.ID
+	scheduleReadyUpTimeout(lobbyid, timeout)
+
+	readyUp := simplejson.New()
+	readyUp.Set("id", lobbyid)
+	readyUp.Set("timeout", config.Constants.ReadyUpTimeout)
+	bytes, _ := readyUp.Encode()
+	SendMessageToRoom(strconv.FormatUint(uint64(lobbyid), 10), "lobbyReadyUp", string(bytes))
+}
+
+// readyUpTimersMutex has to be held
+func scheduleReadyUpTimeout(lobbyid uint, timeout time.Duration) {
+	readyUpTimers[lobbyid] = time.AfterFunc(timeout, func() {
+		readyUpTimeout(lobbyid)
+	})
+}
+
+// RecoverReadyUps starts the timers of the lobbies that were readying up before a restart
+// again, they only exist in memory. The lobbies whose deadline passed time out right away
+func RecoverReadyUps() {
+	deadlines, err := models.GetReadyUpDeadlines()
+	if err != nil {
+		helpers.Logger.Warning("[ReadyUp]: %s", err.Error())
+		return
+	}
+
+	readyUpTimersMutex.Lock()
+	defer readyUpTimersMutex.Unlock()
+
+	for _, deadline := range deadlines {
+		if _, ok := readyUpTimers[deadline.ID]; ok {
+			continue
+		}
+
+		// AfterFunc runs it right away if the time is negative
+		scheduleReadyUpTimeout(deadline.ID, deadline.ReadyUpDeadline.Sub(time.Now()))
+	}
+
+	helpers.Logger.Debug("[ReadyUp]: Recovered %d ready ups", len(deadlines))
+}
+
+// stops the ready up window, when everyone is ready or someone left
+func stopReadyUp(lobby *models.Lobby) {
+	readyUpTimersMutex.Lock()
+	defer readyUpTimersMutex.Unlock()
+
+	if timer, ok := readyUpTimers[lobby.ID]; ok {
+		timer.Stop()
+		delete(readyUpTimers, lobby.ID)
+	}
+
+	if lobby.IsReadyingUp() {
+		lobby.StopReadyUp()
+	}
+}
+
+// removes the players that didn't ready up, the lobby goes back to waiting for players
+func readyUpTimeout(lobbyid uint) {
+	readyUpTimersMutex.Lock()
+	delete(readyUpTimers, lobbyid)
+	readyUpTimersMutex.Unlock()
+
+	lobby, tperr := models.GetLobbyById(lobbyid)
+	if tperr != nil {
+		helpers.Logger.Warning("[ReadyUp]: %s", tperr.Error())
+		return
+	}
+
+	if !lobby.IsReadyingUp() {
+		return
+	}
+
+	if lobby.State != models.LobbyStateReadyingUp {
+		lobby.StopReadyUp()
+		return
+	}
+
+	players, tperr := lobby.RemoveUnreadyPlayers()
+	if tperr != nil {
+		helpers.Logger.Warning("[ReadyUp]: %s", tperr.Error())
+		return
+	}
+
+	cooldown := time.Duration(config.Constants.ReadyUpCooldown) * time.Second
+	for i := range players {
+		message := fmt.Sprintf("You have been removed from lobby %d for not readying up in time", lobbyid)
+		if cooldown > 0 {
+			players[i].SetJoinCooldown(cooldown)
+			message += fmt.Sprintf(", you can join lobbies again in %d seconds", config.Constants.ReadyUpCooldown)
+		}
+
+		SendMessage(players[i].SteamId, "sendNotification", message)
+	}
+
+	helpers.Logger.Debug("[ReadyUp]: Removed %d players from lobby %d", len(players), lobbyid)
+}
@@ -0,0 +1,54 @@
+package socket
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/TF2Stadium/Helen/database/migrations"
+	"github.com/TF2Stadium/Helen/helpers/bus"
+	"github.com/TF2Stadium/Helen/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecoverReadyUps(t *testing.T) {
+	migrations.TestCleanup()
+	// the removed players are notified
+	messageBus = bus.NewMemoryBus()
+	defer func() { messageBus = nil }()
+
+	var lobbies []*models.Lobby
+	for i := 0; i < 2; i++ {
+		lobby := models.NewLobby("cp_badlands", models.LobbyTypeSixes, models.ServerRecord{}, 0)
+		lobby.Save()
+		lobby.SetState(models.LobbyStateWaiting, "test", 0)
+
+		for j := 0; j < 12; j++ {
+			player, playErr := models.NewPlayer(fmt.Sprintf("p%d_%d", i, j))
+			assert.Nil(t, playErr)
+			player.Save()
+			lobby.AddPlayer(player, j)
+		}
+		lobbies = append(lobbies, lobby)
+	}
+
+	// the first one's deadline passed while helen was down
+	lobbies[0].StartReadyUp(-time.Second)
+	lobbies[1].StartReadyUp(time.Minute)
+
+	RecoverReadyUps()
+
+	readyUpTimersMutex.Lock()
+	_, ok := readyUpTimers[lobbies[1].ID]
+	readyUpTimersMutex.Unlock()
+	assert.True(t, ok)
+
+	// nobody readied up
+	time.Sleep(100 * time.Millisecond)
+	lobby, _ := models.GetLobbyById(lobbies[0].ID)
+	assert.Equal(t, models.LobbyStateWaiting, lobby.State)
+	assert.False(t, lobby.IsReadyingUp())
+	assert.Equal(t, 0, lobby.GetPlayerNumber())
+
+	stopReadyUp(lobbies[1])
+}
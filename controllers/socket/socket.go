@@ -2,10 +2,10 @@ package socket
 
 import (
 	"fmt"
-	"html"
 	"strconv"
 	"time"
 
+	"github.com/TF2Stadium/Helen/config"
 	chelpers "github.com/TF2Stadium/Helen/controllers/controllerhelpers"
 	"github.com/TF2Stadium/Helen/decorators"
 	"github.com/TF2Stadium/Helen/helpers"
@@ -35,7 +35,17 @@ func SocketInit(so socketio.Socket) {
 	}))
 
 	helpers.Logger.Debug("on connection")
-	so.Join("-1") //room for global chat
+	joinChatRoom(so, -1) //room for global chat
+
+	if list, err := getSubList(); err == nil {
+		so.Emit("subListData", list)
+	}
+
+	if list, err := getMapList(); err == nil {
+		so.Emit("mapList", list)
+	}
+
+	sendFullLobbyData(so, 0)
 
 	if chelpers.IsLoggedInSocket(so.Id()) {
 		player, err := models.GetPlayerBySteamId(chelpers.GetSteamId(so.Id()))
@@ -44,53 +54,99 @@ func SocketInit(so socketio.Socket) {
 				chelpers.GetSteamId(so.Id()))
 			return
 		}
-		lobbyid, err := player.GetLobbyId()
-		if err != nil {
-			so.Join(strconv.FormatUint(uint64(lobbyid), 10))
+
+		// fully banned players can only look, and appeal, see chelpers.AuthorizationFilter
+		if ban, banned := player.GetActiveBan(models.PlayerBanFull); banned {
+			bytes, _ := decorators.GetPlayerBanJSON(*ban).Encode()
+			so.Emit("playerBanned", string(bytes))
+		} else if lobbyid, err := player.GetLobbyId(); err == nil {
+			joinLobbyRoom(so, lobbyid)
 		}
 	}
 
 	var lobbyCreateParams = map[string]chelpers.Param{
 		"mapName":        chelpers.Param{Type: chelpers.PTypeString},
 		"type":           chelpers.Param{Type: chelpers.PTypeString},
-		"server":         chelpers.Param{Type: chelpers.PTypeString},
-		"rconpwd":        chelpers.Param{Type: chelpers.PTypeString},
+		"server":         chelpers.Param{Type: chelpers.PTypeString, Default: ""},
+		"rconpwd":        chelpers.Param{Type: chelpers.PTypeString, Default: ""},
+		"region":         chelpers.Param{Type: chelpers.PTypeString, Default: ""},
 		"whitelist":      chelpers.Param{Type: chelpers.PTypeInt},
 		"mumbleRequired": chelpers.Param{Type: chelpers.PTypeBool},
+		"league":         chelpers.Param{Type: chelpers.PTypeString, Default: "etf2l"},
+		"rulesVariant":   chelpers.Param{Type: chelpers.PTypeString, Default: ""},
 	}
 
-	so.On("lobbyCreate", chelpers.AuthFilter(so.Id(),
+	so.On("lobbyCreate", chelpers.AuthorizationFilter(so.Id(), chelpers.ActionLobbyCreate,
 		chelpers.JsonVerifiedFilter(lobbyCreateParams, func(js *simplejson.Json) string {
 
 			player, _ := models.GetPlayerBySteamId(chelpers.GetSteamId(so.Id()))
+			if tperr := player.BanError(models.PlayerBanCreate); tperr != nil {
+				bytes, _ := tperr.ErrorJSON().Encode()
+				return string(bytes)
+			}
 
 			mapName, _ := js.Get("mapName").String()
 			lobbytypestring, _ := js.Get("type").String()
 			server, _ := js.Get("server").String()
 			rconPwd, _ := js.Get("rconpwd").String()
+			region, _ := js.Get("region").String()
 			whitelist, err := js.Get("whitelist").Int()
 
-			var playermap = map[string]models.LobbyType{
-				"sixes":      models.LobbyTypeSixes,
-				"highlander": models.LobbyTypeHighlander,
-			}
-
-			lobbytype, ok := playermap[lobbytypestring]
+			format, ok := models.GetFormatByKey(lobbytypestring)
 			if !ok {
 				bytes, _ := chelpers.BuildFailureJSON("Lobby type invalid.", -1).Encode()
 				return string(bytes)
 			}
+			lobbytype := format.Type
 
-			//mumble, _ := js.Get("mumbleRequired").Bool()
-			//TODO: Configure server here
+			mumbleRequired, _ := js.Get("mumbleRequired").Bool()
 
-			//TODO what if playermap[lobbytype] is nil?
-			lob := models.NewLobby(mapName, lobbytype,
-				models.ServerRecord{Host: server, RconPassword: rconPwd}, whitelist)
+			leagueString, _ := js.Get("league").String()
+			rulesVariant, _ := js.Get("rulesVariant").String()
+			league := models.League(leagueString)
+
+			if !models.IsLeagueValid(league) {
+				bytes, _ := chelpers.BuildFailureJSON("League invalid.", -1).Encode()
+				return string(bytes)
+			}
+
+			if !models.IsRulesVariantValid(league, rulesVariant) {
+				bytes, _ := chelpers.BuildFailureJSON("This league doesn't have these rules.", -1).Encode()
+				return string(bytes)
+			}
+
+			if models.GetFormatManifest(league, lobbytype) == nil {
+				bytes, _ := chelpers.BuildFailureJSON("This league doesn't have configs for this lobby type.", -1).Encode()
+				return string(bytes)
+			}
+
+			if !models.IsMapInPool(mapName, lobbytype, league) {
+				bytes, _ := chelpers.BuildFailureJSON("The map isn't in the map pool for this lobby type and league.", -1).Encode()
+				return string(bytes)
+			}
+
+			// use a server from the pool, unless the creator brought their own
+			var serverInfo models.ServerRecord
+			if server == "" {
+				record, tperr := models.ReserveServer(region, format.PlayerCount())
+				if tperr != nil {
+					bytes, _ := tperr.ErrorJSON().Encode()
+					return string(bytes)
+				}
+				serverInfo = *record
+			} else {
+				serverInfo = models.ServerRecord{Host: server, RconPassword: models.EncryptedString(rconPwd)}
+			}
+
+			lob := models.NewLobby(mapName, lobbytype, serverInfo, whitelist)
 			lob.CreatedBy = *player
+			lob.MumbleRequired = mumbleRequired
+			lob.League = league
+			lob.RulesVariant = rulesVariant
 			err = lob.Save()
 
 			if err != nil {
+				serverInfo.Release()
 				bytes, _ := err.(*helpers.TPError).ErrorJSON().Encode()
 				return string(bytes)
 			}
@@ -112,11 +168,428 @@ func SocketInit(so socketio.Socket) {
 			return string(bytes)
 		})))
 
+	so.On("serverRegionList", chelpers.AuthorizationFilter(so.Id(), chelpers.ActionServerRegionList, func(val string) string {
+		regions, err := models.GetPoolRegions()
+		if err != nil {
+			bytes, _ := chelpers.BuildFailureJSON(err.Error(), -1).Encode()
+			return string(bytes)
+		}
+
+		result := simplejson.New()
+		result.Set("regions", regions)
+		bytes, _ := chelpers.BuildSuccessJSON(result).Encode()
+		return string(bytes)
+	}))
+
+	so.On("mapList", func(val string) string {
+		maps, err := models.GetMaps(false)
+		if err != nil {
+			bytes, _ := chelpers.BuildFailureJSON(err.Error(), -1).Encode()
+			return string(bytes)
+		}
+
+		bytes, _ := chelpers.BuildSuccessJSON(decorators.GetMapListJSON(maps)).Encode()
+		return string(bytes)
+	})
+
+	var lobbyDataGetParams = map[string]chelpers.Param{
+		"id": chelpers.Param{Type: chelpers.PTypeInt, Default: 0},
+	}
+
+	// resends a lobby's whole data, or the lobby list for id 0. For clients
+	// that lost track of the patches in lobbyDataPatch
+	so.On("lobbyDataGet", chelpers.JsonVerifiedFilter(lobbyDataGetParams, func(js *simplejson.Json) string {
+		lobbyid, _ := js.Get("id").Uint64()
+
+		sendFullLobbyData(so, uint(lobbyid))
+		bytes, _ := chelpers.BuildSuccessJSON(simplejson.New()).Encode()
+		return string(bytes)
+	}))
+
+	var adminMapParams = map[string]chelpers.Param{
+		"name": chelpers.Param{Type: chelpers.PTypeString},
+	}
+
+	so.On("adminMapAdd", chelpers.AuthorizationFilter(so.Id(), chelpers.ActionMapPoolEdit,
+		chelpers.JsonVerifiedFilter(adminMapParams, func(js *simplejson.Json) string {
+			name, _ := js.Get("name").String()
+
+			modes, tperr := getMapModesParam(js)
+			if tperr != nil {
+				bytes, _ := tperr.ErrorJSON().Encode()
+				return string(bytes)
+			}
+
+			gameMap, tperr := models.AddMap(name, modes)
+			if tperr != nil {
+				bytes, _ := tperr.ErrorJSON().Encode()
+				return string(bytes)
+			}
+
+			BroadcastMapList()
+			bytes, _ := chelpers.BuildSuccessJSON(decorators.GetMapJSON(*gameMap)).Encode()
+			return string(bytes)
+		})))
+
+	so.On("adminMapSetModes", chelpers.AuthorizationFilter(so.Id(), chelpers.ActionMapPoolEdit,
+		chelpers.JsonVerifiedFilter(adminMapParams, func(js *simplejson.Json) string {
+			name, _ := js.Get("name").String()
+
+			gameMap, err := models.GetMapByName(name)
+			if err != nil {
+				bytes, _ := chelpers.BuildFailureJSON("The map isn't in the pool.", -1).Encode()
+				return string(bytes)
+			}
+
+			modes, tperr := getMapModesParam(js)
+			if tperr == nil {
+				tperr = gameMap.SetModes(modes)
+			}
+			if tperr != nil {
+				bytes, _ := tperr.ErrorJSON().Encode()
+				return string(bytes)
+			}
+
+			BroadcastMapList()
+			bytes, _ := chelpers.BuildSuccessJSON(decorators.GetMapJSON(*gameMap)).Encode()
+			return string(bytes)
+		})))
+
+	var adminMapRetireParams = map[string]chelpers.Param{
+		"name":    chelpers.Param{Type: chelpers.PTypeString},
+		"retired": chelpers.Param{Type: chelpers.PTypeBool, Default: true},
+	}
+
+	so.On("adminMapRetire", chelpers.AuthorizationFilter(so.Id(), chelpers.ActionMapPoolEdit,
+		chelpers.JsonVerifiedFilter(adminMapRetireParams, func(js *simplejson.Json) string {
+			name, _ := js.Get("name").String()
+			retired, _ := js.Get("retired").Bool()
+
+			gameMap, err := models.GetMapByName(name)
+			if err != nil {
+				bytes, _ := chelpers.BuildFailureJSON("The map isn't in the pool.", -1).Encode()
+				return string(bytes)
+			}
+
+			if tperr := gameMap.SetRetired(retired); tperr != nil {
+				bytes, _ := tperr.ErrorJSON().Encode()
+				return string(bytes)
+			}
+
+			BroadcastMapList()
+			bytes, _ := chelpers.BuildSuccessJSON(decorators.GetMapJSON(*gameMap)).Encode()
+			return string(bytes)
+		})))
+
+	so.On("adminConfigsReload", chelpers.AuthorizationFilter(so.Id(), chelpers.ActionConfigsReload, func(val string) string {
+		if err := models.ReloadServerConfigs(); err != nil {
+			bytes, _ := chelpers.BuildFailureJSON(err.Error(), -1).Encode()
+			return string(bytes)
+		}
+
+		BroadcastMapList()
+		bytes, _ := chelpers.BuildSuccessJSON(simplejson.New()).Encode()
+		return string(bytes)
+	}))
+
+	var adminServerAddParams = map[string]chelpers.Param{
+		"host":     chelpers.Param{Type: chelpers.PTypeString},
+		"rconpwd":  chelpers.Param{Type: chelpers.PTypeString},
+		"region":   chelpers.Param{Type: chelpers.PTypeString},
+		"capacity": chelpers.Param{Type: chelpers.PTypeInt},
+	}
+
+	so.On("adminServerAdd", chelpers.AuthorizationFilter(so.Id(), chelpers.ActionServerPool,
+		chelpers.JsonVerifiedFilter(adminServerAddParams, func(js *simplejson.Json) string {
+			host, _ := js.Get("host").String()
+			rconpwd, _ := js.Get("rconpwd").String()
+			region, _ := js.Get("region").String()
+			capacity, _ := js.Get("capacity").Int()
+
+			record, tperr := models.AddPoolServer(host, rconpwd, region, capacity)
+			if tperr != nil {
+				bytes, _ := tperr.ErrorJSON().Encode()
+				return string(bytes)
+			}
+
+			bytes, _ := chelpers.BuildSuccessJSON(decorators.GetServerRecordJSON(*record)).Encode()
+			return string(bytes)
+		})))
+
+	var adminServerRemoveParams = map[string]chelpers.Param{
+		"id": chelpers.Param{Type: chelpers.PTypeInt},
+	}
+
+	so.On("adminServerRemove", chelpers.AuthorizationFilter(so.Id(), chelpers.ActionServerPool,
+		chelpers.JsonVerifiedFilter(adminServerRemoveParams, func(js *simplejson.Json) string {
+			id, _ := js.Get("id").Uint64()
+
+			if tperr := models.RemovePoolServer(uint(id)); tperr != nil {
+				bytes, _ := tperr.ErrorJSON().Encode()
+				return string(bytes)
+			}
+
+			bytes, _ := chelpers.BuildSuccessJSON(simplejson.New()).Encode()
+			return string(bytes)
+		})))
+
+	so.On("adminServerList", chelpers.AuthorizationFilter(so.Id(), chelpers.ActionServerPool, func(val string) string {
+		records, err := models.GetPoolServers()
+		if err != nil {
+			bytes, _ := chelpers.BuildFailureJSON(err.Error(), -1).Encode()
+			return string(bytes)
+		}
+
+		bytes, _ := chelpers.BuildSuccessJSON(decorators.GetServerListJSON(records)).Encode()
+		return string(bytes)
+	}))
+
+	so.On("adminPlayerRoleList", chelpers.AuthorizationFilter(so.Id(), chelpers.ActionPlayerRoleList, func(val string) string {
+		players, err := models.GetPlayersWithRole(models.RoleModerator)
+		if err != nil {
+			bytes, _ := chelpers.BuildFailureJSON(err.Error(), -1).Encode()
+			return string(bytes)
+		}
+
+		bytes, _ := chelpers.BuildSuccessJSON(decorators.GetPlayerRoleListJSON(players)).Encode()
+		return string(bytes)
+	}))
+
+	var adminPlayerRoleSetParams = map[string]chelpers.Param{
+		"steamid": chelpers.Param{Type: chelpers.PTypeString},
+		"role":    chelpers.Param{Type: chelpers.PTypeString},
+	}
+
+	// grants a role, or revokes it with "player"
+	so.On("adminPlayerRoleSet", chelpers.AuthorizationFilter(so.Id(), chelpers.ActionPlayerRoleSet,
+		chelpers.JsonVerifiedFilter(adminPlayerRoleSetParams, func(js *simplejson.Json) string {
+			steamid, _ := js.Get("steamid").String()
+			roleName, _ := js.Get("role").String()
+
+			role, ok := models.GetRoleByName(roleName)
+			if !ok {
+				bytes, _ := chelpers.BuildFailureJSON("Invalid role", -1).Encode()
+				return string(bytes)
+			}
+
+			admin, tperr := models.GetPlayerBySteamId(chelpers.GetSteamId(so.Id()))
+			if tperr != nil {
+				bytes, _ := tperr.ErrorJSON().Encode()
+				return string(bytes)
+			}
+
+			player, tperr := models.GetPlayerBySteamId(steamid)
+			if tperr != nil {
+				bytes, _ := tperr.ErrorJSON().Encode()
+				return string(bytes)
+			}
+
+			// nobody can give a role as high as their own, or change the role of someone who has one
+			if player.Role >= admin.Role || role >= admin.Role {
+				bytes, _ := chelpers.BuildFailureJSON("Players can only grant and revoke roles below their own.", -5).Encode()
+				return string(bytes)
+			}
+
+			if tperr := player.SetRole(role); tperr != nil {
+				bytes, _ := tperr.ErrorJSON().Encode()
+				return string(bytes)
+			}
+			chelpers.ForgetSocketAuth(player.SteamId)
+
+			bytes, _ := chelpers.BuildSuccessJSON(simplejson.New()).Encode()
+			return string(bytes)
+		})))
+
+	var adminBanIssueParams = map[string]chelpers.Param{
+		"steamid":  chelpers.Param{Type: chelpers.PTypeString},
+		"type":     chelpers.Param{Type: chelpers.PTypeString},
+		"duration": chelpers.Param{Type: chelpers.PTypeInt, Default: 0}, // seconds, 0 doesn't expire
+		"reason":   chelpers.Param{Type: chelpers.PTypeString, Default: ""},
+	}
+
+	so.On("adminBanIssue", chelpers.AuthorizationFilter(so.Id(), chelpers.ActionBanIssue,
+		chelpers.JsonVerifiedFilter(adminBanIssueParams, func(js *simplejson.Json) string {
+			steamid, _ := js.Get("steamid").String()
+			typeString, _ := js.Get("type").String()
+			duration, _ := js.Get("duration").Int()
+			reason, _ := js.Get("reason").String()
+
+			banType, ok := models.GetPlayerBanTypeByName(typeString)
+			if !ok {
+				bytes, _ := chelpers.BuildFailureJSON("Invalid ban type", -1).Encode()
+				return string(bytes)
+			}
+
+			if duration < 0 {
+				bytes, _ := chelpers.BuildFailureJSON("Invalid ban duration", -1).Encode()
+				return string(bytes)
+			}
+
+			moderator, tperr := models.GetPlayerBySteamId(chelpers.GetSteamId(so.Id()))
+			if tperr != nil {
+				bytes, _ := tperr.ErrorJSON().Encode()
+				return string(bytes)
+			}
+
+			player, tperr := models.GetPlayerBySteamId(steamid)
+			if tperr != nil {
+				bytes, _ := tperr.ErrorJSON().Encode()
+				return string(bytes)
+			}
+
+			if player.Role >= moderator.Role {
+				bytes, _ := chelpers.BuildFailureJSON("Players can only ban players with a role below their own.", -5).Encode()
+				return string(bytes)
+			}
+
+			until := models.PermanentBanUntil
+			if duration != 0 {
+				until = time.Now().Add(time.Duration(duration) * time.Second)
+			}
+
+			ban, tperr := player.Ban(banType, until, reason, moderator)
+			if tperr != nil {
+				bytes, _ := tperr.ErrorJSON().Encode()
+				return string(bytes)
+			}
+			ban.Player = *player
+			ban.BannedBy = *moderator
+			chelpers.ForgetSocketAuth(player.SteamId)
+
+			bytes, _ := decorators.GetPlayerBanJSON(*ban).Encode()
+			SendMessage(player.SteamId, "playerBanned", string(bytes))
+
+			if banType == models.PlayerBanFull {
+				removeBannedPlayer(player)
+			}
+
+			bytes, _ = chelpers.BuildSuccessJSON(decorators.GetPlayerBanJSON(*ban)).Encode()
+			return string(bytes)
+		})))
+
+	var adminBanListParams = map[string]chelpers.Param{
+		"steamid": chelpers.Param{Type: chelpers.PTypeString, Default: ""},
+	}
+
+	// the player's whole history if steamid is set, every ban that hasn't lapsed if it isn't
+	so.On("adminBanList", chelpers.AuthorizationFilter(so.Id(), chelpers.ActionBanList,
+		chelpers.JsonVerifiedFilter(adminBanListParams, func(js *simplejson.Json) string {
+			steamid, _ := js.Get("steamid").String()
+
+			var bans []models.PlayerBan
+			var err error
+			if steamid == "" {
+				bans, err = models.GetActiveBans()
+			} else {
+				player, tperr := models.GetPlayerBySteamId(steamid)
+				if tperr != nil {
+					bytes, _ := tperr.ErrorJSON().Encode()
+					return string(bytes)
+				}
+
+				bans, err = player.GetBans()
+				for i := range bans {
+					bans[i].Player = *player
+				}
+			}
+
+			if err != nil {
+				bytes, _ := chelpers.BuildFailureJSON(err.Error(), -1).Encode()
+				return string(bytes)
+			}
+
+			bytes, _ := chelpers.BuildSuccessJSON(decorators.GetPlayerBanListJSON(bans)).Encode()
+			return string(bytes)
+		})))
+
+	var adminBanLiftParams = map[string]chelpers.Param{
+		"id": chelpers.Param{Type: chelpers.PTypeInt},
+	}
+
+	so.On("adminBanLift", chelpers.AuthorizationFilter(so.Id(), chelpers.ActionBanLift,
+		chelpers.JsonVerifiedFilter(adminBanLiftParams, func(js *simplejson.Json) string {
+			id, _ := js.Get("id").Uint64()
+
+			moderator, tperr := models.GetPlayerBySteamId(chelpers.GetSteamId(so.Id()))
+			if tperr != nil {
+				bytes, _ := tperr.ErrorJSON().Encode()
+				return string(bytes)
+			}
+
+			ban, tperr := models.GetPlayerBanById(uint(id))
+			if tperr != nil {
+				bytes, _ := tperr.ErrorJSON().Encode()
+				return string(bytes)
+			}
+
+			if ban.Player.Role >= moderator.Role {
+				bytes, _ := chelpers.BuildFailureJSON("Players can only lift bans of players with a role below their own.", -5).Encode()
+				return string(bytes)
+			}
+
+			if tperr := ban.Lift(moderator); tperr != nil {
+				bytes, _ := tperr.ErrorJSON().Encode()
+				return string(bytes)
+			}
+			chelpers.ForgetSocketAuth(ban.Player.SteamId)
+
+			bytes, _ := chelpers.BuildSuccessJSON(decorators.GetPlayerBanJSON(*ban)).Encode()
+			return string(bytes)
+		})))
+
+	so.On("playerBanList", chelpers.AuthorizationFilter(so.Id(), chelpers.ActionPlayerBanList, func(val string) string {
+		player, tperr := models.GetPlayerBySteamId(chelpers.GetSteamId(so.Id()))
+		if tperr != nil {
+			bytes, _ := tperr.ErrorJSON().Encode()
+			return string(bytes)
+		}
+
+		bans, err := player.GetBans()
+		if err != nil {
+			bytes, _ := chelpers.BuildFailureJSON(err.Error(), -1).Encode()
+			return string(bytes)
+		}
+
+		bytes, _ := chelpers.BuildSuccessJSON(decorators.GetPlayerBanListJSON(bans)).Encode()
+		return string(bytes)
+	}))
+
+	var playerBanAppealParams = map[string]chelpers.Param{
+		"id":      chelpers.Param{Type: chelpers.PTypeInt},
+		"message": chelpers.Param{Type: chelpers.PTypeString},
+	}
+
+	so.On("playerBanAppeal", chelpers.AuthorizationFilter(so.Id(), chelpers.ActionPlayerBanAppeal,
+		chelpers.JsonVerifiedFilter(playerBanAppealParams, func(js *simplejson.Json) string {
+			id, _ := js.Get("id").Uint64()
+			message, _ := js.Get("message").String()
+
+			player, tperr := models.GetPlayerBySteamId(chelpers.GetSteamId(so.Id()))
+			if tperr != nil {
+				bytes, _ := tperr.ErrorJSON().Encode()
+				return string(bytes)
+			}
+
+			ban, tperr := models.GetPlayerBanById(uint(id))
+			if tperr != nil || ban.PlayerID != player.ID {
+				bytes, _ := chelpers.BuildFailureJSON("Ban not in the database", -1).Encode()
+				return string(bytes)
+			}
+
+			if tperr := ban.SetAppeal(message); tperr != nil {
+				bytes, _ := tperr.ErrorJSON().Encode()
+				return string(bytes)
+			}
+
+			bytes, _ := chelpers.BuildSuccessJSON(decorators.GetPlayerBanJSON(*ban)).Encode()
+			return string(bytes)
+		})))
+
 	var lobbyCloseParams = map[string]chelpers.Param{
 		"id": chelpers.Param{Type: chelpers.PTypeInt},
 	}
 
-	so.On("lobbyClose", chelpers.AuthFilter(so.Id(),
+	so.On("lobbyClose", chelpers.AuthorizationFilter(so.Id(), chelpers.ActionLobbyClose,
 		chelpers.JsonVerifiedFilter(lobbyCloseParams, func(js *simplejson.Json) string {
 			player, _ := models.GetPlayerBySteamId(chelpers.GetSteamId(so.Id()))
 
@@ -128,17 +601,21 @@ func SocketInit(so socketio.Socket) {
 				return string(bytes)
 			}
 
-			if player.ID != lob.CreatedByID {
+			if player.ID != lob.CreatedByID && !player.Role.Can(chelpers.ActionLobbyCloseAny) {
 				bytes, _ := chelpers.BuildFailureJSON("Player not authorized to close lobby.", 1).Encode()
 				return string(bytes)
 			}
 
-			if lob.State == models.LobbyStateEnded {
+			if lob.State.IsFinished() {
 				bytes, _ := chelpers.BuildFailureJSON("Lobby already closed.", -1).Encode()
 				return string(bytes)
 			}
 
-			lob.Close()
+			tperr = lob.Cancel(player)
+			if tperr != nil {
+				bytes, _ := tperr.ErrorJSON().Encode()
+				return string(bytes)
+			}
 
 			bytes, _ := chelpers.BuildSuccessJSON(simplejson.New()).Encode()
 			return string(bytes)
@@ -150,7 +627,7 @@ func SocketInit(so socketio.Socket) {
 		"team":  chelpers.Param{Type: chelpers.PTypeString},
 	}
 
-	so.On("lobbyJoin", chelpers.AuthFilter(so.Id(),
+	so.On("lobbyJoin", chelpers.AuthorizationFilter(so.Id(), chelpers.ActionLobbyJoin,
 		chelpers.JsonVerifiedFilter(lobbyJoinParams, func(js *simplejson.Json) string {
 			player, tperr := models.GetPlayerBySteamId(chelpers.GetSteamId(so.Id()))
 
@@ -163,6 +640,43 @@ func SocketInit(so socketio.Socket) {
 			classString, _ := js.Get("class").String()
 			teamString, _ := js.Get("team").String()
 
+			lob, tperr := joinLobby(player, uint(lobbyid), teamString, classString)
+			if tperr != nil {
+				bytes, _ := tperr.ErrorJSON().Encode()
+				return string(bytes)
+			}
+
+			if lob.IsFull() {
+				startReadyUp(lob)
+			}
+
+			joinLobbyRoom(so, uint(lobbyid))
+
+			// players join the mumble channel before readying up
+			result := simplejson.New()
+			result.Set("mumble", decorators.GetMumbleConnectJSON(lob, player))
+			bytes, _ := chelpers.BuildSuccessJSON(result).Encode()
+			return string(bytes)
+		})))
+
+	var lobbyJoinSubParams = map[string]chelpers.Param{
+		"id":    chelpers.Param{Type: chelpers.PTypeInt},
+		"class": chelpers.Param{Type: chelpers.PTypeString},
+		"team":  chelpers.Param{Type: chelpers.PTypeString},
+	}
+
+	so.On("lobbyJoinSub", chelpers.AuthorizationFilter(so.Id(), chelpers.ActionLobbyJoinSub,
+		chelpers.JsonVerifiedFilter(lobbyJoinSubParams, func(js *simplejson.Json) string {
+			player, tperr := models.GetPlayerBySteamId(chelpers.GetSteamId(so.Id()))
+			if tperr != nil {
+				bytes, _ := tperr.ErrorJSON().Encode()
+				return string(bytes)
+			}
+
+			lobbyid, _ := js.Get("id").Uint64()
+			classString, _ := js.Get("class").String()
+			teamString, _ := js.Get("team").String()
+
 			lob, tperr := models.GetLobbyById(uint(lobbyid))
 			if tperr != nil {
 				bytes, _ := tperr.ErrorJSON().Encode()
@@ -175,14 +689,20 @@ func SocketInit(so socketio.Socket) {
 				return string(bytes)
 			}
 
-			tperr = lob.AddPlayer(player, slot)
+			tperr = lob.FillSubstitute(player, slot)
 			if tperr != nil {
 				bytes, _ := tperr.ErrorJSON().Encode()
 				return string(bytes)
 			}
 
-			so.Join(strconv.FormatUint(lobbyid, 10))
-			bytes, _ := chelpers.BuildSuccessJSON(simplejson.New()).Encode()
+			joinLobbyRoom(so, uint(lobbyid))
+			broadcastSubList()
+
+			// the match is already running, only the sub needs the connect info
+			bytes, _ := decorators.GetLobbyConnectJSON(lob, player).Encode()
+			SendMessage(player.SteamId, "lobbyStart", string(bytes))
+
+			bytes, _ = chelpers.BuildSuccessJSON(simplejson.New()).Encode()
 			return string(bytes)
 		})))
 
@@ -192,14 +712,13 @@ func SocketInit(so socketio.Socket) {
 		"ban":     chelpers.Param{Type: chelpers.PTypeBool, Default: false},
 	}
 
-	so.On("lobbyRemovePlayer", chelpers.AuthFilter(so.Id(),
+	so.On("lobbyRemovePlayer", chelpers.AuthorizationFilter(so.Id(), chelpers.ActionLobbyRemovePlayer,
 		chelpers.JsonVerifiedFilter(lobbyRemovePlayerParams, func(js *simplejson.Json) string {
 			steamid, _ := js.Get("steamid").String()
 			ban, _ := js.Get("ban").Bool()
 			lobbyid, _ := js.Get("id").Int()
 			self := false
 
-			// TODO check authorization, currently can kick anyone
 			if steamid == "" || steamid == chelpers.GetSteamId(so.Id()) {
 				self = true
 				steamid = chelpers.GetSteamId(so.Id())
@@ -217,19 +736,22 @@ func SocketInit(so socketio.Socket) {
 				return string(bytes)
 			}
 
-			if !self && lob.CreatedByID != player.ID {
-				// TODO proper authorization checks
-				bytes, _ := chelpers.BuildFailureJSON("Not authorized to remove players", 1).Encode()
-				return string(bytes)
+			// lobby creators can kick from their own lobbies, moderators from any lobby
+			if !self {
+				remover, tperr := models.GetPlayerBySteamId(chelpers.GetSteamId(so.Id()))
+				if tperr != nil {
+					bytes, _ := tperr.ErrorJSON().Encode()
+					return string(bytes)
+				}
+
+				if lob.CreatedByID != remover.ID && !remover.Role.Can(chelpers.ActionLobbyKickAny) {
+					bytes, _ := chelpers.BuildFailureJSON("Not authorized to remove players", 1).Encode()
+					return string(bytes)
+				}
 			}
 
-			_, err := lob.GetPlayerSlot(player)
-			if err == nil {
-				lob.RemovePlayer(player)
-			} else if player.IsSpectatingId(lob.ID) {
-				lob.RemoveSpectator(player)
-			} else {
-				bytes, _ := chelpers.BuildFailureJSON("Player neither playing nor spectating", 2).Encode()
+			if tperr := leaveLobby(lob, player); tperr != nil {
+				bytes, _ := tperr.ErrorJSON().Encode()
 				return string(bytes)
 			}
 
@@ -237,12 +759,14 @@ func SocketInit(so socketio.Socket) {
 				lob.BanPlayer(player)
 			}
 
-			so.Leave(strconv.FormatInt(int64(lobbyid), 10))
+			if self {
+				so.Leave(strconv.FormatInt(int64(lobbyid), 10))
+			}
 			bytes, _ := chelpers.BuildSuccessJSON(simplejson.New()).Encode()
 			return string(bytes)
 		})))
 
-	so.On("playerReady", chelpers.AuthFilter(so.Id(), func(val string) string {
+	so.On("playerReady", chelpers.AuthorizationFilter(so.Id(), chelpers.ActionPlayerReady, func(val string) string {
 		steamid := chelpers.GetSteamId(so.Id())
 		player, tperr := models.GetPlayerBySteamId(steamid)
 		if tperr != nil {
@@ -262,23 +786,50 @@ func SocketInit(so socketio.Socket) {
 			return string(bytes)
 		}
 
+		if lobby.MumbleRequired && !lobby.IsPlayerInMumble(player) {
+			bytes, _ := chelpers.BuildFailureJSON("Join the lobby's mumble channel before readying up.", 11).Encode()
+			return string(bytes)
+		}
+
 		tperr = lobby.ReadyPlayer(player)
 		if tperr != nil {
 			bytes, _ := tperr.ErrorJSON().Encode()
 			return string(bytes)
 		}
 
-		if lobby.IsEveryoneReady() {
-			bytes, _ := decorators.GetLobbyConnectJSON(lobby).Encode()
-			SendMessageToRoom(strconv.FormatUint(uint64(lobby.ID), 10),
-				"lobbyStart", string(bytes))
+		if lobby.State == models.LobbyStateReadyingUp && lobby.IsEveryoneReady() {
+			tperr = lobby.Start()
+			if tperr != nil {
+				// a player that readied up at the same time started it, or someone unreadied
+				if tperr.Code == models.LobbyStateErrorChanged {
+					bytes, _ := chelpers.BuildSuccessJSON(simplejson.New()).Encode()
+					return string(bytes)
+				}
+				helpers.Logger.Warning("Failed to start lobby %d: %s", lobby.ID, tperr.Error())
+
+				// everyone has to ready up again
+				stopReadyUp(lobby)
+				lobby.UnreadyAllPlayers()
+				startReadyUp(lobby)
+
+				bytes, _ := tperr.ErrorJSON().Encode()
+				return string(bytes)
+			}
+			stopReadyUp(lobby)
+
+			// everyone gets their own mumble login
+			players, _ := lobby.GetPlayers()
+			for i := range players {
+				bytes, _ := decorators.GetLobbyConnectJSON(lobby, &players[i]).Encode()
+				SendMessage(players[i].SteamId, "lobbyStart", string(bytes))
+			}
 		}
 
 		bytes, _ := chelpers.BuildSuccessJSON(simplejson.New()).Encode()
 		return string(bytes)
 	}))
 
-	so.On("playerUnready", chelpers.AuthFilter(so.Id(), func(val string) string {
+	so.On("playerUnready", chelpers.AuthorizationFilter(so.Id(), chelpers.ActionPlayerUnready, func(val string) string {
 		player, tperr := models.GetPlayerBySteamId(chelpers.GetSteamId(so.Id()))
 		if tperr != nil {
 			bytes, _ := tperr.ErrorJSON().Encode()
@@ -316,7 +867,7 @@ func SocketInit(so socketio.Socket) {
 		"id": chelpers.Param{Type: chelpers.PTypeInt},
 	}
 
-	so.On("lobbySpectatorJoin", chelpers.AuthFilter(so.Id(),
+	so.On("lobbySpectatorJoin", chelpers.AuthorizationFilter(so.Id(), chelpers.ActionLobbySpectatorJoin,
 		chelpers.JsonVerifiedFilter(lobbyJoinSpectatorParams, func(js *simplejson.Json) string {
 			lobbyid, _ := js.Get("id").Uint64()
 
@@ -336,7 +887,11 @@ func SocketInit(so socketio.Socket) {
 				bytes, _ := tperr.ErrorJSON().Encode()
 				return string(bytes)
 			}
-			lob.Save()
+
+			if lob.IsReadyingUp() && !lob.IsFull() {
+				stopReadyUp(lob)
+			}
+			joinLobbyRoom(so, uint(lobbyid))
 			return string(bytes)
 		})))
 
@@ -344,7 +899,7 @@ func SocketInit(so socketio.Socket) {
 		"key": chelpers.Param{Type: chelpers.PTypeString, Default: ""},
 	}
 
-	so.On("playerSettingsGet", chelpers.AuthFilter(so.Id(),
+	so.On("playerSettingsGet", chelpers.AuthorizationFilter(so.Id(), chelpers.ActionPlayerSettingsGet,
 		chelpers.JsonVerifiedFilter(playerSettingsGetParams, func(js *simplejson.Json) string {
 			player, _ := models.GetPlayerBySteamId(chelpers.GetSteamId(so.Id()))
 
@@ -375,7 +930,7 @@ func SocketInit(so socketio.Socket) {
 		"value": chelpers.Param{Type: chelpers.PTypeString},
 	}
 
-	so.On("playerSettingsSet", chelpers.AuthFilter(so.Id(),
+	so.On("playerSettingsSet", chelpers.AuthorizationFilter(so.Id(), chelpers.ActionPlayerSettingsSet,
 		chelpers.JsonVerifiedFilter(playerSettingsSetParams, func(js *simplejson.Json) string {
 			player, _ := models.GetPlayerBySteamId(chelpers.GetSteamId(so.Id()))
 
@@ -396,7 +951,7 @@ func SocketInit(so socketio.Socket) {
 		"steamid": chelpers.Param{Type: chelpers.PTypeString, Default: ""},
 	}
 
-	so.On("playerProfile", chelpers.AuthFilter(so.Id(),
+	so.On("playerProfile", chelpers.AuthorizationFilter(so.Id(), chelpers.ActionPlayerProfile,
 		chelpers.JsonVerifiedFilter(playerProfileParams, func(js *simplejson.Json) string {
 			steamid, _ := js.Get("steamid").String()
 
@@ -421,7 +976,7 @@ func SocketInit(so socketio.Socket) {
 		"room":    chelpers.Param{Type: chelpers.PTypeInt},
 	}
 
-	so.On("chatSend", chelpers.AuthFilter(so.Id(),
+	so.On("chatSend", chelpers.AuthorizationFilter(so.Id(), chelpers.ActionChatSend,
 		chelpers.JsonVerifiedFilter(chatSendParams, func(js *simplejson.Json) string {
 			message, _ := js.Get("message").String()
 			room, _ := js.Get("room").Int()
@@ -432,38 +987,161 @@ func SocketInit(so socketio.Socket) {
 				return string(bytes)
 			}
 
-			//Check if player has either joined, or is spectating lobby
-			lobbyId, tperr := player.GetLobbyId()
-			if room > 0 {
-				// if room is a lobby room
-				if tperr != nil {
-					bytes, _ := tperr.ErrorJSON().Encode()
-					return string(bytes)
-				} else if lobbyId != uint(room) && !player.IsSpectatingId(uint(room)) {
-					bytes, _ := chelpers.BuildFailureJSON("Player is not in the lobby.", 5).Encode()
-					return string(bytes)
-				}
-			} else {
-				// else room is the lobby list room
-				room = -1
+			if tperr := player.BanError(models.PlayerBanChat); tperr != nil {
+				bytes, _ := tperr.ErrorJSON().Encode()
+				return string(bytes)
 			}
 
-			t := time.Now()
-			chatMessage := simplejson.New()
-			// TODO send proper timestamps
-			chatMessage.Set("timestamp", strconv.Itoa(t.Hour())+strconv.Itoa(t.Minute()))
-			chatMessage.Set("message", html.EscapeString(message))
-			chatMessage.Set("room", room)
+			room, tperr = getChatRoom(player, room)
+			if tperr != nil {
+				bytes, _ := tperr.ErrorJSON().Encode()
+				return string(bytes)
+			}
 
-			user := simplejson.New()
-			user.Set("id", player.SteamId)
-			user.Set("name", player.Name)
+			if !allowChatMessage(player) {
+				bytes, _ := chelpers.BuildFailureJSON("You're sending messages too fast.", 12).Encode()
+				return string(bytes)
+			}
 
-			chatMessage.Set("user", user)
-			bytes, _ := chatMessage.Encode()
-			so.BroadcastTo(strconv.Itoa(room), "chatReceive", string(bytes))
+			chatMessage, tperr := models.NewChatMessage(message, room, player)
+			if tperr != nil {
+				bytes, _ := tperr.ErrorJSON().Encode()
+				return string(bytes)
+			}
+
+			bytes, _ := decorators.GetChatMessageJSON(*chatMessage).Encode()
+			SendMessageToRoom(strconv.Itoa(room), "chatReceive", string(bytes))
 
 			resp, _ := chelpers.BuildSuccessJSON(simplejson.New()).Encode()
 			return string(resp)
 		})))
+
+	var chatHistoryParams = map[string]chelpers.Param{
+		"room": chelpers.Param{Type: chelpers.PTypeInt},
+	}
+
+	so.On("chatHistory", chelpers.AuthorizationFilter(so.Id(), chelpers.ActionChatHistory,
+		chelpers.JsonVerifiedFilter(chatHistoryParams, func(js *simplejson.Json) string {
+			room, _ := js.Get("room").Int()
+
+			player, tperr := models.GetPlayerBySteamId(chelpers.GetSteamId(so.Id()))
+			if tperr != nil {
+				bytes, _ := tperr.ErrorJSON().Encode()
+				return string(bytes)
+			}
+
+			room, tperr = getChatRoom(player, room)
+			if tperr != nil {
+				bytes, _ := tperr.ErrorJSON().Encode()
+				return string(bytes)
+			}
+
+			messages, err := models.GetRoomMessages(room, config.Constants.ChatHistoryLength)
+			if err != nil {
+				bytes, _ := chelpers.BuildFailureJSON(err.Error(), -1).Encode()
+				return string(bytes)
+			}
+
+			bytes, _ := chelpers.BuildSuccessJSON(decorators.GetChatHistoryJSON(room, messages)).Encode()
+			return string(bytes)
+		})))
+
+	var adminChatDeleteParams = map[string]chelpers.Param{
+		"id": chelpers.Param{Type: chelpers.PTypeInt},
+	}
+
+	so.On("adminChatDelete", chelpers.AuthorizationFilter(so.Id(), chelpers.ActionChatDelete,
+		chelpers.JsonVerifiedFilter(adminChatDeleteParams, func(js *simplejson.Json) string {
+			id, _ := js.Get("id").Uint64()
+
+			chatMessage, tperr := models.GetChatMessageById(uint(id))
+			if tperr == nil {
+				tperr = chatMessage.Delete()
+			}
+			if tperr != nil {
+				bytes, _ := tperr.ErrorJSON().Encode()
+				return string(bytes)
+			}
+
+			deleted := simplejson.New()
+			deleted.Set("id", chatMessage.ID)
+			deleted.Set("room", chatMessage.Room)
+			bytes, _ := deleted.Encode()
+			SendMessageToRoom(strconv.Itoa(chatMessage.Room), "chatDelete", string(bytes))
+
+			bytes, _ = chelpers.BuildSuccessJSON(simplejson.New()).Encode()
+			return string(bytes)
+		})))
+
+	var adminChatMuteParams = map[string]chelpers.Param{
+		"steamid":  chelpers.Param{Type: chelpers.PTypeString},
+		"duration": chelpers.Param{Type: chelpers.PTypeInt, Default: 600}, // seconds
+		"reason":   chelpers.Param{Type: chelpers.PTypeString, Default: ""},
+	}
+
+	// a mute is a chat ban, unmuting lifts the player's chat bans
+	so.On("adminChatMute", chelpers.AuthorizationFilter(so.Id(), chelpers.ActionChatMute,
+		chelpers.JsonVerifiedFilter(adminChatMuteParams, func(js *simplejson.Json) string {
+			steamid, _ := js.Get("steamid").String()
+			duration, _ := js.Get("duration").Int()
+			reason, _ := js.Get("reason").String()
+
+			moderator, tperr := models.GetPlayerBySteamId(chelpers.GetSteamId(so.Id()))
+			if tperr != nil {
+				bytes, _ := tperr.ErrorJSON().Encode()
+				return string(bytes)
+			}
+
+			player, tperr := models.GetPlayerBySteamId(steamid)
+			if tperr != nil {
+				bytes, _ := tperr.ErrorJSON().Encode()
+				return string(bytes)
+			}
+
+			if player.Role >= moderator.Role {
+				bytes, _ := chelpers.BuildFailureJSON("Players can only mute players with a role below their own.", -5).Encode()
+				return string(bytes)
+			}
+
+			ban, tperr := player.Ban(models.PlayerBanChat, time.Now().Add(time.Duration(duration)*time.Second), reason, moderator)
+			if tperr != nil {
+				bytes, _ := tperr.ErrorJSON().Encode()
+				return string(bytes)
+			}
+			ban.Player = *player
+			ban.BannedBy = *moderator
+
+			bytes, _ := decorators.GetPlayerBanJSON(*ban).Encode()
+			SendMessage(player.SteamId, "playerBanned", string(bytes))
+
+			bytes, _ = chelpers.BuildSuccessJSON(decorators.GetPlayerBanJSON(*ban)).Encode()
+			return string(bytes)
+		})))
+
+	var adminChatUnmuteParams = map[string]chelpers.Param{
+		"steamid": chelpers.Param{Type: chelpers.PTypeString},
+	}
+
+	so.On("adminChatUnmute", chelpers.AuthorizationFilter(so.Id(), chelpers.ActionChatMute,
+		chelpers.JsonVerifiedFilter(adminChatUnmuteParams, func(js *simplejson.Json) string {
+			steamid, _ := js.Get("steamid").String()
+
+			moderator, tperr := models.GetPlayerBySteamId(chelpers.GetSteamId(so.Id()))
+			if tperr != nil {
+				bytes, _ := tperr.ErrorJSON().Encode()
+				return string(bytes)
+			}
+
+			player, tperr := models.GetPlayerBySteamId(steamid)
+			if tperr == nil {
+				tperr = player.LiftBans(models.PlayerBanChat, moderator)
+			}
+			if tperr != nil {
+				bytes, _ := tperr.ErrorJSON().Encode()
+				return string(bytes)
+			}
+
+			bytes, _ := chelpers.BuildSuccessJSON(simplejson.New()).Encode()
+			return string(bytes)
+		})))
 }
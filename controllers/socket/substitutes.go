@@ -0,0 +1,27 @@
+package socket
+
+import (
+	"github.com/TF2Stadium/Helen/decorators"
+	"github.com/TF2Stadium/Helen/helpers"
+	"github.com/TF2Stadium/Helen/models"
+)
+
+func getSubList() (string, error) {
+	subs, err := models.GetOpenSubstitutes()
+	if err != nil {
+		return "", err
+	}
+
+	return decorators.GetSubListData(subs)
+}
+
+// sends the open substitute slots to everyone in the lobby list
+func broadcastSubList() {
+	list, err := getSubList()
+	if err != nil {
+		helpers.Logger.Warning("Failed to send substitute list: %s", err.Error())
+		return
+	}
+
+	SendMessageToRoom("-1", "subListData", list)
+}
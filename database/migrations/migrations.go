@@ -5,6 +5,7 @@ import (
 
 	"github.com/TF2Stadium/Helen/config"
 	"github.com/TF2Stadium/Helen/database"
+	"github.com/TF2Stadium/Helen/helpers"
 	"github.com/TF2Stadium/Helen/models"
 )
 
@@ -15,9 +16,31 @@ func Do() {
 	database.DB.AutoMigrate(&models.ServerRecord{})
 	database.DB.AutoMigrate(&models.PlayerStats{})
 	database.DB.AutoMigrate(&models.PlayerSetting{})
+	database.DB.AutoMigrate(&models.LobbyPlayerStats{})
+	database.DB.AutoMigrate(&models.Substitute{})
+	database.DB.AutoMigrate(&models.LobbyStateEvent{})
+	database.DB.AutoMigrate(&models.MumbleUser{})
+	database.DB.AutoMigrate(&models.GameMap{})
+	database.DB.AutoMigrate(&models.GameMapMode{})
+	database.DB.AutoMigrate(&models.PlayerBan{})
+	database.DB.AutoMigrate(&models.ChatMessage{})
+	database.DB.AutoMigrate(&models.Lease{})
 
 	database.DB.Model(&models.LobbySlot{}).AddUniqueIndex("idx_lobby_slot_lobby_id_slot", "lobby_id", "slot")
 	database.DB.Model(&models.PlayerSetting{}).AddUniqueIndex("idx_player_id_key", "player_id", "key")
+	database.DB.Model(&models.GameMapMode{}).AddUniqueIndex("idx_game_map_mode", "game_map_id", "format", "league")
+	database.DB.Model(&models.PlayerBan{}).AddIndex("idx_player_ban_player_id", "player_id")
+	database.DB.Model(&models.ChatMessage{}).AddIndex("idx_chat_message_room", "room")
+
+	err := models.ReencryptServerRecords()
+	if err != nil {
+		helpers.Logger.Fatal(err.Error())
+	}
+
+	err = models.GrantConfigAdmins()
+	if err != nil {
+		helpers.Logger.Fatal(err.Error())
+	}
 }
 
 func TestCleanup() {
@@ -0,0 +1,49 @@
+package decorators
+
+import (
+	"github.com/TF2Stadium/Helen/models"
+	"github.com/bitly/go-simplejson"
+)
+
+func GetPlayerBanJSON(ban models.PlayerBan) *simplejson.Json {
+	j := simplejson.New()
+	j.Set("id", ban.ID)
+	j.Set("type", ban.Type.String())
+	j.Set("reason", ban.Reason)
+	j.Set("createdAt", ban.CreatedAt.Unix())
+	j.Set("active", ban.IsActive())
+	j.Set("lifted", ban.Lifted)
+	j.Set("appeal", ban.Appeal)
+
+	if ban.Until.Before(models.PermanentBanUntil) {
+		j.Set("until", ban.Until.Unix())
+	} else {
+		j.Set("until", nil)
+	}
+
+	if ban.Player.ID != 0 {
+		j.Set("steamid", ban.Player.SteamId)
+		j.Set("name", ban.Player.Name)
+	}
+
+	if ban.BannedBy.ID != 0 {
+		bannedBy := simplejson.New()
+		bannedBy.Set("steamid", ban.BannedBy.SteamId)
+		bannedBy.Set("name", ban.BannedBy.Name)
+		j.Set("bannedBy", bannedBy)
+	}
+
+	return j
+}
+
+func GetPlayerBanListJSON(bans []models.PlayerBan) *simplejson.Json {
+	list := []*simplejson.Json{}
+
+	for _, ban := range bans {
+		list = append(list, GetPlayerBanJSON(ban))
+	}
+
+	listObj := simplejson.New()
+	listObj.Set("bans", list)
+	return listObj
+}
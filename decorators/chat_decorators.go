@@ -0,0 +1,38 @@
+package decorators
+
+import (
+	"html"
+	"time"
+
+	"github.com/TF2Stadium/Helen/models"
+	"github.com/bitly/go-simplejson"
+)
+
+func GetChatMessageJSON(chatMessage models.ChatMessage) *simplejson.Json {
+	j := simplejson.New()
+	j.Set("id", chatMessage.ID)
+	j.Set("timestamp", chatMessage.CreatedAt.Unix())
+	j.Set("time", chatMessage.CreatedAt.UTC().Format(time.RFC3339))
+	j.Set("message", html.EscapeString(chatMessage.Message))
+	j.Set("room", chatMessage.Room)
+
+	user := simplejson.New()
+	user.Set("id", chatMessage.Player.SteamId)
+	user.Set("name", chatMessage.Player.Name)
+	j.Set("user", user)
+
+	return j
+}
+
+func GetChatHistoryJSON(room int, messages []models.ChatMessage) *simplejson.Json {
+	list := []*simplejson.Json{}
+
+	for _, chatMessage := range messages {
+		list = append(list, GetChatMessageJSON(chatMessage))
+	}
+
+	j := simplejson.New()
+	j.Set("room", room)
+	j.Set("messages", list)
+	return j
+}
@@ -1,15 +1,15 @@
 package decorators
 
 import (
-	"strconv"
+	"time"
 
-	chelpers "github.com/TF2Stadium/Helen/controllers/controllerhelpers"
+	"github.com/TF2Stadium/Helen/config"
 	db "github.com/TF2Stadium/Helen/database"
 	"github.com/TF2Stadium/Helen/models"
 	"github.com/bitly/go-simplejson"
 )
 
-func getSlotDetails(lobby *models.Lobby, slot int) (string, string, bool) {
+func getSlotDetails(lobby *models.Lobby, slot int) (uint, string, string, bool) {
 	steamid := ""
 	name := ""
 	ready := false
@@ -23,39 +23,71 @@ func getSlotDetails(lobby *models.Lobby, slot int) (string, string, bool) {
 		name = player.Name
 		ready, _ = lobby.IsPlayerReady(&player)
 	}
-	return steamid, name, ready
+	return playerId, steamid, name, ready
 }
 
 func GetLobbyDataJSON(lobby models.Lobby) *simplejson.Json {
 	lobbyJs := simplejson.New()
 	lobbyJs.Set("id", lobby.ID)
-	lobbyJs.Set("type", models.FormatMap[lobby.Type])
+	lobbyJs.Set("type", models.FormatName(lobby.Type))
 	lobbyJs.Set("createdAt", lobby.CreatedAt.Unix())
 	lobbyJs.Set("players", lobby.GetPlayerNumber())
 	lobbyJs.Set("map", lobby.MapName)
+	lobbyJs.Set("whitelist", int(lobby.Whitelist))
+	lobbyJs.Set("league", string(lobby.League))
+	lobbyJs.Set("rulesVariant", lobby.RulesVariant)
+	lobbyJs.Set("state", int(lobby.State))
+	lobbyJs.Set("logsId", lobby.LogsId)
+	lobbyJs.Set("logsPartial", lobby.LogsPartial)
+
+	readyUp := simplejson.New()
+	readyUp.Set("active", lobby.IsReadyingUp())
+	if lobby.IsReadyingUp() {
+		// as of when the lobby was sent, it's only sent when it changes
+		timeLeft := int(lobby.ReadyUpDeadline.Sub(time.Now()).Seconds())
+		if timeLeft < 0 {
+			timeLeft = 0
+		}
+		readyUp.Set("deadline", lobby.ReadyUpDeadline.Unix())
+		readyUp.Set("timeLeft", timeLeft)
+	}
+	lobbyJs.Set("readyUp", readyUp)
+	lobbyJs.Set("mumbleRequired", lobby.MumbleRequired)
+
+	// only needed while the players are getting ready
+	var presence map[uint]bool
+	if lobby.MumbleRequired && (lobby.State == models.LobbyStateWaiting || lobby.State == models.LobbyStateReadyingUp) {
+		// the broadcaster keeps it up to date, no requests to the mumble server here
+		presence = lobby.GetCachedMumblePresence()
+	}
+
 	classes := simplejson.New()
 
-	var classMap = chelpers.FormatClassMap(lobby.Type)
-	lobbyJs.Set("maxPlayers", len(classMap)*2)
+	format := models.GetFormat(lobby.Type)
+	lobbyJs.Set("maxPlayers", format.PlayerCount())
+	lobbyJs.Set("teamSize", format.TeamSize)
 
-	for className, slot := range classMap {
+	for slot, formatSlot := range format.Slots {
 		class := simplejson.New()
+		class.Set("class", formatSlot.Class)
 		red := simplejson.New()
 		blu := simplejson.New()
 
-		steamid, name, ready := getSlotDetails(&lobby, slot)
+		playerId, steamid, name, ready := getSlotDetails(&lobby, slot)
 		red.Set("steamid", steamid)
 		red.Set("name", name)
 		red.Set("ready", ready)
+		red.Set("inMumble", presence[playerId])
 
-		steamid, name, ready = getSlotDetails(&lobby, slot+models.TypePlayerCount[lobby.Type])
+		playerId, steamid, name, ready = getSlotDetails(&lobby, slot+len(format.Slots))
 		blu.Set("steamid", steamid)
 		blu.Set("name", name)
 		blu.Set("ready", ready)
+		blu.Set("inMumble", presence[playerId])
 
 		class.Set("red", red)
 		class.Set("blu", blu)
-		classes.Set(className, class)
+		classes.Set(formatSlot.Name, class)
 	}
 	lobbyJs.Set("classes", classes)
 
@@ -82,22 +114,61 @@ func GetLobbyListData(lobbies []models.Lobby) (string, error) {
 	return string(bytes), nil
 }
 
-func GetLobbyConnectJSON(lobby *models.Lobby) *simplejson.Json {
+func GetSubListData(subs []models.Substitute) (string, error) {
+	subList := []*simplejson.Json{}
+
+	for _, sub := range subs {
+		var lobby models.Lobby
+		err := db.DB.First(&lobby, sub.LobbyId).Error
+		if err != nil {
+			return "", err
+		}
+
+		subJs := simplejson.New()
+		subJs.Set("lobbyId", sub.LobbyId)
+		subJs.Set("team", sub.Team)
+		subJs.Set("class", sub.Class)
+		subJs.Set("type", models.FormatName(lobby.Type))
+		subJs.Set("map", lobby.MapName)
+		subList = append(subList, subJs)
+	}
+
+	listObj := simplejson.New()
+	listObj.Set("substitutes", subList)
+
+	bytes, _ := listObj.MarshalJSON()
+	return string(bytes), nil
+}
+
+// the player's login for the lobby's mumble channel
+func GetMumbleConnectJSON(lobby *models.Lobby, player *models.Player) *simplejson.Json {
+	mumble := simplejson.New()
+	mumble.Set("address", config.Constants.MumbleAddress)
+	mumble.Set("channel", models.MumbleChannelName(lobby.ID))
+	mumble.Set("required", lobby.MumbleRequired)
+
+	user, err := lobby.GetMumbleUser(player)
+	if err == nil {
+		mumble.Set("username", user.Username)
+		mumble.Set("password", string(user.Password))
+	}
+
+	return mumble
+}
+
+func GetLobbyConnectJSON(lobby *models.Lobby, player *models.Player) *simplejson.Json {
 	json := simplejson.New()
 
 	json.Set("id", lobby.ID)
 	json.Set("time", lobby.CreatedAt.Unix())
-	json.Set("password", lobby.Server.ServerPassword)
+	// from the lobby, the server is only loaded by the instance that owns it
+	json.Set("password", lobby.ServerPassword)
 
 	game := simplejson.New()
-	game.Set("host", lobby.Server.Info.Host)
+	game.Set("host", lobby.ServerInfo.Host)
 	json.Set("game", game)
 
-	mumble := simplejson.New()
-	mumble.Set("ip", "we still need to decide on mumble connections")
-	mumble.Set("port", "we still need to decide on mumble connections")
-	mumble.Set("channel", "match"+strconv.FormatUint(uint64(lobby.ID), 10))
-	json.Set("mumble", mumble)
+	json.Set("mumble", GetMumbleConnectJSON(lobby, player))
 
 	return json
 }
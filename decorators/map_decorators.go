@@ -0,0 +1,57 @@
+package decorators
+
+import (
+	"github.com/TF2Stadium/Helen/models"
+	"github.com/bitly/go-simplejson"
+)
+
+func GetMapJSON(gameMap models.GameMap) *simplejson.Json {
+	mapJs := simplejson.New()
+	mapJs.Set("name", gameMap.Name)
+	mapJs.Set("retired", gameMap.Retired)
+
+	modes := []*simplejson.Json{}
+	for _, mode := range gameMap.Modes {
+		modeJs := simplejson.New()
+		modeJs.Set("format", mode.Format)
+		modeJs.Set("league", string(mode.League))
+		modeJs.Set("mode", mode.Mode)
+		modes = append(modes, modeJs)
+	}
+	mapJs.Set("modes", modes)
+
+	// lobby type (as in lobbyCreate) -> leagues the map can be played in
+	types := simplejson.New()
+	for _, format := range models.GetFormats() {
+		leagues := []string{}
+		for _, mode := range gameMap.Modes {
+			if mode.Format == format.MapsKey() && models.GetFormatManifest(mode.League, format.Type) != nil {
+				leagues = append(leagues, string(mode.League))
+			}
+		}
+
+		if len(leagues) != 0 {
+			types.Set(format.Key, leagues)
+		}
+	}
+	mapJs.Set("types", types)
+
+	return mapJs
+}
+
+func GetMapListJSON(maps []models.GameMap) *simplejson.Json {
+	mapList := []*simplejson.Json{}
+
+	for _, gameMap := range maps {
+		mapList = append(mapList, GetMapJSON(gameMap))
+	}
+
+	listObj := simplejson.New()
+	listObj.Set("maps", mapList)
+	return listObj
+}
+
+func GetMapListData(maps []models.GameMap) (string, error) {
+	bytes, err := GetMapListJSON(maps).MarshalJSON()
+	return string(bytes), err
+}
@@ -22,6 +22,19 @@ func GetPlayerProfileJson(p *models.Player) *simplejson.Json {
 	s := simplejson.New()
 	s.Set("playedHighlanderCount", p.Stats.PlayedHighlanderCount)
 	s.Set("playedSixesCount", p.Stats.PlayedSixesCount)
+	s.Set("playedFoursCount", p.Stats.PlayedFoursCount)
+	s.Set("playedUltiduoCount", p.Stats.PlayedUltiduoCount)
+	s.Set("playedBballCount", p.Stats.PlayedBballCount)
+	s.Set("playedProlanderCount", p.Stats.PlayedProlanderCount)
+	s.Set("kills", p.Stats.Kills)
+	s.Set("deaths", p.Stats.Deaths)
+	s.Set("assists", p.Stats.Assists)
+	s.Set("damage", p.Stats.Damage)
+	s.Set("heals", p.Stats.Heals)
+	s.Set("ubers", p.Stats.Ubers)
+	s.Set("drops", p.Stats.Drops)
+	s.Set("timePlayed", p.Stats.TimePlayed)
+	s.Set("subbedOutCount", p.Stats.SubbedOutCount)
 
 	// info
 	j.Set("createdAt", p.CreatedAt)
@@ -29,8 +42,56 @@ func GetPlayerProfileJson(p *models.Player) *simplejson.Json {
 	j.Set("steamid", p.SteamId)
 	j.Set("avatar", p.Avatar)
 	j.Set("stats", s)
+	j.Set("recentMatches", getRecentMatchesJson(p))
 	j.Set("name", p.Name)
 	j.Set("id", p.ID)
+	j.Set("role", models.RoleName(p.Role))
 
 	return j
 }
+
+// players with a role above player, for the admins
+func GetPlayerRoleListJSON(players []models.Player) *simplejson.Json {
+	list := []*simplejson.Json{}
+
+	for _, p := range players {
+		j := simplejson.New()
+		j.Set("steamid", p.SteamId)
+		j.Set("name", p.Name)
+		j.Set("role", models.RoleName(p.Role))
+		list = append(list, j)
+	}
+
+	listObj := simplejson.New()
+	listObj.Set("players", list)
+	return listObj
+}
+
+func getRecentMatchesJson(p *models.Player) []*simplejson.Json {
+	matches := []*simplejson.Json{}
+
+	recent, err := models.GetPlayerRecentStats(p.ID, 10)
+	if err != nil {
+		return matches
+	}
+
+	for _, stats := range recent {
+		m := simplejson.New()
+		m.Set("lobbyId", stats.LobbyId)
+		m.Set("map", stats.Lobby.MapName)
+		m.Set("type", models.FormatName(stats.Lobby.Type))
+		m.Set("playedAt", stats.CreatedAt.Unix())
+		m.Set("class", stats.Class)
+		m.Set("kills", stats.Kills)
+		m.Set("deaths", stats.Deaths)
+		m.Set("assists", stats.Assists)
+		m.Set("damage", stats.Damage)
+		m.Set("heals", stats.Heals)
+		m.Set("ubers", stats.Ubers)
+		m.Set("drops", stats.Drops)
+		m.Set("timePlayed", stats.TimePlayed)
+		matches = append(matches, m)
+	}
+
+	return matches
+}
@@ -0,0 +1,32 @@
+package decorators
+
+import (
+	"github.com/TF2Stadium/Helen/models"
+	"github.com/bitly/go-simplejson"
+)
+
+// the rcon password is left out
+func GetServerRecordJSON(record models.ServerRecord) *simplejson.Json {
+	j := simplejson.New()
+	j.Set("id", record.ID)
+	j.Set("host", record.Host)
+	j.Set("region", record.Region)
+	j.Set("capacity", record.Capacity)
+	j.Set("healthy", record.Healthy)
+	j.Set("reserved", record.Reserved)
+	j.Set("lastChecked", record.LastChecked.Unix())
+
+	return j
+}
+
+func GetServerListJSON(records []models.ServerRecord) *simplejson.Json {
+	servers := []*simplejson.Json{}
+
+	for _, record := range records {
+		servers = append(servers, GetServerRecordJSON(record))
+	}
+
+	listObj := simplejson.New()
+	listObj.Set("servers", servers)
+	return listObj
+}
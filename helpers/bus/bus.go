@@ -0,0 +1,12 @@
+package bus
+
+// Handler is called with the payload of every message published to the channel it subscribed to
+type Handler func(payload string)
+
+// Bus delivers messages to all the Helen instances subscribed to a channel,
+// the one that published the message included
+type Bus interface {
+	Publish(channel string, payload string) error
+	Subscribe(channel string, handler Handler) error
+	Close() error
+}
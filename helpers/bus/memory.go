@@ -0,0 +1,55 @@
+package bus
+
+import (
+	"errors"
+	"sync"
+)
+
+// MemoryBus is a Bus for a single Helen instance. Handlers are called by Publish
+type MemoryBus struct {
+	mutex    sync.RWMutex
+	handlers map[string][]Handler
+	closed   bool
+}
+
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{handlers: make(map[string][]Handler)}
+}
+
+func (b *MemoryBus) Publish(channel string, payload string) error {
+	b.mutex.RLock()
+	if b.closed {
+		b.mutex.RUnlock()
+		return errors.New("The bus is closed")
+	}
+	handlers := b.handlers[channel]
+	b.mutex.RUnlock()
+
+	for _, handler := range handlers {
+		handler(payload)
+	}
+	return nil
+}
+
+func (b *MemoryBus) Subscribe(channel string, handler Handler) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if b.closed {
+		return errors.New("The bus is closed")
+	}
+
+	// copied, so Publish can use the old slice without the lock
+	handlers := make([]Handler, len(b.handlers[channel]), len(b.handlers[channel])+1)
+	copy(handlers, b.handlers[channel])
+	b.handlers[channel] = append(handlers, handler)
+	return nil
+}
+
+func (b *MemoryBus) Close() error {
+	b.mutex.Lock()
+	b.closed = true
+	b.handlers = make(map[string][]Handler)
+	b.mutex.Unlock()
+	return nil
+}
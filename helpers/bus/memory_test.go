@@ -0,0 +1,28 @@
+package bus
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryBus(t *testing.T) {
+	b := NewMemoryBus()
+
+	var first, second []string
+	assert.Nil(t, b.Subscribe("a", func(payload string) { first = append(first, payload) }))
+	assert.Nil(t, b.Subscribe("a", func(payload string) { second = append(second, payload) }))
+	assert.Nil(t, b.Subscribe("b", func(payload string) { first = append(first, "b"+payload) }))
+
+	assert.Nil(t, b.Publish("a", "1"))
+	assert.Nil(t, b.Publish("b", "2"))
+	assert.Nil(t, b.Publish("c", "3"))
+
+	assert.Equal(t, []string{"1", "b2"}, first)
+	assert.Equal(t, []string{"1"}, second)
+
+	b.Close()
+	assert.NotNil(t, b.Publish("a", "4"))
+	assert.NotNil(t, b.Subscribe("a", func(string) {}))
+	assert.Equal(t, 1, len(second))
+}
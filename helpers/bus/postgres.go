@@ -0,0 +1,147 @@
+package bus
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/TF2Stadium/Helen/helpers"
+	"github.com/lib/pq"
+)
+
+// NOTIFY payloads have to be shorter than 8000 bytes, longer ones are
+// stored in the bus_payloads table and the notification has their id
+const maxNotifyPayload = 7900
+
+// how long stored payloads are kept, every instance has to read them by then
+const storedPayloadTTL = time.Minute
+
+// PostgresBus is a Bus shared by every Helen instance using the database, with LISTEN/NOTIFY.
+// Messages published while an instance is reconnecting to the database are lost
+type PostgresBus struct {
+	db       *sql.DB
+	listener *pq.Listener
+
+	mutex    sync.RWMutex
+	handlers map[string][]Handler
+
+	quit chan bool
+}
+
+// NewPostgresBus uses db to publish, and opens a connection to url to listen
+func NewPostgresBus(db *sql.DB, url string) (*PostgresBus, error) {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS bus_payloads (
+		id serial PRIMARY KEY,
+		payload text NOT NULL,
+		created_at timestamp with time zone NOT NULL DEFAULT now())`)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &PostgresBus{
+		db:       db,
+		handlers: make(map[string][]Handler),
+		quit:     make(chan bool),
+	}
+
+	b.listener = pq.NewListener(url, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			helpers.Logger.Warning("[Bus.Listen]: %s", err.Error())
+		}
+	})
+
+	go b.listen()
+	return b, nil
+}
+
+func (b *PostgresBus) Publish(channel string, payload string) error {
+	// the first byte says where the payload is
+	if len(payload) < maxNotifyPayload {
+		_, err := b.db.Exec("SELECT pg_notify($1, $2)", channel, "m"+payload)
+		return err
+	}
+
+	var id int64
+	err := b.db.QueryRow("INSERT INTO bus_payloads (payload) VALUES ($1) RETURNING id", payload).Scan(&id)
+	if err != nil {
+		return err
+	}
+
+	b.db.Exec("DELETE FROM bus_payloads WHERE created_at < $1", time.Now().Add(-storedPayloadTTL))
+
+	_, err = b.db.Exec("SELECT pg_notify($1, $2)", channel, "r"+strconv.FormatInt(id, 10))
+	return err
+}
+
+func (b *PostgresBus) Subscribe(channel string, handler Handler) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if _, ok := b.handlers[channel]; !ok {
+		if err := b.listener.Listen(channel); err != nil {
+			return err
+		}
+	}
+
+	handlers := make([]Handler, len(b.handlers[channel]), len(b.handlers[channel])+1)
+	copy(handlers, b.handlers[channel])
+	b.handlers[channel] = append(handlers, handler)
+	return nil
+}
+
+func (b *PostgresBus) Close() error {
+	close(b.quit)
+	return b.listener.Close()
+}
+
+func (b *PostgresBus) payload(extra string) (string, error) {
+	if extra == "" {
+		return "", errors.New("Empty notification")
+	}
+
+	switch extra[0] {
+	case 'm':
+		return extra[1:], nil
+	case 'r':
+		var payload string
+		err := b.db.QueryRow("SELECT payload FROM bus_payloads WHERE id = $1", extra[1:]).Scan(&payload)
+		return payload, err
+	}
+
+	return "", errors.New("Unknown notification: " + extra)
+}
+
+func (b *PostgresBus) listen() {
+	for {
+		select {
+		case notification := <-b.listener.Notify:
+			// nil after reconnecting
+			if notification == nil {
+				continue
+			}
+
+			payload, err := b.payload(notification.Extra)
+			if err != nil {
+				helpers.Logger.Warning("[Bus.Listen]: %s: %s", notification.Channel, err.Error())
+				continue
+			}
+
+			b.mutex.RLock()
+			handlers := b.handlers[notification.Channel]
+			b.mutex.RUnlock()
+
+			for _, handler := range handlers {
+				handler(payload)
+			}
+
+		case <-time.After(90 * time.Second):
+			// notices a lost connection
+			go b.listener.Ping()
+
+		case <-b.quit:
+			return
+		}
+	}
+}
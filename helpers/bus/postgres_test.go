@@ -0,0 +1,54 @@
+package bus_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TF2Stadium/Helen/database"
+	"github.com/TF2Stadium/Helen/database/migrations"
+	"github.com/TF2Stadium/Helen/helpers"
+	"github.com/TF2Stadium/Helen/helpers/bus"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	helpers.InitLogger()
+}
+
+func receive(t *testing.T, payloads chan string) string {
+	select {
+	case payload := <-payloads:
+		return payload
+	case <-time.After(5 * time.Second):
+		t.Fatal("Didn't get the message")
+	}
+	return ""
+}
+
+func TestPostgresBus(t *testing.T) {
+	migrations.TestCleanup()
+
+	// two instances
+	first, err := bus.NewPostgresBus(database.DB.DB(), database.DbUrl)
+	assert.Nil(t, err)
+	defer first.Close()
+	second, err := bus.NewPostgresBus(database.DB.DB(), database.DbUrl)
+	assert.Nil(t, err)
+	defer second.Close()
+
+	firstPayloads := make(chan string, 10)
+	secondPayloads := make(chan string, 10)
+	assert.Nil(t, first.Subscribe("test_bus", func(payload string) { firstPayloads <- payload }))
+	assert.Nil(t, second.Subscribe("test_bus", func(payload string) { secondPayloads <- payload }))
+
+	assert.Nil(t, first.Publish("test_bus", "hello"))
+	assert.Equal(t, "hello", receive(t, firstPayloads))
+	assert.Equal(t, "hello", receive(t, secondPayloads))
+
+	// too long for a notification
+	long := strings.Repeat("a", 20000)
+	assert.Nil(t, second.Publish("test_bus", long))
+	assert.Equal(t, long, receive(t, firstPayloads))
+	assert.Equal(t, long, receive(t, secondPayloads))
+}
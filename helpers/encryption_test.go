@@ -0,0 +1,29 @@
+package helpers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncryption(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	data, err := Encrypt(key, []byte("rcon password"))
+	assert.Nil(t, err)
+	assert.NotContains(t, string(data), "rcon password")
+
+	// same plaintext, different nonce
+	data2, _ := Encrypt(key, []byte("rcon password"))
+	assert.NotEqual(t, data, data2)
+
+	plaintext, err := Decrypt(key, data)
+	assert.Nil(t, err)
+	assert.Equal(t, "rcon password", string(plaintext))
+
+	_, err = Decrypt([]byte("fedcba9876543210fedcba9876543210"), data)
+	assert.NotNil(t, err)
+
+	_, err = Decrypt(key, []byte("short"))
+	assert.NotNil(t, err)
+}
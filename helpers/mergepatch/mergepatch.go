@@ -0,0 +1,88 @@
+// Package mergepatch makes and applies JSON merge patches (RFC 7386):
+// an object with the members that changed, null for the removed ones.
+// Arrays are replaced as a whole
+package mergepatch
+
+import (
+	"encoding/json"
+	"reflect"
+)
+
+// Diff returns the patch that turns the from object into the to object
+func Diff(from []byte, to []byte) ([]byte, error) {
+	var fromObj, toObj map[string]interface{}
+	if err := json.Unmarshal(from, &fromObj); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(to, &toObj); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(diff(fromObj, toObj))
+}
+
+func diff(from map[string]interface{}, to map[string]interface{}) map[string]interface{} {
+	patch := make(map[string]interface{})
+
+	for key := range from {
+		if _, ok := to[key]; !ok {
+			patch[key] = nil
+		}
+	}
+
+	for key, toVal := range to {
+		fromVal, ok := from[key]
+		if !ok {
+			patch[key] = toVal
+			continue
+		}
+
+		fromMap, fromIsMap := fromVal.(map[string]interface{})
+		toMap, toIsMap := toVal.(map[string]interface{})
+		if fromIsMap && toIsMap {
+			if sub := diff(fromMap, toMap); len(sub) != 0 {
+				patch[key] = sub
+			}
+		} else if !reflect.DeepEqual(fromVal, toVal) {
+			patch[key] = toVal
+		}
+	}
+
+	return patch
+}
+
+// Apply returns the doc object with the patch applied
+func Apply(doc []byte, patch []byte) ([]byte, error) {
+	var docObj interface{}
+	var patchObj interface{}
+	if err := json.Unmarshal(doc, &docObj); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patch, &patchObj); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(apply(docObj, patchObj))
+}
+
+func apply(doc interface{}, patch interface{}) interface{} {
+	patchMap, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	docMap, ok := doc.(map[string]interface{})
+	if !ok {
+		docMap = make(map[string]interface{})
+	}
+
+	for key, val := range patchMap {
+		if val == nil {
+			delete(docMap, key)
+		} else {
+			docMap[key] = apply(docMap[key], val)
+		}
+	}
+
+	return docMap
+}
@@ -0,0 +1,47 @@
+package mergepatch
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiff(t *testing.T) {
+	from := `{"id": 1, "map": "cp_badlands", "players": 3, "removed": true,
+		"classes": {"scout": {"red": {"name": "", "ready": false}, "blu": {"name": "b"}}},
+		"list": [1, 2]}`
+	to := `{"id": 1, "map": "cp_badlands", "players": 4, "added": "a",
+		"classes": {"scout": {"red": {"name": "r", "ready": false}, "blu": {"name": "b"}}},
+		"list": [1, 3]}`
+
+	patch, err := Diff([]byte(from), []byte(to))
+	assert.Nil(t, err)
+
+	var patchObj map[string]interface{}
+	json.Unmarshal(patch, &patchObj)
+	assert.Equal(t, map[string]interface{}{
+		"players": float64(4),
+		"added":   "a",
+		"removed": nil,
+		"classes": map[string]interface{}{
+			"scout": map[string]interface{}{
+				"red": map[string]interface{}{"name": "r"},
+			},
+		},
+		"list": []interface{}{float64(1), float64(3)},
+	}, patchObj)
+
+	applied, err := Apply([]byte(from), patch)
+	assert.Nil(t, err)
+	assert.JSONEq(t, to, string(applied))
+}
+
+func TestDiffUnchanged(t *testing.T) {
+	patch, err := Diff([]byte(`{"a": {"b": 1}}`), []byte(`{"a": {"b": 1}}`))
+	assert.Nil(t, err)
+	assert.Equal(t, "{}", string(patch))
+
+	_, err = Diff([]byte(`[1]`), []byte(`{}`))
+	assert.NotNil(t, err)
+}
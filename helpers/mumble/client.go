@@ -0,0 +1,111 @@
+// Package mumble talks to the admin api of our murmur server.
+//
+// The api is a small HTTP service next to murmur, tools/mumble-admin, it uses
+// murmur's ICE interface to manage channels and registered users:
+//
+//	POST   /channels              {"name": "match1", "parent": 0} -> {"id": 12}
+//	DELETE /channels/<id>         deletes the channel and its subchannels
+//	PUT    /users/<name>          {"password": "..."} registers or updates a user
+//	DELETE /users/<name>
+//	GET    /channels/<id>/users   -> [{"name": "...", "channel": 13}], connected users
+//	                              in the channel and its subchannels
+//
+// Requests are authenticated with the "Authorization: Bearer <key>" header.
+package mumble
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// the channel every other channel is in
+const RootChannel = 0
+
+// a user connected to the server
+type User struct {
+	Name    string `json:"name"`
+	Channel int    `json:"channel"`
+}
+
+type Client struct {
+	Url string
+	Key string
+
+	http *http.Client
+}
+
+func NewClient(url string, key string) *Client {
+	return &Client{
+		Url:  url,
+		Key:  key,
+		http: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// sends the request, and decodes the response in out if it isn't nil
+func (c *Client) do(method string, path string, in interface{}, out interface{}) error {
+	var body bytes.Buffer
+	if in != nil {
+		if err := json.NewEncoder(&body).Encode(in); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, c.Url+path, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.Key)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("[Mumble]: %s %s: %s", method, path, resp.Status)
+	}
+
+	if out != nil {
+		return json.NewDecoder(resp.Body).Decode(out)
+	}
+	return nil
+}
+
+// CreateChannel creates a channel in the parent channel and returns its id
+func (c *Client) CreateChannel(name string, parent int) (int, error) {
+	var channel struct {
+		Id int `json:"id"`
+	}
+
+	err := c.do("POST", "/channels", map[string]interface{}{"name": name, "parent": parent}, &channel)
+	return channel.Id, err
+}
+
+// DeleteChannel deletes the channel and its subchannels, users in it are moved to the root channel
+func (c *Client) DeleteChannel(id int) error {
+	return c.do("DELETE", fmt.Sprintf("/channels/%d", id), nil, nil)
+}
+
+// RegisterUser registers the user, or changes the password if it's already registered
+func (c *Client) RegisterUser(name string, password string) error {
+	return c.do("PUT", "/users/"+url.QueryEscape(name), map[string]string{"password": password}, nil)
+}
+
+func (c *Client) UnregisterUser(name string) error {
+	return c.do("DELETE", "/users/"+url.QueryEscape(name), nil, nil)
+}
+
+// ChannelUsers returns the users connected to the channel or its subchannels
+func (c *Client) ChannelUsers(id int) ([]User, error) {
+	var users []User
+	err := c.do("GET", fmt.Sprintf("/channels/%d/users", id), nil, &users)
+
+	return users, err
+}
@@ -0,0 +1,46 @@
+package mumble_test
+
+import (
+	"testing"
+
+	"github.com/TF2Stadium/Helen/helpers/mumble"
+	"github.com/TF2Stadium/Helen/helpers/mumble/mumbletest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChannels(t *testing.T) {
+	server := mumbletest.NewServer("key")
+	defer server.Close()
+	client := mumble.NewClient(server.URL, "key")
+
+	match, err := client.CreateChannel("match1", mumble.RootChannel)
+	assert.Nil(t, err)
+	red, err := client.CreateChannel("RED", match)
+	assert.Nil(t, err)
+	assert.Equal(t, red, server.ChannelId("RED", match))
+
+	assert.Nil(t, client.RegisterUser("player", "password"))
+	assert.Nil(t, server.Connect("player", "password", red))
+	assert.NotNil(t, server.Connect("player", "wrong", red))
+
+	users, err := client.ChannelUsers(match)
+	assert.Nil(t, err)
+	assert.Equal(t, []mumble.User{{Name: "player", Channel: red}}, users)
+
+	assert.Nil(t, client.DeleteChannel(match))
+	assert.Equal(t, -1, server.ChannelId("RED", match))
+	_, err = client.ChannelUsers(match)
+	assert.NotNil(t, err)
+
+	assert.Nil(t, client.UnregisterUser("player"))
+	assert.False(t, server.IsRegistered("player"))
+}
+
+func TestUnauthorized(t *testing.T) {
+	server := mumbletest.NewServer("key")
+	defer server.Close()
+	client := mumble.NewClient(server.URL, "wrong key")
+
+	_, err := client.CreateChannel("match1", mumble.RootChannel)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,198 @@
+// Package mumbletest is a local stand-in for the mumble admin api, for tests
+package mumbletest
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/TF2Stadium/Helen/helpers/mumble"
+)
+
+var ErrBadPassword = errors.New("[mumbletest]: Wrong password")
+
+type Channel struct {
+	Id     int
+	Name   string
+	Parent int
+}
+
+// Server keeps the channels and users in memory
+type Server struct {
+	URL string
+	Key string
+
+	mutex      sync.Mutex
+	server     *httptest.Server
+	nextId     int
+	channels   map[int]*Channel
+	registered map[string]string // name -> password
+	connected  map[string]int    // name -> channel
+}
+
+func NewServer(key string) *Server {
+	s := &Server{
+		Key:        key,
+		nextId:     1,
+		channels:   map[int]*Channel{mumble.RootChannel: &Channel{Name: "Root"}},
+		registered: make(map[string]string),
+		connected:  make(map[string]int),
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.handle))
+	s.URL = s.server.URL
+
+	return s
+}
+
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Connect simulates a registered user joining the channel
+func (s *Server) Connect(name string, password string, channel int) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if pwd, ok := s.registered[name]; !ok || pwd != password {
+		return ErrBadPassword
+	}
+	s.connected[name] = channel
+	return nil
+}
+
+func (s *Server) Disconnect(name string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	delete(s.connected, name)
+}
+
+// ChannelId returns the id of the channel with that name in the parent channel, -1 if it doesn't exist
+func (s *Server) ChannelId(name string, parent int) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for id, channel := range s.channels {
+		if id != mumble.RootChannel && channel.Name == name && channel.Parent == parent {
+			return id
+		}
+	}
+	return -1
+}
+
+func (s *Server) IsRegistered(name string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	_, ok := s.registered[name]
+	return ok
+}
+
+// true if the channel is the parent or one of its subchannels
+func (s *Server) isInChannel(channel int, parent int) bool {
+	for {
+		if channel == parent {
+			return true
+		}
+		c, ok := s.channels[channel]
+		if !ok || channel == mumble.RootChannel {
+			return false
+		}
+		channel = c.Parent
+	}
+}
+
+func (s *Server) deleteChannel(id int) {
+	for childId, child := range s.channels {
+		if childId != mumble.RootChannel && child.Parent == id {
+			s.deleteChannel(childId)
+		}
+	}
+	delete(s.channels, id)
+
+	for name, channel := range s.connected {
+		if channel == id {
+			s.connected[name] = mumble.RootChannel
+		}
+	}
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Authorization") != "Bearer "+s.Key {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+
+	switch {
+	case r.Method == "POST" && len(parts) == 1 && parts[0] == "channels":
+		var req struct {
+			Name   string `json:"name"`
+			Parent int    `json:"parent"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Name == "" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if _, ok := s.channels[req.Parent]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		id := s.nextId
+		s.nextId++
+		s.channels[id] = &Channel{Id: id, Name: req.Name, Parent: req.Parent}
+		json.NewEncoder(w).Encode(map[string]int{"id": id})
+
+	case r.Method == "DELETE" && len(parts) == 2 && parts[0] == "channels":
+		id, err := strconv.Atoi(parts[1])
+		if _, ok := s.channels[id]; err != nil || !ok || id == mumble.RootChannel {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		s.deleteChannel(id)
+
+	case r.Method == "GET" && len(parts) == 3 && parts[0] == "channels" && parts[2] == "users":
+		id, err := strconv.Atoi(parts[1])
+		if _, ok := s.channels[id]; err != nil || !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		users := []mumble.User{}
+		for name, channel := range s.connected {
+			if s.isInChannel(channel, id) {
+				users = append(users, mumble.User{Name: name, Channel: channel})
+			}
+		}
+		json.NewEncoder(w).Encode(users)
+
+	case r.Method == "PUT" && len(parts) == 2 && parts[0] == "users":
+		name, _ := url.QueryUnescape(parts[1])
+		var req struct {
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		s.registered[name] = req.Password
+
+	case r.Method == "DELETE" && len(parts) == 2 && parts[0] == "users":
+		name, _ := url.QueryUnescape(parts[1])
+		delete(s.registered, name)
+		delete(s.connected, name)
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
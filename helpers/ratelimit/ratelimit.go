@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Limiter lets each key do something at most Max times per Interval
+type Limiter struct {
+	Max      int
+	Interval time.Duration
+
+	mutex  sync.Mutex
+	events map[string][]time.Time // times of the recent events, oldest first
+	pruned time.Time              // when the keys without recent events were last dropped
+}
+
+func NewLimiter(max int, interval time.Duration) *Limiter {
+	return &Limiter{
+		Max:      max,
+		Interval: interval,
+		events:   make(map[string][]time.Time),
+	}
+}
+
+// Allow records an event for the key and returns true, or returns false if the key
+// already did Max things in the last Interval. Refused events aren't recorded
+func (l *Limiter) Allow(key string) bool {
+	return l.AllowAt(key, time.Now())
+}
+
+func (l *Limiter) AllowAt(key string, now time.Time) bool {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if now.Sub(l.pruned) >= l.Interval {
+		l.prune(now)
+	}
+
+	// forget the events that are too old to count
+	events := l.events[key]
+	i := 0
+	for i < len(events) && !events[i].After(now.Add(-l.Interval)) {
+		i++
+	}
+	events = events[i:]
+
+	if len(events) >= l.Max {
+		l.events[key] = events
+		return false
+	}
+
+	l.events[key] = append(events, now)
+	return true
+}
+
+// drops the keys whose events are all too old to count, so keys
+// that stopped doing things don't stay in the map
+func (l *Limiter) prune(now time.Time) {
+	for key, events := range l.events {
+		if len(events) == 0 || !events[len(events)-1].After(now.Add(-l.Interval)) {
+			delete(l.events, key)
+		}
+	}
+	l.pruned = now
+}
+
+// Reset forgets the key's events
+func (l *Limiter) Reset(key string) {
+	l.mutex.Lock()
+	delete(l.events, key)
+	l.mutex.Unlock()
+}
@@ -0,0 +1,50 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimiter(t *testing.T) {
+	limiter := NewLimiter(3, 10*time.Second)
+	start := time.Now()
+
+	assert.True(t, limiter.AllowAt("a", start))
+	assert.True(t, limiter.AllowAt("a", start.Add(time.Second)))
+	assert.True(t, limiter.AllowAt("a", start.Add(2*time.Second)))
+	assert.False(t, limiter.AllowAt("a", start.Add(3*time.Second)))
+
+	// other keys have their own limit
+	assert.True(t, limiter.AllowAt("b", start.Add(3*time.Second)))
+
+	// the first event is too old to count
+	assert.True(t, limiter.AllowAt("a", start.Add(10*time.Second)))
+	assert.False(t, limiter.AllowAt("a", start.Add(10*time.Second)))
+
+	limiter.Reset("a")
+	assert.True(t, limiter.AllowAt("a", start.Add(10*time.Second)))
+}
+
+func TestLimiterPrune(t *testing.T) {
+	limiter := NewLimiter(3, 10*time.Second)
+	start := time.Now()
+
+	assert.True(t, limiter.AllowAt("a", start))
+	assert.True(t, limiter.AllowAt("b", start.Add(5*time.Second)))
+	assert.Equal(t, 2, len(limiter.events))
+
+	// a's events are too old to count, b's last one still counts
+	assert.True(t, limiter.AllowAt("c", start.Add(11*time.Second)))
+	assert.Equal(t, 2, len(limiter.events))
+	_, ok := limiter.events["a"]
+	assert.False(t, ok)
+
+	// not before another interval passed
+	assert.True(t, limiter.AllowAt("c", start.Add(16*time.Second)))
+	assert.Equal(t, 2, len(limiter.events))
+
+	assert.True(t, limiter.AllowAt("c", start.Add(21*time.Second)))
+	assert.Equal(t, 1, len(limiter.events))
+}
@@ -0,0 +1,130 @@
+// Package rcontest fakes TF2 servers for tests: FakeRcon is an in-process rcon client
+// and Server speaks the Source RCON protocol on a local TCP port.
+package rcontest
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/TF2Stadium/TF2RconWrapper"
+)
+
+// FakeRcon records the commands it's sent, the players and query responses are scripted
+type FakeRcon struct {
+	mutex sync.Mutex
+
+	Players   []TF2RconWrapper.Player // returned by GetPlayers, kicked players are removed
+	Responses map[string]string       // query -> response
+	Errors    map[string]error        // method name -> error it returns, like "ChangeMap", or "Query <req>" for one query
+
+	commands []string
+	closed   bool
+}
+
+func NewFakeRcon(players ...TF2RconWrapper.Player) *FakeRcon {
+	return &FakeRcon{
+		Players:   append([]TF2RconWrapper.Player(nil), players...),
+		Responses: make(map[string]string),
+		Errors:    make(map[string]error),
+	}
+}
+
+// Commands returns the console commands sent so far
+func (r *FakeRcon) Commands() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]string(nil), r.commands...)
+}
+
+func (r *FakeRcon) IsClosed() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.closed
+}
+
+// records the command, unless the method was scripted to fail
+func (r *FakeRcon) run(method string, command string) error {
+	if err, ok := r.Errors[method]; ok {
+		return err
+	}
+	r.commands = append(r.commands, command)
+	return nil
+}
+
+func (r *FakeRcon) Query(req string) (string, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err, ok := r.Errors["Query "+req]; ok {
+		return "", err
+	}
+	if err := r.run("Query", req); err != nil {
+		return "", err
+	}
+	return r.Responses[req], nil
+}
+
+func (r *FakeRcon) GetPlayers() ([]TF2RconWrapper.Player, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err := r.run("GetPlayers", "status"); err != nil {
+		return nil, err
+	}
+	return append([]TF2RconWrapper.Player(nil), r.Players...), nil
+}
+
+func (r *FakeRcon) KickPlayer(p TF2RconWrapper.Player, message string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err := r.run("KickPlayer", fmt.Sprintf("kickid %s %s", p.UserID, message)); err != nil {
+		return err
+	}
+
+	for i := range r.Players {
+		if r.Players[i].UserID == p.UserID {
+			r.Players = append(r.Players[:i], r.Players[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (r *FakeRcon) Say(message string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.run("Say", "say "+message)
+}
+
+func (r *FakeRcon) ChangeServerPassword(password string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.run("ChangeServerPassword", "sv_password "+password)
+}
+
+func (r *FakeRcon) ChangeMap(mapname string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.run("ChangeMap", "changelevel "+mapname)
+}
+
+// the config's text isn't recorded, only that a config was run
+func (r *FakeRcon) ExecConfig(config string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return r.run("ExecConfig", "exec")
+}
+
+func (r *FakeRcon) Close() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.closed = true
+}
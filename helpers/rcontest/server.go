@@ -0,0 +1,159 @@
+package rcontest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync"
+)
+
+// Source RCON packet types
+const (
+	PacketResponseValue = 0
+	PacketExecCommand   = 2
+	PacketAuthResponse  = 2
+	PacketAuth          = 3
+)
+
+const maxPacketSize = 4096
+
+var ErrPacketTooBig = errors.New("[rcontest]: Packet is too big")
+
+// Handler returns the response for a command
+type Handler func(command string) string
+
+// Server is a local stand-in for a TF2 server's rcon port
+type Server struct {
+	Password string
+	Handler  Handler // nil means empty responses
+
+	listener net.Listener
+	mutex    sync.Mutex
+	commands []string
+}
+
+// NewServer starts listening on a random local port
+func NewServer(password string, handler Handler) (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{Password: password, Handler: handler, listener: listener}
+	go s.serve()
+
+	return s, nil
+}
+
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+func (s *Server) Close() error {
+	return s.listener.Close()
+}
+
+// Commands returns the commands received from authenticated connections
+func (s *Server) Commands() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return append([]string(nil), s.commands...)
+}
+
+func (s *Server) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	authenticated := false
+
+	for {
+		id, packetType, body, err := ReadPacket(reader)
+		if err != nil {
+			return
+		}
+
+		switch packetType {
+		case PacketAuth:
+			// like srcds, an empty response comes before the auth response
+			WritePacket(conn, id, PacketResponseValue, "")
+
+			if body != s.Password {
+				WritePacket(conn, -1, PacketAuthResponse, "")
+				return
+			}
+			authenticated = true
+			WritePacket(conn, id, PacketAuthResponse, "")
+
+		case PacketExecCommand:
+			if !authenticated {
+				return
+			}
+
+			s.mutex.Lock()
+			s.commands = append(s.commands, body)
+			s.mutex.Unlock()
+
+			var response string
+			if s.Handler != nil {
+				response = s.Handler(body)
+			}
+			WritePacket(conn, id, PacketResponseValue, response)
+
+		case PacketResponseValue:
+			// clients send an empty response value to find the end of multi-packet responses
+			WritePacket(conn, id, PacketResponseValue, "")
+		}
+	}
+}
+
+// ReadPacket reads a packet: size, id, type, body and two null bytes, little endian
+func ReadPacket(r io.Reader) (int32, int32, string, error) {
+	var size, id, packetType int32
+
+	if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return 0, 0, "", err
+	}
+	if size < 10 || size > maxPacketSize {
+		return 0, 0, "", ErrPacketTooBig
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return 0, 0, "", err
+	}
+
+	buf := bytes.NewReader(data)
+	binary.Read(buf, binary.LittleEndian, &id)
+	binary.Read(buf, binary.LittleEndian, &packetType)
+
+	// strip the null terminators
+	body := data[8 : size-2]
+	return id, packetType, string(body), nil
+}
+
+func WritePacket(w io.Writer, id int32, packetType int32, body string) error {
+	var buf bytes.Buffer
+
+	binary.Write(&buf, binary.LittleEndian, int32(len(body)+10))
+	binary.Write(&buf, binary.LittleEndian, id)
+	binary.Write(&buf, binary.LittleEndian, packetType)
+	buf.WriteString(body)
+	buf.Write([]byte{0, 0})
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,70 @@
+package rcontest
+
+import (
+	"bufio"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func dial(t *testing.T, s *Server, password string) (net.Conn, *bufio.Reader, bool) {
+	conn, err := net.Dial("tcp", s.Addr())
+	assert.Nil(t, err)
+	reader := bufio.NewReader(conn)
+
+	WritePacket(conn, 1, PacketAuth, password)
+
+	_, packetType, _, err := ReadPacket(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(PacketResponseValue), packetType)
+
+	id, packetType, _, err := ReadPacket(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(PacketAuthResponse), packetType)
+
+	return conn, reader, id == 1
+}
+
+func TestServerAuth(t *testing.T) {
+	s, err := NewServer("rcon", nil)
+	assert.Nil(t, err)
+	defer s.Close()
+
+	conn, _, ok := dial(t, s, "wrong")
+	conn.Close()
+	assert.False(t, ok)
+
+	conn, _, ok = dial(t, s, "rcon")
+	conn.Close()
+	assert.True(t, ok)
+}
+
+func TestServerCommands(t *testing.T) {
+	s, err := NewServer("rcon", func(command string) string {
+		if command == "status" {
+			return "hostname: TF2Stadium"
+		}
+		return ""
+	})
+	assert.Nil(t, err)
+	defer s.Close()
+
+	conn, reader, ok := dial(t, s, "rcon")
+	defer conn.Close()
+	assert.True(t, ok)
+
+	WritePacket(conn, 2, PacketExecCommand, "status")
+	id, packetType, body, err := ReadPacket(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(2), id)
+	assert.Equal(t, int32(PacketResponseValue), packetType)
+	assert.Equal(t, "hostname: TF2Stadium", body)
+
+	WritePacket(conn, 3, PacketExecCommand, "sv_password 1234")
+	_, _, body, err = ReadPacket(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, "", body)
+
+	assert.Equal(t, []string{"status", "sv_password 1234"}, s.Commands())
+}
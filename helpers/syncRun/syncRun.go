@@ -12,29 +12,64 @@ type collAndId struct {
 	coll string
 }
 
-var mutexStore = make(map[collAndId]*sync.Mutex)
+// a mutex and the number of goroutines holding or waiting for it,
+// it's removed from mutexStore when nobody needs it anymore
+type syncEntry struct {
+	mutex sync.Mutex
+	users int
+}
+
+var mutexStore = make(map[collAndId]*syncEntry)
+var mutexStoreMutex sync.Mutex
 
 type arbFunc func(interface{})
 
-func SyncRunOn(id uint, typeName string, obj interface{}, fn arbFunc) error {
-	key := collAndId{id, typeName}
-	mutex, ok := mutexStore[key]
+func lock(key collAndId) *syncEntry {
+	mutexStoreMutex.Lock()
+	entry, ok := mutexStore[key]
 	if !ok {
-		mutex = &sync.Mutex{}
-		mutexStore[key] = mutex
+		entry = &syncEntry{}
+		mutexStore[key] = entry
 	}
+	entry.users++
+	mutexStoreMutex.Unlock()
 
-	mutex.Lock()
+	entry.mutex.Lock()
+	return entry
+}
+
+func unlock(key collAndId, entry *syncEntry) {
+	entry.mutex.Unlock()
 
-	err := database.DB.First(obj, id).Error
-	if err != nil {
-		return err
+	mutexStoreMutex.Lock()
+	entry.users--
+	if entry.users == 0 {
+		delete(mutexStore, key)
 	}
+	mutexStoreMutex.Unlock()
+}
 
-	fn(obj)
-	mutex.Unlock()
+// SyncRun runs fn once no other SyncRun on the same id and typeName is running in this instance.
+// Other instances aren't stopped, the models lock the database rows they change for that
+func SyncRun(id uint, typeName string, fn func()) {
+	key := collAndId{id, typeName}
+	entry := lock(key)
+	defer unlock(key, entry)
+
+	fn()
+}
+
+// SyncRunOn loads the row with the id from the typeName table into obj and runs fn on it, see SyncRun
+func SyncRunOn(id uint, typeName string, obj interface{}, fn arbFunc) error {
+	var err error
+	SyncRun(id, typeName, func() {
+		err = database.DB.First(obj, id).Error
+		if err == nil {
+			fn(obj)
+		}
+	})
 
-	return nil
+	return err
 }
 
 type lobbyFunc func(*models.Lobby)
@@ -0,0 +1,51 @@
+package helpers
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncRun(t *testing.T) {
+	var wg sync.WaitGroup
+	counters := make([]int, 2)
+
+	for i := 0; i < 50; i++ {
+		for id := range counters {
+			wg.Add(1)
+			go func(id int) {
+				defer wg.Done()
+				SyncRun(uint(id), "test", func() {
+					count := counters[id]
+					time.Sleep(time.Millisecond)
+					counters[id] = count + 1
+				})
+			}(id)
+		}
+	}
+	wg.Wait()
+
+	assert.Equal(t, []int{50, 50}, counters)
+
+	mutexStoreMutex.Lock()
+	assert.Empty(t, mutexStore)
+	mutexStoreMutex.Unlock()
+}
+
+func TestSyncRunPanic(t *testing.T) {
+	func() {
+		defer func() { recover() }()
+		SyncRun(1, "test", func() {
+			panic("failed")
+		})
+	}()
+
+	// not locked anymore
+	ran := false
+	SyncRun(1, "test", func() {
+		ran = true
+	})
+	assert.True(t, ran)
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/TF2Stadium/Helen/database"
 	"github.com/TF2Stadium/Helen/database/migrations"
 	"github.com/TF2Stadium/Helen/helpers"
+	"github.com/TF2Stadium/Helen/helpers/bus"
 	"github.com/TF2Stadium/Helen/models"
 	"github.com/TF2Stadium/Helen/routes"
 	"github.com/googollee/go-socket.io"
@@ -25,7 +26,15 @@ func main() {
 	database.Init()
 	migrations.Do()
 	stores.SetupStores()
-	models.InitServerConfigs()
+	if err := models.InitServerConfigs(); err != nil {
+		helpers.Logger.Fatal(err.Error())
+	}
+	if err := models.InitMapPool(); err != nil {
+		helpers.Logger.Fatal(err.Error())
+	}
+	models.InitServerConfigsWatcher()
+	models.InitLogListener()
+	models.InitServerPoolChecker()
 
 	// lobby := models.NewLobby("cp_badlands", 10, "a", "a", 1)
 	helpers.Logger.Debug("Starting the server")
@@ -41,7 +50,22 @@ func main() {
 	if err != nil {
 		helpers.Logger.Fatal(err.Error())
 	}
-	socket.InitBroadcaster(socketServer)
+	var messageBus bus.Bus
+	switch config.Constants.MessageBus {
+	case "memory":
+		messageBus = bus.NewMemoryBus()
+	case "postgres":
+		messageBus, err = bus.NewPostgresBus(database.DB.DB(), database.DbUrl)
+		if err != nil {
+			helpers.Logger.Fatal(err.Error())
+		}
+	default:
+		helpers.Logger.Fatal("Unknown message bus: " + config.Constants.MessageBus)
+	}
+	socket.InitBroadcaster(socketServer, messageBus)
+	// after the broadcaster, recovering can change the lobbies
+	models.RecoverLobbyServers()
+	socket.RecoverReadyUps()
 	routes.SetupSocketRoutes(socketServer)
 	r.Handle("/socket.io/", socketServer)
 
@@ -58,4 +82,7 @@ func main() {
 	// start the server
 	helpers.Logger.Debug("Serving at localhost:" + config.Constants.Port + "...")
 	graceful.Run(":"+config.Constants.Port, 10*time.Second, corsHandler)
+
+	// the other instances take the lobbies' servers over
+	models.Servers.Shutdown()
 }
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"time"
+
+	db "github.com/TF2Stadium/Helen/database"
+	"github.com/TF2Stadium/Helen/helpers"
+)
+
+// longest message that can be sent, in bytes
+const ChatMessageMaxLength = 512
+
+// a message sent to a chat room, -1 is the lobby list room, the others are lobby ids
+type ChatMessage struct {
+	ID        uint
+	CreatedAt time.Time
+
+	Room     int
+	PlayerID uint
+	Player   Player
+	Message  string `sql:"size:512"` // not escaped
+
+	Deleted bool // deleted by a moderator, not sent anymore
+}
+
+func NewChatMessage(message string, room int, player *Player) (*ChatMessage, *helpers.TPError) {
+	if message == "" {
+		return nil, helpers.NewTPError("The message is empty.", -1)
+	}
+	if len(message) > ChatMessageMaxLength {
+		return nil, helpers.NewTPError("The message is too long.", -1)
+	}
+
+	chatMessage := &ChatMessage{
+		Room:     room,
+		PlayerID: player.ID,
+		Player:   *player,
+		Message:  message,
+	}
+
+	if err := db.DB.Create(chatMessage).Error; err != nil {
+		return nil, helpers.NewTPError(err.Error(), -1)
+	}
+
+	return chatMessage, nil
+}
+
+// GetRoomMessages returns the last count messages sent to the room, oldest first
+func GetRoomMessages(room int, count int) ([]ChatMessage, error) {
+	var messages []ChatMessage
+	err := db.DB.Preload("Player").Where("room = ? AND deleted = ?", room, false).
+		Order("id desc").Limit(count).Find(&messages).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+		messages[i], messages[j] = messages[j], messages[i]
+	}
+	return messages, nil
+}
+
+func GetChatMessageById(id uint) (*ChatMessage, *helpers.TPError) {
+	chatMessage := &ChatMessage{}
+	err := db.DB.Where("id = ? AND deleted = ?", id, false).First(chatMessage).Error
+	if err != nil {
+		return nil, helpers.NewTPError("Message not in the database", -1)
+	}
+	return chatMessage, nil
+}
+
+// Delete hides the message, it's kept in the database
+func (chatMessage *ChatMessage) Delete() *helpers.TPError {
+	err := db.DB.Model(chatMessage).UpdateColumn("deleted", true).Error
+	if err != nil {
+		return helpers.NewTPError(err.Error(), -1)
+	}
+
+	chatMessage.Deleted = true
+	return nil
+}
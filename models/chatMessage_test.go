@@ -0,0 +1,47 @@
+package models_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/TF2Stadium/Helen/database/migrations"
+	"github.com/TF2Stadium/Helen/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChatMessages(t *testing.T) {
+	migrations.TestCleanup()
+
+	player, _ := models.NewPlayer("chatter")
+	player.Save()
+
+	for i := 0; i < 5; i++ {
+		_, tperr := models.NewChatMessage(fmt.Sprint("message", i), -1, player)
+		assert.Nil(t, tperr)
+	}
+	lobbyMessage, _ := models.NewChatMessage("in the lobby", 3, player)
+
+	_, tperr := models.NewChatMessage("", -1, player)
+	assert.NotNil(t, tperr)
+	_, tperr = models.NewChatMessage(strings.Repeat("a", models.ChatMessageMaxLength+1), -1, player)
+	assert.NotNil(t, tperr)
+
+	// the last ones, oldest first
+	messages, err := models.GetRoomMessages(-1, 3)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(messages))
+	assert.Equal(t, "message2", messages[0].Message)
+	assert.Equal(t, "message4", messages[2].Message)
+	assert.Equal(t, "chatter", messages[0].Player.SteamId)
+
+	messages, _ = models.GetRoomMessages(3, 10)
+	assert.Equal(t, 1, len(messages))
+	assert.Equal(t, lobbyMessage.ID, messages[0].ID)
+
+	assert.Nil(t, lobbyMessage.Delete())
+	messages, _ = models.GetRoomMessages(3, 10)
+	assert.Equal(t, 0, len(messages))
+	_, tperr = models.GetChatMessageById(lobbyMessage.ID)
+	assert.NotNil(t, tperr)
+}
@@ -0,0 +1,303 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TF2Stadium/Helen/config"
+	"github.com/TF2Stadium/Helen/helpers"
+)
+
+// everything in the configs directory the server configs are made of.
+// A loaded cache is never modified, reloading replaces it
+type configCache struct {
+	manifest map[League]*LeagueManifest
+	maps     map[string]map[string]map[League]string // maps.json
+	files    map[string]string                       // path in the configs directory -> text
+
+	modTimes map[string]time.Time // to notice changed files
+}
+
+var (
+	configs *configCache
+
+	// the map pool from the database, used instead of maps.json once it's loaded
+	mapPoolData map[string]map[string]map[League]string
+
+	configsMutex sync.RWMutex
+
+	configsTicker *time.Ticker
+)
+
+func getConfigCache() *configCache {
+	configsMutex.RLock()
+	defer configsMutex.RUnlock()
+
+	if configs == nil {
+		return &configCache{}
+	}
+	return configs
+}
+
+// GetConfigManifest returns the leagues from leagues.json
+func GetConfigManifest() map[League]*LeagueManifest {
+	return getConfigCache().manifest
+}
+
+// GetMapModes returns the map's game modes, per format and league
+func GetMapModes(name string) map[string]map[League]string {
+	configsMutex.RLock()
+	defer configsMutex.RUnlock()
+
+	if mapPoolData != nil {
+		return mapPoolData[name]
+	}
+	if configs != nil {
+		return configs.maps[name]
+	}
+	return nil
+}
+
+func setMapPoolData(data map[string]map[string]map[League]string) {
+	configsMutex.Lock()
+	mapPoolData = data
+	configsMutex.Unlock()
+}
+
+func readConfigFile(cache *configCache, name string) ([]byte, error) {
+	path := configFilePath(name)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cache.modTimes[path] = info.ModTime()
+	return data, nil
+}
+
+// loadConfigCache reads and checks the configs directory
+func loadConfigCache() (*configCache, error) {
+	cache := &configCache{
+		files:    make(map[string]string),
+		modTimes: make(map[string]time.Time),
+	}
+
+	// maps
+	mapFile, err := readConfigFile(cache, MapsFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(mapFile, &cache.maps); err != nil {
+		return nil, fmt.Errorf("[Configs.Load]: %s: %s", MapsFile, err.Error())
+	}
+
+	// leagues
+	manifestFile, err := readConfigFile(cache, ManifestFile)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(manifestFile, &cache.manifest); err != nil {
+		return nil, fmt.Errorf("[Configs.Load]: %s: %s", ManifestFile, err.Error())
+	}
+
+	if err := ValidateConfigManifest(cache.manifest, cache.maps); err != nil {
+		return nil, err
+	}
+
+	for _, name := range manifestFiles(cache.manifest) {
+		data, err := readConfigFile(cache, name)
+		if err != nil {
+			return nil, err
+		}
+		cache.files[name] = string(data)
+	}
+
+	return cache, nil
+}
+
+// every file the manifest refers to
+func manifestFiles(manifest map[League]*LeagueManifest) []string {
+	var files []string
+
+	for _, leagueManifest := range manifest {
+		for _, format := range leagueManifest.Formats {
+			files = append(files, format.Layers...)
+			for _, name := range format.Modes {
+				files = append(files, name)
+			}
+			for _, modes := range format.Variants {
+				for _, name := range modes {
+					files = append(files, name)
+				}
+			}
+			if format.Whitelist != "" {
+				files = append(files, format.Whitelist)
+			}
+		}
+	}
+
+	return files
+}
+
+// ValidateConfigManifest checks that every file the manifest refers to exists
+func ValidateConfigManifest(manifest map[League]*LeagueManifest, maps map[string]map[string]map[League]string) error {
+	for league, leagueManifest := range manifest {
+		if leagueManifest == nil || len(leagueManifest.Formats) == 0 {
+			return fmt.Errorf("[Configs.Init]: League %s doesn't have any format", league)
+		}
+	}
+
+	var missing []string
+	for _, name := range manifestFiles(manifest) {
+		if _, err := os.Stat(configFilePath(name)); err != nil {
+			missing = append(missing, name)
+		}
+	}
+
+	if len(missing) != 0 {
+		sort.Strings(missing)
+		return errors.New("[Configs.Init]: Missing config files: " + strings.Join(missing, ", "))
+	}
+
+	// maps.json only refers to game modes, a map using a mode that doesn't exist can't be played
+	for mapName, types := range maps {
+		for format, leagues := range types {
+			for league, mode := range leagues {
+				leagueManifest, ok := manifest[league]
+				if !ok || leagueManifest.Formats[format] == nil {
+					continue
+				}
+				if _, ok := leagueManifest.Formats[format].Modes[mode]; !ok {
+					helpers.Logger.Warning("[Configs.Init]: %s: %s %s has no \"%s\" config", mapName, league, format, mode)
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// InitServerConfigs loads the configs directory, and forgets the map pool
+func InitServerConfigs() error {
+	helpers.Logger.Debug("[Configs.Init] Loading server configs...")
+	cache, err := loadConfigCache()
+	if err != nil {
+		helpers.Logger.Debug("[Configs.Init] ERROR while trying to load the server configs!")
+		return err
+	}
+
+	configsMutex.Lock()
+	configs = cache
+	mapPoolData = nil
+	configsMutex.Unlock()
+
+	helpers.Logger.Debug("[Configs.Init] Server configs loaded!")
+	return nil
+}
+
+// ReloadServerConfigs loads the configs directory again. If it has errors,
+// the configs that were loaded are kept
+func ReloadServerConfigs() error {
+	cache, err := loadConfigCache()
+	if err != nil {
+		helpers.Logger.Warning("[Configs.Reload]: Keeping the old configs: %s", err.Error())
+		return err
+	}
+
+	configsMutex.Lock()
+	configs = cache
+	poolLoaded := mapPoolData != nil
+	configsMutex.Unlock()
+
+	// new maps in maps.json go in the pool. The maps already in it are edited by
+	// the admins, changes to them in maps.json are skipped
+	if poolLoaded {
+		if _, err := ImportMapsJson(configFilePath(MapsFile)); err != nil {
+			helpers.Logger.Warning("[Configs.Reload]: %s", err.Error())
+		}
+	}
+
+	helpers.Logger.Debug("[Configs.Reload]: Server configs reloaded")
+	return nil
+}
+
+// true if a loaded file was changed or removed
+func (cache *configCache) isChanged() bool {
+	for path, modTime := range cache.modTimes {
+		info, err := os.Stat(path)
+		if err != nil {
+			// zero if it was already missing
+			if !modTime.IsZero() {
+				return true
+			}
+		} else if !info.ModTime().Equal(modTime) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reloads the configs if a file was changed
+func checkServerConfigs() {
+	cache := getConfigCache()
+	if !cache.isChanged() {
+		return
+	}
+
+	helpers.Logger.Debug("[Configs.Watch]: The config files changed, reloading")
+	if err := ReloadServerConfigs(); err != nil {
+		// don't try again until the files change again
+		configsMutex.Lock()
+		if configs == cache {
+			configs = &configCache{
+				manifest: cache.manifest,
+				maps:     cache.maps,
+				files:    cache.files,
+				modTimes: currentModTimes(cache.modTimes),
+			}
+		}
+		configsMutex.Unlock()
+	}
+}
+
+func currentModTimes(modTimes map[string]time.Time) map[string]time.Time {
+	current := make(map[string]time.Time)
+	for path := range modTimes {
+		if info, err := os.Stat(path); err == nil {
+			current[path] = info.ModTime()
+		} else {
+			current[path] = time.Time{}
+		}
+	}
+	return current
+}
+
+// InitServerConfigsWatcher checks the config files for changes every
+// config.Constants.ConfigsReloadInterval seconds
+func InitServerConfigsWatcher() {
+	if config.Constants.ConfigsReloadInterval <= 0 {
+		return
+	}
+
+	configsTicker = time.NewTicker(time.Duration(config.Constants.ConfigsReloadInterval) * time.Second)
+	go func() {
+		for {
+			<-configsTicker.C
+			checkServerConfigs()
+		}
+	}()
+}
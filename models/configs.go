@@ -1,22 +1,24 @@
 package models
 
 import (
-	"encoding/json"
 	"errors"
-	"io/ioutil"
+	"fmt"
 	"path/filepath"
+	"sort"
 
 	"github.com/TF2Stadium/Helen/config"
 	"github.com/TF2Stadium/Helen/helpers"
 )
 
 const (
-	ConfigsPath = "/configs/"
-	MapsFile    = "maps.json"
+	ConfigsPath  = "/configs/"
+	MapsFile     = "maps.json"
+	ManifestFile = "leagues.json"
 )
 
 type League string
 
+// the leagues are in the config manifest, these are the ones the code uses as defaults
 const (
 	LeagueUgc   League = "ugc"
 	LeagueEtf2l League = "etf2l"
@@ -26,26 +28,20 @@ func (l *League) String() string {
 	return string(*l)
 }
 
-// valid leagues
-var Leagues = [...]League{
-	LeagueUgc,
-	LeagueEtf2l,
+// the configs a league has for a format (6v6, 9v9...), in leagues.json.
+// Paths are relative to the configs directory
+type FormatManifest struct {
+	Layers    []string                     `json:"layers"`    // run before the mode's config, in order
+	Modes     map[string]string            `json:"modes"`     // game mode, as in maps.json -> config
+	Variants  map[string]map[string]string `json:"variants"`  // rules variant -> game mode -> config
+	Whitelist string                       `json:"whitelist"` // item whitelist, uploaded to the game servers
+	Cvars     map[string]string            `json:"cvars"`     // set after the configs
 }
 
-// pre config list
-const (
-	// etf2l
-	Etf2lInitConfig           = "/etf2l/etf2l.cfg"
-	Etf2lBaseSixesConfig      = "/etf2l/etf2l_6v6.cfg"
-	Etf2lBaseHighlanderConfig = "/etf2l/etf2l_9v9.cfg"
-
-	// ugc
-	UgcBaseSixesConfig      = "/ugc/ugc_6v_base.cfg"
-	UgcBaseHighlanderConfig = "/ugc/ugc_HL_base.cfg"
-)
-
-// MapsData holds the map + config list from maps.json
-var MapsData map[string]map[string]map[League]string
+type LeagueManifest struct {
+	Name    string                     `json:"name"`
+	Formats map[string]*FormatManifest `json:"formats"` // Format.Config -> configs
+}
 
 // configs.json
 type ServerConfig struct {
@@ -54,23 +50,85 @@ type ServerConfig struct {
 	Type   LobbyType // 9v9, 6v6...
 	Data   string    // config file's text
 	Map    string
+
+	RulesVariant string // one of GetRulesVariants, "" for the normal rules
 }
 
-func InitServerConfigs() error {
-	// maps
-	helpers.Logger.Debug("[Configs.Init] Loading maps configs...")
-	mapFile, mapErr := ioutil.ReadFile(config.Constants.StaticFileLocation + ConfigsPath + MapsFile)
+func configFilePath(name string) string {
+	return filepath.Clean(config.Constants.StaticFileLocation + ConfigsPath + name)
+}
 
-	if mapErr == nil {
-		json.Unmarshal(mapFile, &MapsData)
-		helpers.Logger.Debug("[Configs.Init] Maps configs loaded!")
+// GetLeagues returns the leagues in the manifest, sorted
+func GetLeagues() []League {
+	var leagues []League
+	for league := range GetConfigManifest() {
+		leagues = append(leagues, league)
+	}
 
-	} else {
-		helpers.Logger.Debug("[Configs.Init] ERROR while trying to load maps configs!")
-		return mapErr
+	sort.Sort(leagueSlice(leagues))
+	return leagues
+}
+
+type leagueSlice []League
+
+func (s leagueSlice) Len() int           { return len(s) }
+func (s leagueSlice) Less(i, j int) bool { return s[i] < s[j] }
+func (s leagueSlice) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+func IsLeagueValid(league League) bool {
+	_, ok := GetConfigManifest()[league]
+	return ok
+}
+
+// GetFormatManifest returns the league's configs for the lobby type, nil if it doesn't have any
+func GetFormatManifest(league League, lobbyType LobbyType) *FormatManifest {
+	return getConfigCache().formatManifest(league, lobbyType)
+}
+
+func (cache *configCache) formatManifest(league League, lobbyType LobbyType) *FormatManifest {
+	leagueManifest, ok := cache.manifest[league]
+	format := GetFormat(lobbyType)
+	if !ok || format == nil {
+		return nil
 	}
 
-	return nil
+	return leagueManifest.Formats[format.Config]
+}
+
+// GetRulesVariants returns the rule variants the league has configs for, like "overtime"
+func GetRulesVariants(league League) []string {
+	set := make(map[string]bool)
+
+	if leagueManifest, ok := GetConfigManifest()[league]; ok {
+		for _, format := range leagueManifest.Formats {
+			for variant := range format.Variants {
+				set[variant] = true
+			}
+		}
+	}
+
+	var variants []string
+	for variant := range set {
+		variants = append(variants, variant)
+	}
+
+	sort.Strings(variants)
+	return variants
+}
+
+// the normal rules ("") are always valid
+func IsRulesVariantValid(league League, variant string) bool {
+	if variant == "" {
+		return true
+	}
+
+	for _, v := range GetRulesVariants(league) {
+		if v == variant {
+			return true
+		}
+	}
+
+	return false
 }
 
 func NewServerConfig() *ServerConfig {
@@ -102,8 +160,15 @@ func (c *ServerConfig) Get() (string, error) {
 		}
 	}
 
+	// the manifest and its files from the same load, the configs can be reloaded meanwhile
+	cache := getConfigCache()
+	format := cache.formatManifest(c.League, c.Type)
+	if format == nil {
+		return "", errors.New("[Configs.Get]: The type you specified doesn't exists!")
+	}
+
 	// get config's name
-	cfgName, nameErr := c.GetName()
+	cfgName, nameErr := c.getName(format)
 
 	helpers.Logger.Debug("[Configs.Get]: Config that will be used: " + cfgName)
 
@@ -111,78 +176,36 @@ func (c *ServerConfig) Get() (string, error) {
 		return "", nameErr
 	}
 
-	// gets the base config for each league
-	// "the config that needs to run before the map type config"
-	var preConfigName string
-	var etf2lPreConfig []byte
-	var etf2lPreErr error
-
-	// etf2l
-	if c.League == LeagueEtf2l {
-		preConfigName = Etf2lInitConfig
+	files := append(append([]string(nil), format.Layers...), cfgName)
 
-		var etf2lPreConfigName string
-		if c.Type == LobbyTypeSixes {
-			etf2lPreConfigName = Etf2lBaseSixesConfig
-
-		} else if c.Type == LobbyTypeHighlander {
-			etf2lPreConfigName = Etf2lBaseHighlanderConfig
-		}
-
-		// etf2l pre configs's pre config lol
-		etf2lPreConfig, etf2lPreErr = ioutil.ReadFile(filepath.Clean(config.Constants.StaticFileLocation +
-			ConfigsPath + etf2lPreConfigName))
-
-		if etf2lPreErr == nil {
-			helpers.Logger.Debug("[Configs.Init] Etf2l's server pre-configs loaded!")
-		} else {
-			return "", etf2lPreErr
+	var cfg string
+	for _, name := range files {
+		data, ok := cache.files[name]
+		if !ok {
+			return "", errors.New("[Configs.Get]: " + name + " isn't loaded")
 		}
 
-		// ugc
-	} else if c.League == LeagueUgc {
-		if c.Type == LobbyTypeSixes {
-			preConfigName = UgcBaseSixesConfig
-
-		} else if c.Type == LobbyTypeHighlander {
-			preConfigName = UgcBaseHighlanderConfig
-		}
+		cfg += data
 	}
+	helpers.Logger.Debug("[Configs.Get] Server configs loaded!")
 
-	// pre config
-	preConfig, preErr := ioutil.ReadFile(filepath.Clean(config.Constants.StaticFileLocation +
-		ConfigsPath + preConfigName))
+	cfg += GetFormat(c.Type).ClassLimitCommands()
 
-	if preErr == nil {
-		helpers.Logger.Debug("[Configs.Init] Server pre-configs loaded!")
-	} else {
-		return "", preErr
+	// sorted, so the config is the same every time
+	var cvars []string
+	for cvar := range format.Cvars {
+		cvars = append(cvars, cvar)
 	}
+	sort.Strings(cvars)
 
-	// get config file's data
-	cfgData, cfgErr := ioutil.ReadFile(filepath.Clean(config.Constants.StaticFileLocation +
-		ConfigsPath + "/" +
-		c.League.String() + "/" +
-		cfgName))
-
-	if cfgErr == nil {
-		helpers.Logger.Debug("[Configs.Init] Server configs loaded!")
-	} else {
-		return "", cfgErr
-	}
-
-	var cfg string
-
-	// insert etf2l pre config into server pre config
-	if c.League == LeagueEtf2l {
-		cfg = string(etf2lPreConfig[:]) + string(preConfig[:]) + string(cfgData[:])
-	} else {
-		cfg = string(preConfig[:]) + string(cfgData[:])
+	for _, cvar := range cvars {
+		cfg += fmt.Sprintf("\n%s \"%s\"", cvar, format.Cvars[cvar])
 	}
 
 	return cfg, nil
 }
 
+// GetName returns the path of the game mode's config, in the rules variant if there's one
 func (c *ServerConfig) GetName() (string, error) {
 	if !c.IsLeagueValid() {
 		return "", errors.New("[Configs.GetName]: Invalid league!")
@@ -192,24 +215,22 @@ func (c *ServerConfig) GetName() (string, error) {
 		return "", errors.New("[Configs.GetName]: Invalid LobbyType!")
 	}
 
-	// game type as string
-	var t string
-
-	if c.League == LeagueEtf2l {
-		t = LobbyTypeToString(c.Type)
+	return c.getName(GetFormatManifest(c.League, c.Type))
+}
 
-	} else if c.League == LeagueUgc {
-		switch {
-		case c.Type == LobbyTypeSixes:
-			t = "6v"
-		case c.Type == LobbyTypeHighlander:
-			t = "HL"
+func (c *ServerConfig) getName(format *FormatManifest) (string, error) {
+	// not every mode has the variant, like stopwatch overtime
+	if c.RulesVariant != "" {
+		if cfgName, ok := format.Variants[c.RulesVariant][c.Name]; ok {
+			return cfgName, nil
 		}
+		helpers.Logger.Debug("[Configs.GetName]: No " + c.RulesVariant + " variant of " + c.Name + ", using the normal rules")
 	}
 
-	// build config name
-	// ugc -> 6v6 = ugc_6v_koth.cfg
-	cfgName := c.League.String() + "_" + t + "_" + c.Name + ".cfg"
+	cfgName, ok := format.Modes[c.Name]
+	if !ok {
+		return "", errors.New("[Configs.GetName]: The league doesn't have a config for " + c.Name + "!")
+	}
 
 	return cfgName, nil
 }
@@ -219,8 +240,8 @@ func (c *ServerConfig) GetMapConfig(mapName string) (string, error) {
 
 	var mapConfig string
 
-	if MapsData[mapName] != nil {
-		mapConfig = MapsData[mapName][LobbyTypeToString(c.Type)][c.League]
+	if modes, format := GetMapModes(mapName), GetFormat(c.Type); modes != nil && format != nil {
+		mapConfig = modes[format.MapsKey()][c.League]
 	} else {
 		return "", errors.New("[Configs.GetMapConfig]: No config can be found for this map in this game type and league!")
 	}
@@ -229,30 +250,9 @@ func (c *ServerConfig) GetMapConfig(mapName string) (string, error) {
 }
 
 func (c *ServerConfig) IsLobbyTypeValid() bool {
-	if c.Type == LobbyTypeSixes || c.Type == LobbyTypeHighlander {
-		return true
-	}
-
-	return false
+	return GetFormatManifest(c.League, c.Type) != nil
 }
 
 func (c *ServerConfig) IsLeagueValid() bool {
-	for i := range Leagues {
-		if c.League == Leagues[i] {
-			return true
-		}
-	}
-
-	return false
-}
-
-func LobbyTypeToString(t LobbyType) string {
-	switch {
-	case t == LobbyTypeSixes:
-		return "6v6"
-	case t == LobbyTypeHighlander:
-		return "9v9"
-	}
-
-	return ""
+	return IsLeagueValid(c.League)
 }
@@ -1,7 +1,11 @@
 package models
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/TF2Stadium/Helen/config"
 	"github.com/TF2Stadium/Helen/helpers"
@@ -14,7 +18,8 @@ func init() {
 
 func TestInitConfigs(t *testing.T) {
 	config.SetupConstants()
-	InitServerConfigs()
+	assert.Nil(t, InitServerConfigs())
+	assert.Equal(t, []League{LeagueEtf2l, LeagueUgc}, GetLeagues())
 }
 
 func TestUgcHighlander(t *testing.T) {
@@ -60,3 +65,255 @@ func TestEtf2lHighlander(t *testing.T) {
 	assert.Nil(t, cfgErr, "cfg error")
 	assert.NotEmpty(t, cfg, "cfg shouldn't be empty")
 }
+
+func TestUgcOvertime(t *testing.T) {
+	config := NewServerConfig()
+	config.League = LeagueUgc
+	config.Type = LobbyTypeSixes
+	config.Map = "cp_badlands"
+	config.RulesVariant = "overtime"
+	cfg, cfgErr := config.Get()
+
+	assert.Nil(t, cfgErr, "cfg error")
+	assert.Contains(t, cfg, "ugc_6v_standard_overtime.cfg")
+}
+
+func TestRulesVariantFallback(t *testing.T) {
+	// there's no stopwatch overtime config
+	config := NewServerConfig()
+	config.League = LeagueUgc
+	config.Type = LobbyTypeHighlander
+	config.Map = "pl_upward"
+	config.RulesVariant = "overtime"
+	cfg, cfgErr := config.Get()
+
+	assert.Nil(t, cfgErr, "cfg error")
+	assert.NotEmpty(t, cfg, "cfg shouldn't be empty")
+}
+
+func TestRulesVariantValid(t *testing.T) {
+	assert.True(t, IsLeagueValid(LeagueUgc))
+	assert.False(t, IsLeagueValid(League("esea")))
+
+	assert.True(t, IsRulesVariantValid(LeagueUgc, ""))
+	assert.True(t, IsRulesVariantValid(LeagueUgc, "overtime"))
+	assert.True(t, IsRulesVariantValid(LeagueEtf2l, ""))
+	assert.False(t, IsRulesVariantValid(LeagueEtf2l, "overtime"))
+}
+
+func TestManifestLeague(t *testing.T) {
+	// a league that's only in the manifest
+	config.SetupConstants()
+	config.Constants.StaticFileLocation = "testdata/static"
+	defer func() {
+		config.SetupConstants()
+		InitServerConfigs()
+	}()
+
+	assert.Nil(t, InitServerConfigs())
+	assert.Equal(t, []League{"ozf"}, GetLeagues())
+	assert.True(t, IsLeagueValid(League("ozf")))
+	assert.False(t, IsLeagueValid(LeagueEtf2l))
+
+	c := NewServerConfig()
+	c.League = League("ozf")
+	c.Type = LobbyTypeSixes
+	c.Map = "cp_process_final"
+	cfg, err := c.Get()
+
+	assert.Nil(t, err)
+	assert.Equal(t, "exec ozfortress\nexec ozfortress_5cp\n"+
+		"\nmp_timelimit \"30\"\nmp_tournament_stopwatch \"0\"", cfg)
+
+	// the format's whitelist isn't in the cfg, Server.LoadWhitelist uploads it
+	assert.Equal(t, "whitelist\n", WhitelistData(0, League("ozf"), LobbyTypeSixes))
+
+	c = NewServerConfig()
+	c.League = League("ozf")
+	c.Type = LobbyTypeHighlander
+	c.Map = "cp_process_final"
+	_, err = c.Get()
+	assert.NotNil(t, err)
+}
+
+func TestManifestMissingFile(t *testing.T) {
+	config.SetupConstants()
+	defer InitServerConfigs()
+
+	manifest := map[League]*LeagueManifest{
+		LeagueEtf2l: {
+			Formats: map[string]*FormatManifest{
+				"6v6": {
+					Layers: []string{"etf2l/etf2l.cfg"},
+					Modes:  map[string]string{"5cp": "etf2l/etf2l_6v6_missing.cfg"},
+				},
+			},
+		},
+	}
+
+	err := ValidateConfigManifest(manifest, nil)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "etf2l/etf2l_6v6_missing.cfg")
+
+	manifest[LeagueEtf2l].Formats["6v6"].Modes["5cp"] = "etf2l/etf2l_6v6_5cp.cfg"
+	assert.Nil(t, ValidateConfigManifest(manifest, nil))
+}
+
+func TestFormatConfigs(t *testing.T) {
+	config.SetupConstants()
+	InitServerConfigs()
+
+	c := NewServerConfig()
+	c.League = LeagueEtf2l
+	c.Type = LobbyTypeUltiduo
+	c.Map = "koth_ultiduo_r_b7"
+	cfg, err := c.Get()
+	assert.Nil(t, err)
+	assert.Contains(t, cfg, "etf2l_whitelist_ultiduo.txt")
+
+	c = NewServerConfig()
+	c.League = LeagueEtf2l
+	c.Type = LobbyTypeBball
+	c.Map = "ctf_ballin_sky"
+	cfg, err = c.Get()
+	assert.Nil(t, err)
+	assert.Contains(t, cfg, "etf2l_whitelist_bball.txt")
+
+	// fours and prolander use the sixes and highlander maps, with class limits
+	c = NewServerConfig()
+	c.League = LeagueUgc
+	c.Type = LobbyTypeFours
+	c.Map = "cp_badlands"
+	cfg, err = c.Get()
+	assert.Nil(t, err)
+	assert.Contains(t, cfg, "\ntf_tournament_classlimit_scout 1")
+
+	c = NewServerConfig()
+	c.League = LeagueEtf2l
+	c.Type = LobbyTypeProlander
+	c.Map = "pl_badwater"
+	cfg, err = c.Get()
+	assert.Nil(t, err)
+	assert.Contains(t, cfg, "\ntf_tournament_classlimit_spy 1")
+
+	// no ugc ultiduo configs
+	c = NewServerConfig()
+	c.League = LeagueUgc
+	c.Type = LobbyTypeUltiduo
+	c.Map = "koth_ultiduo_r_b7"
+	_, err = c.Get()
+	assert.NotNil(t, err)
+}
+
+func TestFormats(t *testing.T) {
+	for _, format := range GetFormats() {
+		assert.True(t, format.TeamSize <= len(format.Slots), format.Name)
+
+		f, ok := GetFormatByKey(format.Key)
+		assert.True(t, ok)
+		assert.Equal(t, format, f)
+	}
+
+	prolander := GetFormat(LobbyTypeProlander)
+	assert.Equal(t, 14, prolander.PlayerCount())
+	assert.Equal(t, 18, prolander.SlotCount())
+	assert.Equal(t, "9v9", prolander.MapsKey())
+
+	assert.Equal(t, "Sixes", FormatName(LobbyTypeSixes))
+	assert.Nil(t, GetFormat(LobbyType(42)))
+}
+
+// copies testdata/static/configs to a temporary static directory
+func tempConfigs(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "configs")
+	assert.Nil(t, err)
+
+	for _, name := range []string{"leagues.json", "maps.json", "ozf/ozfortress.cfg", "ozf/ozfortress_5cp.cfg", "ozf/ozfortress_whitelist.txt"} {
+		data, err := ioutil.ReadFile("testdata/static/configs/" + name)
+		assert.Nil(t, err)
+
+		path := filepath.Join(dir, "configs", name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		assert.Nil(t, ioutil.WriteFile(path, data, 0644))
+	}
+
+	return dir
+}
+
+func TestConfigsReload(t *testing.T) {
+	dir := tempConfigs(t)
+	defer os.RemoveAll(dir)
+
+	config.SetupConstants()
+	config.Constants.StaticFileLocation = dir
+	defer func() {
+		config.SetupConstants()
+		InitServerConfigs()
+	}()
+	assert.Nil(t, InitServerConfigs())
+
+	c := &ServerConfig{League: "ozf", Type: LobbyTypeSixes, Map: "cp_process_final"}
+	cfg, err := c.Get()
+	assert.Nil(t, err)
+	assert.Contains(t, cfg, "exec ozfortress_5cp\n")
+
+	// the configs are in memory
+	cfgPath := filepath.Join(dir, "configs", "ozf", "ozfortress_5cp.cfg")
+	assert.Nil(t, ioutil.WriteFile(cfgPath, []byte("exec ozfortress_5cp_new\n"), 0644))
+	cfg, _ = c.Get()
+	assert.Contains(t, cfg, "exec ozfortress_5cp\n")
+
+	assert.Nil(t, ReloadServerConfigs())
+	cfg, _ = c.Get()
+	assert.Contains(t, cfg, "exec ozfortress_5cp_new\n")
+
+	// a broken manifest keeps the configs that were loaded
+	manifestPath := filepath.Join(dir, "configs", "leagues.json")
+	assert.Nil(t, ioutil.WriteFile(manifestPath, []byte(`{"ozf": {`), 0644))
+	assert.NotNil(t, ReloadServerConfigs())
+	assert.True(t, IsLeagueValid("ozf"))
+
+	// and so does a missing file
+	assert.Nil(t, os.Remove(cfgPath))
+	assert.NotNil(t, ReloadServerConfigs())
+	cfg, err = c.Get()
+	assert.Nil(t, err)
+	assert.Contains(t, cfg, "exec ozfortress_5cp_new\n")
+}
+
+func TestConfigsWatch(t *testing.T) {
+	dir := tempConfigs(t)
+	defer os.RemoveAll(dir)
+
+	config.SetupConstants()
+	config.Constants.StaticFileLocation = dir
+	defer func() {
+		config.SetupConstants()
+		InitServerConfigs()
+	}()
+	assert.Nil(t, InitServerConfigs())
+
+	checkServerConfigs()
+	loaded := getConfigCache()
+	checkServerConfigs()
+	assert.True(t, loaded == getConfigCache(), "nothing changed")
+
+	mapsPath := filepath.Join(dir, "configs", "maps.json")
+	assert.Nil(t, ioutil.WriteFile(mapsPath, []byte(`{"koth_product_rc8": {"6v6": {"ozf": "5cp"}}}`), 0644))
+	future := time.Now().Add(time.Minute)
+	os.Chtimes(mapsPath, future, future)
+
+	checkServerConfigs()
+	assert.NotNil(t, GetMapModes("koth_product_rc8"))
+	assert.Nil(t, GetMapModes("cp_process_final"))
+
+	// broken files are only tried once
+	assert.Nil(t, ioutil.WriteFile(mapsPath, []byte(`{`), 0644))
+	future = future.Add(time.Minute)
+	os.Chtimes(mapsPath, future, future)
+
+	checkServerConfigs()
+	broken := getConfigCache()
+	assert.NotNil(t, GetMapModes("koth_product_rc8"))
+	assert.False(t, broken.isChanged())
+}
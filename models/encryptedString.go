@@ -0,0 +1,173 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/TF2Stadium/Helen/config"
+	db "github.com/TF2Stadium/Helen/database"
+	"github.com/TF2Stadium/Helen/helpers"
+)
+
+// EncryptedString is stored encrypted with AES-GCM, using the key from
+// config.Constants.EncryptionKey. Values look like this in the database:
+// aes:<key id>:<base64 of nonce + ciphertext>
+//
+// The plaintext is only available through string(s), printing or
+// marshalling an EncryptedString never shows it.
+type EncryptedString string
+
+const (
+	encryptedPrefix = "aes:"
+	hiddenString    = "********"
+)
+
+var ErrUnknownEncryptionKey = errors.New("[EncryptedString]: Value was encrypted with an unknown key")
+
+type encryptionKey struct {
+	id  string
+	key []byte
+}
+
+func newEncryptionKey(passphrase string) encryptionKey {
+	key := sha256.Sum256([]byte(passphrase))
+	id := sha256.Sum256(key[:])
+
+	return encryptionKey{id: hex.EncodeToString(id[:4]), key: key[:]}
+}
+
+func currentEncryptionKey() encryptionKey {
+	return newEncryptionKey(config.Constants.EncryptionKey)
+}
+
+// the current key and the ones it replaced
+func encryptionKeys() []encryptionKey {
+	keys := []encryptionKey{currentEncryptionKey()}
+	for _, passphrase := range config.Constants.OldEncryptionKeys {
+		keys = append(keys, newEncryptionKey(passphrase))
+	}
+
+	return keys
+}
+
+func (s EncryptedString) Value() (driver.Value, error) {
+	key := currentEncryptionKey()
+
+	data, err := helpers.Encrypt(key.key, []byte(s))
+	if err != nil {
+		return nil, err
+	}
+
+	return encryptedPrefix + key.id + ":" + base64.StdEncoding.EncodeToString(data), nil
+}
+
+func (s *EncryptedString) Scan(src interface{}) error {
+	var value string
+
+	switch v := src.(type) {
+	case nil:
+		*s = ""
+		return nil
+	case string:
+		value = v
+	case []byte:
+		value = string(v)
+	default:
+		return fmt.Errorf("[EncryptedString]: Can't scan %T", src)
+	}
+
+	// written before the passwords were encrypted
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		*s = EncryptedString(value)
+		return nil
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(value, encryptedPrefix), ":", 2)
+	if len(parts) != 2 {
+		return ErrUnknownEncryptionKey
+	}
+
+	data, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return err
+	}
+
+	for _, key := range encryptionKeys() {
+		if key.id != parts[0] {
+			continue
+		}
+
+		plaintext, err := helpers.Decrypt(key.key, data)
+		if err != nil {
+			return err
+		}
+
+		*s = EncryptedString(plaintext)
+		return nil
+	}
+
+	return ErrUnknownEncryptionKey
+}
+
+func (s EncryptedString) String() string {
+	return hiddenString
+}
+
+func (s EncryptedString) GoString() string {
+	return hiddenString
+}
+
+func (s EncryptedString) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + hiddenString + `"`), nil
+}
+
+// ReencryptServerRecords encrypts the rcon and lobby server passwords that are stored in cleartext
+// or with an old key using the current key. Run it after changing the key,
+// with the old key in config.Constants.OldEncryptionKeys
+func ReencryptServerRecords() error {
+	prefix := encryptedPrefix + currentEncryptionKey().id + ":"
+
+	var records []ServerRecord
+	err := db.DB.Where("rcon_password NOT LIKE ?", prefix+"%").Find(&records).Error
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		err := db.DB.Model(&ServerRecord{}).Where("id = ?", record.ID).
+			UpdateColumn("rcon_password", record.RconPassword).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(records) != 0 {
+		helpers.Logger.Debug("[EncryptedString]: Reencrypted %d rcon passwords", len(records))
+	}
+
+	// the game server passwords of the lobbies
+	var lobbies []struct {
+		ID             uint
+		ServerPassword EncryptedString
+	}
+	err = db.DB.Table("lobbies").Select("id, server_password").
+		Where("server_password <> '' AND server_password NOT LIKE ?", prefix+"%").Scan(&lobbies).Error
+	if err != nil {
+		return err
+	}
+
+	for _, lobby := range lobbies {
+		err := db.DB.Table("lobbies").Where("id = ?", lobby.ID).
+			UpdateColumn("server_password", lobby.ServerPassword).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/TF2Stadium/Helen/config"
+	"github.com/TF2Stadium/Helen/helpers"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	helpers.InitLogger()
+}
+
+func TestEncryptedString(t *testing.T) {
+	config.SetupConstants()
+
+	value, err := EncryptedString("rcon password").Value()
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(value.(string), "aes:"))
+	assert.NotContains(t, value.(string), "rcon password")
+
+	var s EncryptedString
+	assert.Nil(t, s.Scan(value))
+	assert.Equal(t, "rcon password", string(s))
+
+	assert.Nil(t, s.Scan([]byte(value.(string))))
+	assert.Equal(t, "rcon password", string(s))
+
+	// stored before encryption was added
+	assert.Nil(t, s.Scan("cleartext"))
+	assert.Equal(t, "cleartext", string(s))
+}
+
+func TestEncryptedStringHidden(t *testing.T) {
+	record := ServerRecord{Host: "localhost", RconPassword: "rcon password"}
+
+	assert.NotContains(t, fmt.Sprintf("%v %+v %#v %s", record, record, record, record.RconPassword), "rcon password")
+
+	bytes, err := json.Marshal(record)
+	assert.Nil(t, err)
+	assert.NotContains(t, string(bytes), "rcon password")
+}
+
+func TestEncryptedStringKeyRotation(t *testing.T) {
+	config.SetupConstants()
+	config.Constants.EncryptionKey = "old key"
+	value, _ := EncryptedString("rcon password").Value()
+
+	config.Constants.EncryptionKey = "new key"
+	var s EncryptedString
+	assert.Equal(t, ErrUnknownEncryptionKey, s.Scan(value))
+
+	config.Constants.OldEncryptionKeys = []string{"old key"}
+	assert.Nil(t, s.Scan(value))
+	assert.Equal(t, "rcon password", string(s))
+}
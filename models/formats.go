@@ -0,0 +1,183 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+)
+
+const (
+	LobbyTypeSixes      LobbyType = 0
+	LobbyTypeHighlander LobbyType = 1
+	LobbyTypeFours      LobbyType = 2
+	LobbyTypeUltiduo    LobbyType = 3
+	LobbyTypeBball      LobbyType = 4
+	LobbyTypeProlander  LobbyType = 5
+)
+
+// a class slot in a team, players join a lobby by picking one
+type FormatSlot struct {
+	Name  string // used by lobbyJoin, example: pocket
+	Class string // the TF2 class, example: soldier
+}
+
+type Format struct {
+	Type LobbyType
+	Key  string // used by lobbyCreate, example: sixes
+	Name string // shown to players, example: Sixes
+
+	Config     string // the format in leagues.json and maps.json, example: 6v6
+	MapsConfig string // set if the format uses the maps of another format
+
+	TeamSize int          // players per team
+	Slots    []FormatSlot // in slot order. Can be more than TeamSize, the players pick their classes
+
+	// tf_tournament_classlimit_<class> on the game server, when the format
+	// isn't a league's own and the league configs don't limit the classes
+	ClassLimits map[string]int
+}
+
+var (
+	tf2Classes = []string{"scout", "soldier", "pyro", "demoman", "heavy", "engineer", "medic", "sniper", "spy"}
+
+	// one of each class
+	singleClassLimits = map[string]int{
+		"scout": 1, "soldier": 1, "pyro": 1, "demoman": 1, "heavy": 1,
+		"engineer": 1, "medic": 1, "sniper": 1, "spy": 1,
+	}
+)
+
+func classSlots(classes ...string) []FormatSlot {
+	slots := make([]FormatSlot, len(classes))
+	for i, class := range classes {
+		slots[i] = FormatSlot{Name: class, Class: class}
+	}
+	return slots
+}
+
+var formats = map[LobbyType]*Format{
+	LobbyTypeSixes: {
+		Type: LobbyTypeSixes, Key: "sixes", Name: "Sixes", Config: "6v6",
+		TeamSize: 6,
+		Slots: []FormatSlot{
+			{"scout1", "scout"}, {"scout2", "scout"}, {"roamer", "soldier"},
+			{"pocket", "soldier"}, {"demoman", "demoman"}, {"medic", "medic"},
+		},
+	},
+	LobbyTypeHighlander: {
+		Type: LobbyTypeHighlander, Key: "highlander", Name: "Highlander", Config: "9v9",
+		TeamSize: 9,
+		Slots:    classSlots(tf2Classes...),
+	},
+	LobbyTypeFours: {
+		Type: LobbyTypeFours, Key: "fours", Name: "Fours", Config: "4v4", MapsConfig: "6v6",
+		TeamSize:    4,
+		Slots:       classSlots("scout", "soldier", "demoman", "medic"),
+		ClassLimits: singleClassLimits,
+	},
+	LobbyTypeUltiduo: {
+		Type: LobbyTypeUltiduo, Key: "ultiduo", Name: "Ultiduo", Config: "ultiduo",
+		TeamSize: 2,
+		Slots:    classSlots("soldier", "medic"),
+	},
+	LobbyTypeBball: {
+		Type: LobbyTypeBball, Key: "bball", Name: "BBall", Config: "bball",
+		TeamSize: 2,
+		Slots:    []FormatSlot{{"soldier1", "soldier"}, {"soldier2", "soldier"}},
+	},
+	LobbyTypeProlander: {
+		Type: LobbyTypeProlander, Key: "prolander", Name: "Prolander", Config: "7v7", MapsConfig: "9v9",
+		TeamSize:    7,
+		Slots:       classSlots(tf2Classes...),
+		ClassLimits: singleClassLimits,
+	},
+}
+
+// GetFormat returns the format's definition, nil if the lobby type doesn't exist
+func GetFormat(lobbyType LobbyType) *Format {
+	return formats[lobbyType]
+}
+
+// GetFormatByKey returns the format lobbyCreate calls key
+func GetFormatByKey(key string) (*Format, bool) {
+	for _, format := range formats {
+		if format.Key == key {
+			return format, true
+		}
+	}
+
+	return nil, false
+}
+
+// GetFormats returns every format, in LobbyType order
+func GetFormats() []*Format {
+	var types []int
+	for lobbyType := range formats {
+		types = append(types, int(lobbyType))
+	}
+	sort.Ints(types)
+
+	var list []*Format
+	for _, lobbyType := range types {
+		list = append(list, formats[LobbyType(lobbyType)])
+	}
+
+	return list
+}
+
+// FormatName returns the name shown to players
+func FormatName(lobbyType LobbyType) string {
+	if format := GetFormat(lobbyType); format != nil {
+		return format.Name
+	}
+
+	return ""
+}
+
+// number of slots in a lobby, both teams
+func (f *Format) SlotCount() int {
+	return 2 * len(f.Slots)
+}
+
+// number of players in a full lobby, both teams
+func (f *Format) PlayerCount() int {
+	return 2 * f.TeamSize
+}
+
+// SlotIndex returns the slot's position in a team, -1 if the format doesn't have it
+func (f *Format) SlotIndex(name string) int {
+	for i, slot := range f.Slots {
+		if slot.Name == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// the team (0 for red, 1 for blu) and the class slot of a lobby slot
+func (f *Format) SlotTeam(slot int) (int, *FormatSlot) {
+	return slot / len(f.Slots), &f.Slots[slot%len(f.Slots)]
+}
+
+func (f *Format) MapsKey() string {
+	if f.MapsConfig != "" {
+		return f.MapsConfig
+	}
+	return f.Config
+}
+
+// the class limit commands, sorted by class
+func (f *Format) ClassLimitCommands() string {
+	var classes []string
+	for class := range f.ClassLimits {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+
+	var cmds string
+	for _, class := range classes {
+		cmds += fmt.Sprintf("\ntf_tournament_classlimit_%s %d", class, f.ClassLimits[class])
+	}
+
+	return cmds
+}
@@ -0,0 +1,49 @@
+package models
+
+import (
+	"time"
+
+	db "github.com/TF2Stadium/Helen/database"
+)
+
+// a lease makes one Helen instance the leader for something until it expires,
+// the leader renews it to stay the leader
+type Lease struct {
+	Name      string `sql:"not null" gorm:"primary_key"`
+	Owner     string `sql:"not null"` // config.Constants.InstanceId
+	ExpiresAt time.Time
+}
+
+// AcquireLease makes owner the leader for ttl if nobody else is, or renews its lease.
+// Returns true if owner is the leader
+func AcquireLease(name string, owner string, ttl time.Duration) bool {
+	now := time.Now()
+
+	query := db.DB.Model(&Lease{}).Where("name = ? AND (owner = ? OR expires_at < ?)", name, owner, now).
+		UpdateColumns(map[string]interface{}{
+			"owner":      owner,
+			"expires_at": now.Add(ttl),
+		})
+	if query.Error == nil && query.RowsAffected == 1 {
+		return true
+	}
+
+	// fails if someone else has it, name is the primary key
+	err := db.DB.Create(&Lease{Name: name, Owner: owner, ExpiresAt: now.Add(ttl)}).Error
+	return err == nil
+}
+
+// ReleaseLease lets another instance become the leader right away
+func ReleaseLease(name string, owner string) {
+	db.DB.Where("name = ? AND owner = ?", name, owner).Delete(&Lease{})
+}
+
+// GetLeaseOwner returns the current leader, or "" if there isn't one
+func GetLeaseOwner(name string) string {
+	lease := &Lease{}
+	err := db.DB.Where("name = ? AND expires_at >= ?", name, time.Now()).First(lease).Error
+	if err != nil {
+		return ""
+	}
+	return lease.Owner
+}
@@ -0,0 +1,37 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/TF2Stadium/Helen/database/migrations"
+	"github.com/TF2Stadium/Helen/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLease(t *testing.T) {
+	migrations.TestCleanup()
+
+	assert.Equal(t, "", models.GetLeaseOwner("verifier"))
+
+	assert.True(t, models.AcquireLease("verifier", "a", time.Minute))
+	assert.False(t, models.AcquireLease("verifier", "b", time.Minute))
+	assert.Equal(t, "a", models.GetLeaseOwner("verifier"))
+
+	// renewing
+	assert.True(t, models.AcquireLease("verifier", "a", -time.Second))
+
+	// expired, someone else can have it
+	assert.Equal(t, "", models.GetLeaseOwner("verifier"))
+	assert.True(t, models.AcquireLease("verifier", "b", time.Minute))
+	assert.False(t, models.AcquireLease("verifier", "a", time.Minute))
+
+	// only the owner can release it
+	models.ReleaseLease("verifier", "a")
+	assert.Equal(t, "b", models.GetLeaseOwner("verifier"))
+	models.ReleaseLease("verifier", "b")
+	assert.True(t, models.AcquireLease("verifier", "a", time.Minute))
+
+	// other leases aren't affected
+	assert.True(t, models.AcquireLease("other", "b", time.Minute))
+}
@@ -4,8 +4,10 @@ import (
 	"crypto/rand"
 	"encoding/base64"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/TF2Stadium/Helen/config"
 	db "github.com/TF2Stadium/Helen/database"
 	"github.com/TF2Stadium/Helen/helpers"
 	"github.com/jinzhu/gorm"
@@ -15,32 +17,26 @@ type LobbyType int
 type Whitelist int
 type LobbyState int
 
-const (
-	LobbyTypeSixes      LobbyType = 0
-	LobbyTypeHighlander LobbyType = 1
-)
-
-var TypePlayerCount = map[LobbyType]int{
-	LobbyTypeSixes:      6,
-	LobbyTypeHighlander: 9,
-}
+// the lobby types are in formats.go
 
 const (
 	LobbyStateInitializing LobbyState = 0
 	LobbyStateWaiting      LobbyState = 1
 	LobbyStateInProgress   LobbyState = 2
 	LobbyStateEnded        LobbyState = 3
+	LobbyStateReadyingUp   LobbyState = 4
+	LobbyStateCancelled    LobbyState = 5
+	LobbyStateFailed       LobbyState = 6
 )
 
 var stateString = map[LobbyState]string{
-	LobbyStateWaiting:    "Waiting For Players",
-	LobbyStateInProgress: "Lobby in Progress",
-	LobbyStateEnded:      "Lobby Ended",
-}
-
-var FormatMap = map[LobbyType]string{
-	LobbyTypeSixes:      "Sixes",
-	LobbyTypeHighlander: "Highlander",
+	LobbyStateInitializing: "Setting Up",
+	LobbyStateWaiting:      "Waiting For Players",
+	LobbyStateReadyingUp:   "Readying Up",
+	LobbyStateInProgress:   "Lobby in Progress",
+	LobbyStateEnded:        "Lobby Ended",
+	LobbyStateCancelled:    "Lobby Cancelled",
+	LobbyStateFailed:       "Lobby Failed",
 }
 
 type LobbySlot struct {
@@ -60,14 +56,34 @@ type Lobby struct {
 	State   LobbyState
 	Type    LobbyType
 
+	League       League
+	RulesVariant string // see GetRulesVariants
+
 	Slots []LobbySlot
 
 	Server       *Server `sql:"-"` // server
 	ServerInfo   ServerRecord
 	ServerInfoID uint
 
+	// the server's state, kept so the server can be taken over after a restart
+	ServerPassword       EncryptedString
+	ServerLogSecret      string
+	ServerSetUp          bool   // TrySettingUp succeeded
+	ServerAllowedPlayers string `sql:"size:2048"` // comma separated steam ids
+
+	// the server was taken over during the match, the logs from before that are lost
+	LogsPartial bool
+
 	Whitelist Whitelist //whitelist.tf ID
 
+	MumbleRequired  bool // players have to be in the lobby's mumble channel to be ready
+	MumbleChannelId int
+
+	LogsId int // logs.tf ID, set after the lobby ends
+
+	ReadyUpDeadline time.Time // players that aren't ready by then are removed, zero if not readying up
+	StartedAt       time.Time // when everyone was ready
+
 	Spectators []Player `gorm:"many2many:spectators_players_lobbies"`
 
 	BannedPlayers []Player `gorm:"many2many:banned_players_lobbies"`
@@ -80,13 +96,17 @@ func NewLobby(mapName string, lobbyType LobbyType, serverInfo ServerRecord, whit
 	lobby := &Lobby{
 		Type:       lobbyType,
 		State:      LobbyStateInitializing,
+		League:     LeagueEtf2l,
 		MapName:    mapName,
 		Server:     nil,
 		Whitelist:  Whitelist(whitelist), // that's a strange line
 		ServerInfo: serverInfo,
+
+		ServerPassword: EncryptedString(newServerPassword()),
 	}
 
 	// Must specify CreatedBy manually if the lobby is created by a player
+	// League and RulesVariant default to ETF2L's rules
 
 	return lobby
 }
@@ -114,6 +134,10 @@ func (lobby *Lobby) Save() error {
 	} else {
 		err = db.DB.Save(lobby).Error
 	}
+
+	if err == nil {
+		lobbyChanged(lobby.ID)
+	}
 	return err
 }
 
@@ -130,23 +154,63 @@ func GetLobbyById(id uint) (*Lobby, *helpers.TPError) {
 	return lob, nil
 }
 
-// //Add player to lobby
-func (lobby *Lobby) AddPlayer(player *Player, slot int) *helpers.TPError {
-	/* Possible errors while joining
-	 * Slot has been filled
-	 * Player has already joined a lobby
-	 * anything else?
-	 */
+// lockLobby locks the lobby's row until the transaction ends, the other transactions
+// changing the lobby wait for it (SELECT ... FOR UPDATE). Returns the lobby's current state
+func lockLobby(tx *gorm.DB, lobbyId uint) (LobbyState, error) {
+	var state LobbyState
+	err := tx.Raw("SELECT state FROM lobbies WHERE id = ? FOR UPDATE", lobbyId).Row().Scan(&state)
+	return state, err
+}
+
+// transaction runs fn in a transaction holding the lobby's lock, see lockLobby.
+// The transaction is rolled back if fn returns an error
+func (lobby *Lobby) transaction(fn func(tx *gorm.DB) *helpers.TPError) *helpers.TPError {
+	tx := db.DB.Begin()
+	if tx.Error != nil {
+		return helpers.NewTPError(tx.Error.Error(), -1)
+	}
+
+	committed := false
+	defer func() {
+		if !committed {
+			tx.Rollback()
+		}
+	}()
+
+	state, err := lockLobby(tx, lobby.ID)
+	if err != nil {
+		return helpers.NewTPError("Lobby not in the database", -1)
+	}
+	lobby.State = state
+
+	if tperr := fn(tx); tperr != nil {
+		return tperr
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return helpers.NewTPError(err.Error(), -1)
+	}
+	committed = true
+	return nil
+}
 
+// canJoin returns why the player can't join the lobby, nil if they can
+func (lobby *Lobby) canJoin(player *Player) *helpers.TPError {
+	cooldownError := helpers.NewTPError("Player can't join lobbies after not readying up.", 6)
 	lobbyBanError := helpers.NewTPError("The player has been banned from this lobby.", 4)
-	badSlotError := helpers.NewTPError("This slot does not exist.", 3)
-	filledError := helpers.NewTPError("This slot has been filled.", 2)
-	alreadyInLobbyError := helpers.NewTPError("Player is already in a lobby", 1)
 
 	if player.ID == 0 {
 		return helpers.NewTPError("Player not in the database", -1)
 	}
 
+	if player.HasJoinCooldown() {
+		return cooldownError
+	}
+
+	if tperr := player.BanError(PlayerBanJoin); tperr != nil {
+		return tperr
+	}
+
 	num := 0
 
 	// It should really be possible to do this query using relations
@@ -157,33 +221,94 @@ func (lobby *Lobby) AddPlayer(player *Player, slot int) *helpers.TPError {
 		return lobbyBanError
 	}
 
-	if slot >= 2*TypePlayerCount[lobby.Type] || slot < 0 {
+	return nil
+}
+
+// //Add player to lobby
+func (lobby *Lobby) AddPlayer(player *Player, slot int) *helpers.TPError {
+	if tperr := lobby.canJoin(player); tperr != nil {
+		return tperr
+	}
+
+	tperr := lobby.transaction(func(tx *gorm.DB) *helpers.TPError {
+		return lobby.addPlayer(tx, player, slot)
+	})
+	if tperr != nil {
+		return tperr
+	}
+
+	lobby.updateServerAllowedPlayers()
+	lobbyChanged(lobby.ID)
+
+	return nil
+}
+
+// addPlayer puts the player in the slot, the transaction has to hold the lobby's lock
+func (lobby *Lobby) addPlayer(tx *gorm.DB, player *Player, slot int) *helpers.TPError {
+	/* Possible errors while joining
+	 * Slot has been filled
+	 * Player has already joined a lobby
+	 * anything else?
+	 */
+
+	inProgressError := helpers.NewTPError("Lobby is in progress.", 7)
+	badSlotError := helpers.NewTPError("This slot does not exist.", 3)
+	filledError := helpers.NewTPError("This slot has been filled.", 2)
+	teamFullError := helpers.NewTPError("This team is full.", 2)
+	alreadyInLobbyError := helpers.NewTPError("Player is already in a lobby", 1)
+
+	format := GetFormat(lobby.Type)
+	if format == nil || slot >= format.SlotCount() || slot < 0 {
 		return badSlotError
 	}
 
-	slotFilled := false
-	if _, err := lobby.GetPlayerIdBySlot(slot); err == nil {
-		slotFilled = true
+	if lobby.State.IsFinished() {
+		return helpers.NewTPError("Lobby is closed.", -1)
 	}
 
-	playerSlot := &LobbySlot{}
-	err := db.DB.Where("player_id = ?", player.ID).Find(playerSlot)
+	// only slots left by players can be filled after the lobby started
+	if lobby.State == LobbyStateInProgress && !lobby.isSubstituteNeeded(tx, slot) {
+		return inProgressError
+	}
+
+	// the player could be joining another lobby at the same time
+	if err := tx.Exec("SELECT id FROM players WHERE id = ? FOR UPDATE", player.ID).Error; err != nil {
+		return helpers.NewTPError(err.Error(), -1)
+	}
 
 	// if the player is in a different lobby, return error
-	if err == nil && playerSlot.LobbyId != lobby.ID {
+	playerSlot := &LobbySlot{}
+	err := tx.Joins("INNER JOIN lobbies ON lobbies.id = lobby_slots.lobby_id").
+		Where("lobby_slots.player_id = ? AND lobby_slots.lobby_id <> ? AND lobbies.state NOT IN (?)",
+			player.ID, lobby.ID, finishedLobbyStates).
+		First(playerSlot).Error
+	if err == nil {
 		return alreadyInLobbyError
 	}
 
 	// if the slot is occupied, return error
-	if slotFilled {
+	count := 0
+	tx.Table("lobby_slots").Where("lobby_id = ? AND slot = ?", lobby.ID, slot).Count(&count)
+	if count != 0 {
 		return filledError
 	}
 
+	// formats with class picks have more slots than players
+	if format.TeamSize < len(format.Slots) && lobby.getTeamPlayerNumber(tx, slot, player) >= format.TeamSize {
+		return teamFullError
+	}
+
 	// assign the player to a new slot
-	// try to remove them from the old slot (in case they are switching slots)
-	lobby.RemovePlayer(player)
-	// try to remove them from spectators
-	lobby.RemoveSpectator(player)
+	// remove them from the old slot (in case they are switching slots)
+	err = tx.Where("player_id = ? AND lobby_id = ?", player.ID, lobby.ID).Delete(&LobbySlot{}).Error
+	if err != nil {
+		return helpers.NewTPError(err.Error(), -1)
+	}
+	// and from spectators
+	err = tx.Model(lobby).Association("Spectators").Delete(player).Error
+	if err != nil {
+		return helpers.NewTPError(err.Error(), -1)
+	}
 
 	newSlotObj := &LobbySlot{
 		PlayerId: player.ID,
@@ -191,18 +316,32 @@ func (lobby *Lobby) AddPlayer(player *Player, slot int) *helpers.TPError {
 		Slot:     slot,
 	}
 
-	db.DB.Create(newSlotObj)
-
-	lobby.updateServerAllowedPlayers()
+	// the unique index on the slot catches whatever got past the lock
+	if err := tx.Create(newSlotObj).Error; err != nil {
+		return filledError
+	}
 
 	return nil
 }
 
 func (lobby *Lobby) RemovePlayer(player *Player) *helpers.TPError {
-	err := db.DB.Where("player_id = ? AND lobby_id = ?", player.ID, lobby.ID).Delete(&LobbySlot{}).Error
-	lobby.updateServerAllowedPlayers()
-	if err != nil {
-		return helpers.NewTPError(err.Error(), -1)
+	var removed int64
+	tperr := lobby.transaction(func(tx *gorm.DB) *helpers.TPError {
+		result := tx.Where("player_id = ? AND lobby_id = ?", player.ID, lobby.ID).Delete(&LobbySlot{})
+		if result.Error != nil {
+			return helpers.NewTPError(result.Error.Error(), -1)
+		}
+
+		removed = result.RowsAffected
+		return nil
+	})
+	if tperr != nil {
+		return tperr
+	}
+
+	if removed != 0 {
+		lobby.updateServerAllowedPlayers()
+		lobbyChanged(lobby.ID)
 	}
 	return nil
 }
@@ -211,26 +350,51 @@ func (lobby *Lobby) BanPlayer(player *Player) {
 	db.DB.Model(lobby).Association("BannedPlayers").Append(player)
 }
 
-func (lobby *Lobby) ReadyPlayer(player *Player) *helpers.TPError {
-	slot := &LobbySlot{}
-	err := db.DB.Where("lobby_id = ? AND player_id = ?", lobby.ID, player.ID).First(slot).Error
-	if err != nil {
+// setPlayerReady changes the player's ready status, the transaction has to hold the lobby's lock
+func (lobby *Lobby) setPlayerReady(tx *gorm.DB, player *Player, ready bool) *helpers.TPError {
+	result := tx.Model(&LobbySlot{}).Where("lobby_id = ? AND player_id = ?", lobby.ID, player.ID).
+		UpdateColumn("ready", ready)
+	if result.Error != nil {
+		return helpers.NewTPError(result.Error.Error(), -1)
+	}
+	if result.RowsAffected == 0 {
 		return helpers.NewTPError("Player is not in the lobby.", 5)
 	}
-	slot.Ready = true
-	db.DB.Save(slot)
+	return nil
+}
+
+func (lobby *Lobby) ReadyPlayer(player *Player) *helpers.TPError {
+	tperr := lobby.transaction(func(tx *gorm.DB) *helpers.TPError {
+		return lobby.setPlayerReady(tx, player, true)
+	})
+	if tperr != nil {
+		return tperr
+	}
+
+	lobbyChanged(lobby.ID)
 	return nil
 }
 
 func (lobby *Lobby) UnreadyPlayer(player *Player) *helpers.TPError {
-	slot := &LobbySlot{}
-	err := db.DB.Where("lobby_id = ? AND player_id = ?", lobby.ID, player.ID).First(slot).Error
+	tperr := lobby.transaction(func(tx *gorm.DB) *helpers.TPError {
+		return lobby.setPlayerReady(tx, player, false)
+	})
+	if tperr != nil {
+		return tperr
+	}
+
+	lobbyChanged(lobby.ID)
+	return nil
+}
+
+// UnreadyAllPlayers unreadies everyone in the lobby, when it couldn't be started
+func (lobby *Lobby) UnreadyAllPlayers() *helpers.TPError {
+	err := db.DB.Model(&LobbySlot{}).Where("lobby_id = ?", lobby.ID).UpdateColumn("ready", false).Error
 	if err != nil {
-		return helpers.NewTPError("Player is not in the lobby.", 5)
+		return helpers.NewTPError(err.Error(), -1)
 	}
 
-	slot.Ready = false
-	db.DB.Save(slot)
+	lobbyChanged(lobby.ID)
 	return nil
 }
 
@@ -244,10 +408,14 @@ func (lobby *Lobby) IsPlayerReady(player *Player) (bool, *helpers.TPError) {
 }
 
 func (lobby *Lobby) IsEveryoneReady() bool {
+	return lobby.isEveryoneReady(&db.DB)
+}
+
+func (lobby *Lobby) isEveryoneReady(tx *gorm.DB) bool {
 	var slots []LobbySlot
-	db.DB.Where("lobby_id = ?", lobby.ID).Find(&slots)
+	tx.Where("lobby_id = ?", lobby.ID).Find(&slots)
 
-	if len(slots) != TypePlayerCount[lobby.Type]*2 {
+	if format := GetFormat(lobby.Type); format == nil || len(slots) != format.PlayerCount() {
 		return false
 	}
 
@@ -256,12 +424,162 @@ func (lobby *Lobby) IsEveryoneReady() bool {
 			return false
 		}
 	}
+
+	if lobby.MumbleRequired {
+		presence, err := lobby.GetMumblePresence()
+		if err != nil {
+			helpers.Logger.Warning("[Lobby.IsEveryoneReady]: %s", err.Error())
+			return false
+		}
+
+		for _, slot := range slots {
+			if !presence[slot.PlayerId] {
+				return false
+			}
+		}
+	}
 	return true
 }
 
+func (lobby *Lobby) StartReadyUp(timeout time.Duration) *helpers.TPError {
+	if lobby.State != LobbyStateReadyingUp {
+		tperr := lobby.SetState(LobbyStateReadyingUp, "lobby full", 0)
+		if tperr != nil {
+			return tperr
+		}
+	}
+
+	lobby.ReadyUpDeadline = time.Now().Add(timeout)
+	db.DB.Model(lobby).UpdateColumn("ready_up_deadline", lobby.ReadyUpDeadline)
+	lobbyChanged(lobby.ID)
+	return nil
+}
+
+// StopReadyUp stops the ready up timer. If players left, the lobby goes back to waiting
+// for players, otherwise it stays readying up until the match starts
+func (lobby *Lobby) StopReadyUp() {
+	lobby.ReadyUpDeadline = time.Time{}
+	db.DB.Model(lobby).UpdateColumn("ready_up_deadline", lobby.ReadyUpDeadline)
+	lobbyChanged(lobby.ID)
+
+	if lobby.State == LobbyStateReadyingUp && !lobby.IsFull() {
+		lobby.SetState(LobbyStateWaiting, "players left during ready up", 0)
+	}
+}
+
+func (lobby *Lobby) IsReadyingUp() bool {
+	return !lobby.ReadyUpDeadline.IsZero()
+}
+
+// the players in the lobby's slots
+func (lobby *Lobby) GetPlayers() ([]Player, error) {
+	var players []Player
+	err := db.DB.Joins("INNER JOIN lobby_slots ON lobby_slots.player_id = players.id").
+		Where("lobby_slots.lobby_id = ?", lobby.ID).
+		Find(&players).Error
+
+	return players, err
+}
+
+func (lobby *Lobby) GetUnreadyPlayers() ([]Player, error) {
+	var players []Player
+	err := db.DB.Joins("INNER JOIN lobby_slots ON lobby_slots.player_id = players.id").
+		Where("lobby_slots.lobby_id = ? AND lobby_slots.ready = ?", lobby.ID, false).
+		Find(&players).Error
+
+	return players, err
+}
+
+// RemoveUnreadyPlayers removes the players that didn't ready up in time
+// and stops the ready up. Returns the removed players
+func (lobby *Lobby) RemoveUnreadyPlayers() ([]Player, *helpers.TPError) {
+	players, err := lobby.GetUnreadyPlayers()
+	if err != nil {
+		return nil, helpers.NewTPError(err.Error(), -1)
+	}
+
+	for i := range players {
+		lobby.RemovePlayer(&players[i])
+	}
+	lobby.StopReadyUp()
+
+	return players, nil
+}
+
+// Start is called once everyone is ready. Holding the lobby's lock, everyone being ready
+// is checked again, the server is told to start the match and the lobby goes in progress,
+// so players readying up at the same time only start it once: the others get
+// LobbyStateErrorChanged. If the server fails the lobby is still readying up.
+// On the instances that don't hold the server's lease there's no server to start
+func (lobby *Lobby) Start() *helpers.TPError {
+	return lobby.start("everyone ready", true)
+}
+
+// start moves the lobby from readying up to in progress. With everyoneReady the players
+// have to be ready and the server is started, without it the match already started on
+// the server, see Server.HandleLogEvent
+func (lobby *Lobby) start(trigger string, everyoneReady bool) *helpers.TPError {
+	tperr := lobby.transaction(func(tx *gorm.DB) *helpers.TPError {
+		switch {
+		case lobby.State == LobbyStateInProgress:
+			return helpers.NewTPError("Lobby state has changed, try again.", LobbyStateErrorChanged)
+		case lobby.State != LobbyStateReadyingUp:
+			return helpers.NewTPError(fmt.Sprintf("Lobby can't go from \"%s\" to \"%s\".", lobby.State, LobbyStateInProgress),
+				LobbyStateErrorIllegal)
+		}
+
+		if everyoneReady {
+			if !lobby.isEveryoneReady(tx) {
+				return helpers.NewTPError("Not everyone is ready anymore.", LobbyStateErrorChanged)
+			}
+
+			if lobby.Server != nil {
+				lobby.updateServerAllowedPlayersTx(tx)
+				if err := lobby.Server.Start(); err != nil {
+					helpers.Logger.Warning("[Lobby.Start]: Lobby [%d] server error: %s", lobby.ID, err.Error())
+					return helpers.NewTPError(err.Error(), -1)
+				}
+			}
+		}
+
+		if tperr := lobby.setState(tx, LobbyStateInProgress, trigger, 0); tperr != nil {
+			return tperr
+		}
+
+		// the ready up is over, even if the match started before everyone readied up
+		lobby.StartedAt = time.Now()
+		lobby.ReadyUpDeadline = time.Time{}
+		err := tx.Model(lobby).UpdateColumns(map[string]interface{}{
+			"started_at":        lobby.StartedAt,
+			"ready_up_deadline": lobby.ReadyUpDeadline,
+		}).Error
+		if err != nil {
+			return helpers.NewTPError(err.Error(), -1)
+		}
+
+		var stats []PlayerStats
+		tx.Where("id IN (SELECT players.stats_id FROM players "+
+			"INNER JOIN lobby_slots ON lobby_slots.player_id = players.id WHERE lobby_slots.lobby_id = ?)", lobby.ID).
+			Find(&stats)
+
+		for i := range stats {
+			stats[i].PlayedCountIncrease(lobby.Type)
+			if err := tx.Save(&stats[i]).Error; err != nil {
+				return helpers.NewTPError(err.Error(), -1)
+			}
+		}
+		return nil
+	})
+	if tperr != nil {
+		return tperr
+	}
+
+	lobby.stateChanged(LobbyStateReadyingUp, LobbyStateInProgress, trigger)
+	return nil
+}
+
 func (lobby *Lobby) IsStarted() (bool, *helpers.TPError) {
-	// TODO implement
-	return false, nil
+	return lobby.State == LobbyStateInProgress || lobby.State == LobbyStateEnded, nil
 }
 
 func (lobby *Lobby) AddSpectator(player *Player) *helpers.TPError {
@@ -269,18 +587,34 @@ func (lobby *Lobby) AddSpectator(player *Player) *helpers.TPError {
 		return lobby.RemovePlayer(player)
 	}
 
-	err := db.DB.Model(lobby).Association("Spectators").Append(player).Error
-	if err != nil {
-		return helpers.NewTPError(err.Error(), -1)
+	tperr := lobby.transaction(func(tx *gorm.DB) *helpers.TPError {
+		err := tx.Model(lobby).Association("Spectators").Append(player).Error
+		if err != nil {
+			return helpers.NewTPError(err.Error(), -1)
+		}
+		return nil
+	})
+	if tperr != nil {
+		return tperr
 	}
+
+	lobbyChanged(lobby.ID)
 	return nil
 }
 
 func (lobby *Lobby) RemoveSpectator(player *Player) *helpers.TPError {
-	err := db.DB.Model(lobby).Association("Spectators").Delete(player).Error
-	if err != nil {
-		return helpers.NewTPError(err.Error(), -1)
+	tperr := lobby.transaction(func(tx *gorm.DB) *helpers.TPError {
+		err := tx.Model(lobby).Association("Spectators").Delete(player).Error
+		if err != nil {
+			return helpers.NewTPError(err.Error(), -1)
+		}
+		return nil
+	})
+	if tperr != nil {
+		return tperr
 	}
+
+	lobbyChanged(lobby.ID)
 	return nil
 }
 
@@ -293,8 +627,25 @@ func (lobby *Lobby) GetPlayerNumber() int {
 	return count
 }
 
+// number of players in the slot's team, not counting the player
+func (lobby *Lobby) getTeamPlayerNumber(tx *gorm.DB, slot int, player *Player) int {
+	teamSlots := len(GetFormat(lobby.Type).Slots)
+	team := slot / teamSlots
+
+	count := 0
+	tx.Table("lobby_slots").
+		Where("lobby_id = ? AND player_id <> ? AND slot >= ? AND slot < ?",
+			lobby.ID, player.ID, team*teamSlots, (team+1)*teamSlots).
+		Count(&count)
+	return count
+}
+
 func (lobby *Lobby) IsFull() bool {
-	return lobby.GetPlayerNumber() >= 2*TypePlayerCount[lobby.Type]
+	format := GetFormat(lobby.Type)
+	if format == nil {
+		return false
+	}
+	return lobby.GetPlayerNumber() >= format.PlayerCount()
 }
 
 func (lobby *Lobby) IsSlotFilled(slot int) bool {
@@ -305,8 +656,14 @@ func (lobby *Lobby) IsSlotFilled(slot int) bool {
 	return true
 }
 
+func newServerPassword() string {
+	randBytes := make([]byte, 6)
+	rand.Read(randBytes)
+	return base64.URLEncoding.EncodeToString(randBytes)
+}
+
 func (lobby *Lobby) TrySettingUp() *helpers.TPError {
-	if _, ok := LobbyServerSettingUp[lobby.ID]; ok {
+	if Servers.IsSettingUp(lobby.ID) {
 		return helpers.NewTPError("Lobby setup already in progress", -1)
 	}
 
@@ -314,41 +671,93 @@ func (lobby *Lobby) TrySettingUp() *helpers.TPError {
 		return helpers.NewTPError("Lobby doesn't have a server attached", -1)
 	}
 
-	LobbyServerSettingUp[lobby.ID] = time.Now()
+	// another instance owns the server
+	if !AcquireLease(serverLeaseName(lobby.ID), config.Constants.InstanceId, serverLeaseTTL) {
+		return helpers.NewTPError("Lobby setup already in progress", -1)
+	}
+
+	if !Servers.StartSetup(lobby.ID) {
+		return helpers.NewTPError("Lobby setup already in progress", -1)
+	}
 
 	err := lobby.Server.Setup()
 
-	delete(LobbyServerSettingUp, lobby.ID)
+	Servers.FinishSetup(lobby.ID)
 
 	if err != nil {
-		lobby.Close()
-		return helpers.NewTPError(err.Error(), -1)
+		return lobby.failSetup("server setup failed", err)
 	}
 
-	lobby.State = LobbyStateWaiting
-	db.DB.Save(lobby)
+	err = lobby.SetupMumble()
+	if err != nil && lobby.MumbleRequired {
+		return lobby.failSetup("mumble setup failed", err)
+	} else if err != nil {
+		helpers.Logger.Warning("[Lobby.TrySettingUp]: Lobby [%d] mumble setup failed: %s", lobby.ID, err.Error())
+	}
 
-	return nil
+	lobby.ServerSetUp = true
+	db.DB.Model(lobby).UpdateColumn("server_set_up", true)
+
+	return lobby.SetState(LobbyStateWaiting, "server set up", 0)
+}
+
+// the lobby fails and the server is given up, even if the lobby's state changed meanwhile
+func (lobby *Lobby) failSetup(trigger string, err error) *helpers.TPError {
+	lobby.SetState(LobbyStateFailed, trigger+": "+err.Error(), 0)
+	Servers.Teardown(lobby.ID)
+	ReleaseLease(serverLeaseName(lobby.ID), config.Constants.InstanceId)
+
+	return helpers.NewTPError(err.Error(), -1)
+}
+
+// true if this instance holds the lobby's server lease, or could take it
+func (lobby *Lobby) acquireServerLease() bool {
+	owner := GetLeaseOwner(serverLeaseName(lobby.ID))
+	if owner != "" && owner != config.Constants.InstanceId {
+		return false
+	}
+
+	return AcquireLease(serverLeaseName(lobby.ID), config.Constants.InstanceId, serverLeaseTTL)
 }
 
 func (lobby *Lobby) AfterSave() error {
-	if lobby.State == LobbyStateEnded {
+	if lobby.State.IsFinished() {
 		return nil
 	}
 
-	var s *Server
-	s, ok := LobbyServerMap[lobby.ID]
-	randBytes := make([]byte, 6)
-	rand.Read(randBytes)
+	s, ok := Servers.Get(lobby.ID)
 
 	if !ok {
+		// only the instance holding the lease connects to the game server,
+		// the others leave lobby.Server nil
+		if !lobby.acquireServerLease() {
+			lobby.Server = nil
+			return nil
+		}
+
+		if lobby.ServerPassword == "" {
+			// created before the password was saved
+			lobby.ServerPassword = EncryptedString(newServerPassword())
+			db.DB.Model(lobby).UpdateColumn("server_password", lobby.ServerPassword)
+		}
+
 		s = NewServer()
-		s.League = LeagueEtf2l // TODO actually accept this argument
+		s.League = lobby.League
+		if s.League == "" {
+			// created before lobbies had a league
+			s.League = LeagueEtf2l
+		}
+		s.RulesVariant = lobby.RulesVariant
 		s.Map = lobby.MapName
 		s.Type = lobby.Type
+		s.Whitelist = lobby.Whitelist
 		s.Info = lobby.ServerInfo
 		s.LobbyId = lobby.ID
-		s.ServerPassword = base64.URLEncoding.EncodeToString(randBytes)
+		s.ServerPassword = string(lobby.ServerPassword)
+		s.LogSecret = lobby.ServerLogSecret
+		if lobby.ServerAllowedPlayers != "" {
+			s.SetAllowedPlayers(strings.Split(lobby.ServerAllowedPlayers, ","))
+		}
 
 		err := s.VerifyInfo()
 
@@ -356,9 +765,23 @@ func (lobby *Lobby) AfterSave() error {
 			return err
 		}
 
-		s.SetupObject()
-
-		LobbyServerMap[lobby.ID] = s
+		// the lobby could be loaded by another goroutine at the same time, the first server is kept
+		registered, ok := Servers.Register(lobby.ID, s)
+		if ok {
+			if lobby.ServerSetUp {
+				// set up before a restart, its logs still come with the secret
+				s.resumeLogs()
+			}
+			if lobby.State == LobbyStateInProgress && !lobby.LogsPartial {
+				lobby.LogsPartial = true
+				db.DB.Model(lobby).UpdateColumn("logs_partial", true)
+			}
+			s.LogsPartial = lobby.LogsPartial
+			s.SetupObject()
+		} else if s.Rcon != nil {
+			s.Rcon.Close()
+		}
+		s = registered
 	}
 	if s == nil {
 		helpers.Logger.Warning("Failed to attach server to lobby ", lobby.ID)
@@ -367,15 +790,21 @@ func (lobby *Lobby) AfterSave() error {
 	return nil
 }
 
-func (lobby *Lobby) Close() {
-	lobby.Server.End()
-	lobby.State = LobbyStateEnded
-	delete(LobbyServerSettingUp, lobby.ID)
-	db.DB.Save(lobby)
+// Close ends the lobby, a lobby that hasn't started yet is cancelled
+func (lobby *Lobby) Close() *helpers.TPError {
+	if lobby.State == LobbyStateInProgress {
+		return lobby.SetState(LobbyStateEnded, "game over", 0)
+	}
+	return lobby.SetState(LobbyStateCancelled, "lobby closed", 0)
+}
+
+// Cancel closes the lobby on behalf of the player
+func (lobby *Lobby) Cancel(player *Player) *helpers.TPError {
+	return lobby.SetState(LobbyStateCancelled, "closed by player", player.ID)
 }
 
 func (lobby *Lobby) AfterDelete() error {
-	lobby.Server.End()
+	Servers.Teardown(lobby.ID)
 	return nil
 }
 
@@ -391,13 +820,29 @@ func (lobby *Lobby) AfterFind() error {
 }
 
 func (lobby *Lobby) updateServerAllowedPlayers() {
+	lobby.updateServerAllowedPlayersTx(&db.DB)
+}
+
+// in tx, for the transactions holding the lobby's lock
+func (lobby *Lobby) updateServerAllowedPlayersTx(tx *gorm.DB) {
+	steamids := getLobbySteamIds(lobby.ID)
+
+	lobby.ServerAllowedPlayers = strings.Join(steamids, ",")
+	tx.Model(&Lobby{}).Where("id = ?", lobby.ID).UpdateColumn("server_allowed_players", lobby.ServerAllowedPlayers)
+
 	if lobby.Server == nil {
 		// helpers.Logger.Warning("Trying to update allowed players but the lobby doesn't have a server attached. This is a bug. Fix it.")
 		return
 	}
+
+	lobby.Server.SetAllowedPlayers(steamids)
+}
+
+// the steam ids of the lobby's players
+func getLobbySteamIds(lobbyId uint) []string {
 	var steamids []string
 	db.DB.Model(&LobbySlot{}).Joins("left join players on players.id = lobby_slots.player_id").
-		Where("lobby_slots.lobby_id = ?", lobby.ID).Pluck("steam_id", &steamids)
+		Where("lobby_slots.lobby_id = ?", lobbyId).Pluck("steam_id", &steamids)
 
-	lobby.Server.SetAllowedPlayers(steamids)
+	return steamids
 }
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"sync"
+)
+
+// called after something shown in the lobby's data changed: players, ready up, state or settings
+type LobbyChangeHook func(lobbyId uint)
+
+var lobbyChangeHooks []LobbyChangeHook
+var lobbyChangeHooksMutex sync.RWMutex
+
+// OnLobbyChange registers a hook that is called every time a lobby is changed
+func OnLobbyChange(hook LobbyChangeHook) {
+	lobbyChangeHooksMutex.Lock()
+	defer lobbyChangeHooksMutex.Unlock()
+
+	lobbyChangeHooks = append(lobbyChangeHooks, hook)
+}
+
+func lobbyChanged(lobbyId uint) {
+	lobbyChangeHooksMutex.RLock()
+	hooks := lobbyChangeHooks
+	lobbyChangeHooksMutex.RUnlock()
+
+	for _, hook := range hooks {
+		hook(lobbyId)
+	}
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"time"
+
+	db "github.com/TF2Stadium/Helen/database"
+	"github.com/TF2Stadium/Helen/helpers"
+)
+
+// a player's stats in a single lobby, from the server logs
+type LobbyPlayerStats struct {
+	ID        uint
+	CreatedAt time.Time
+	LobbyId   uint
+	Lobby     Lobby // only loaded by GetPlayerRecentStats
+	PlayerId  uint
+
+	Class      string // the class played the most
+	Kills      int
+	Deaths     int
+	Assists    int
+	Damage     int
+	Heals      int
+	Ubers      int
+	Drops      int
+	TimePlayed int // seconds
+}
+
+// SaveLobbyStats saves the stats for every player in results (commid -> stats)
+// and adds them to the players' lifetime stats. The played counts are increased by Lobby.Start
+func SaveLobbyStats(lobby *Lobby, results map[string]LobbyPlayerStats) {
+	for commId, stats := range results {
+		player, err := GetPlayerWithStats(commId)
+		if err != nil {
+			helpers.Logger.Debug("[SaveLobbyStats]: %s isn't in the database, skipping", commId)
+			continue
+		}
+
+		stats.LobbyId = lobby.ID
+		stats.PlayerId = player.ID
+		db.DB.Create(&stats)
+
+		player.Stats.AddLobbyStats(&stats)
+		db.DB.Save(&player.Stats)
+	}
+}
+
+// the most recent lobbies the player has stats for, with the lobbies
+func GetPlayerRecentStats(playerId uint, count int) ([]LobbyPlayerStats, error) {
+	var stats []LobbyPlayerStats
+	err := db.DB.Preload("Lobby").Where("player_id = ?", playerId).Order("id desc").Limit(count).Find(&stats).Error
+
+	return stats, err
+}
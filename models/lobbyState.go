@@ -0,0 +1,168 @@
+package models
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	db "github.com/TF2Stadium/Helen/database"
+	"github.com/TF2Stadium/Helen/helpers"
+	"github.com/jinzhu/gorm"
+)
+
+// error codes returned by SetState
+const (
+	LobbyStateErrorIllegal = 9  // the transition isn't in lobbyStateTransitions
+	LobbyStateErrorChanged = 10 // someone else changed the state first
+)
+
+// the states a lobby can go to from each state. Ended, Cancelled and Failed are final
+var lobbyStateTransitions = map[LobbyState][]LobbyState{
+	LobbyStateInitializing: {LobbyStateWaiting, LobbyStateCancelled, LobbyStateFailed},
+	LobbyStateWaiting:      {LobbyStateReadyingUp, LobbyStateCancelled, LobbyStateFailed},
+	LobbyStateReadyingUp:   {LobbyStateWaiting, LobbyStateInProgress, LobbyStateCancelled, LobbyStateFailed},
+	LobbyStateInProgress:   {LobbyStateEnded, LobbyStateCancelled, LobbyStateFailed},
+}
+
+var finishedLobbyStates = []LobbyState{LobbyStateEnded, LobbyStateCancelled, LobbyStateFailed}
+
+func (state LobbyState) String() string {
+	if str, ok := stateString[state]; ok {
+		return str
+	}
+	return fmt.Sprintf("Unknown state %d", int(state))
+}
+
+// IsFinished returns true if the lobby can't change state anymore
+func (state LobbyState) IsFinished() bool {
+	for _, finished := range finishedLobbyStates {
+		if state == finished {
+			return true
+		}
+	}
+	return false
+}
+
+func (state LobbyState) CanChangeTo(to LobbyState) bool {
+	for _, next := range lobbyStateTransitions[state] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// a row is added to lobby_state_events every time a lobby changes state, they're never updated
+type LobbyStateEvent struct {
+	ID        uint
+	CreatedAt time.Time
+
+	LobbyId uint
+	From    LobbyState
+	To      LobbyState
+
+	Trigger  string // what caused the change
+	PlayerId uint   // the player that caused it, 0 if it wasn't a player
+}
+
+// called after a lobby changed state
+type LobbyStateHook func(lobby *Lobby, from LobbyState, to LobbyState)
+
+var lobbyStateHooks []LobbyStateHook
+var lobbyStateHooksMutex sync.RWMutex
+
+// OnLobbyStateChange registers a hook that is called every time a lobby changes state
+func OnLobbyStateChange(hook LobbyStateHook) {
+	lobbyStateHooksMutex.Lock()
+	defer lobbyStateHooksMutex.Unlock()
+
+	lobbyStateHooks = append(lobbyStateHooks, hook)
+}
+
+func runLobbyStateHooks(lobby *Lobby, from LobbyState, to LobbyState) {
+	lobbyStateHooksMutex.RLock()
+	hooks := lobbyStateHooks
+	lobbyStateHooksMutex.RUnlock()
+
+	for _, hook := range hooks {
+		hook(lobby, from, to)
+	}
+}
+
+// SetState moves the lobby to the given state and records the change in lobby_state_events.
+// playerId is the player that triggered the change, 0 if it wasn't a player
+func (lobby *Lobby) SetState(state LobbyState, trigger string, playerId uint) *helpers.TPError {
+	from := lobby.State
+
+	tx := db.DB.Begin()
+	if tperr := lobby.setState(tx, state, trigger, playerId); tperr != nil {
+		tx.Rollback()
+		return tperr
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return helpers.NewTPError(err.Error(), -1)
+	}
+
+	lobby.stateChanged(from, state, trigger)
+	return nil
+}
+
+// setState does SetState's changes in tx, once it's committed the caller calls stateChanged
+func (lobby *Lobby) setState(tx *gorm.DB, state LobbyState, trigger string, playerId uint) *helpers.TPError {
+	from := lobby.State
+
+	if !from.CanChangeTo(state) {
+		return helpers.NewTPError(fmt.Sprintf("Lobby can't go from \"%s\" to \"%s\".", from, state), LobbyStateErrorIllegal)
+	}
+
+	// only one of the updates can succeed if the lobby is changed concurrently
+	result := tx.Model(&Lobby{}).Where("id = ? AND state = ?", lobby.ID, from).UpdateColumn("state", state)
+	if result.Error != nil {
+		return helpers.NewTPError(result.Error.Error(), -1)
+	}
+	if result.RowsAffected != 1 {
+		return helpers.NewTPError("Lobby state has changed, try again.", LobbyStateErrorChanged)
+	}
+
+	event := &LobbyStateEvent{
+		LobbyId:  lobby.ID,
+		From:     from,
+		To:       state,
+		Trigger:  trigger,
+		PlayerId: playerId,
+	}
+	if err := tx.Create(event).Error; err != nil {
+		return helpers.NewTPError(err.Error(), -1)
+	}
+	return nil
+}
+
+func (lobby *Lobby) stateChanged(from LobbyState, to LobbyState, trigger string) {
+	lobby.State = to
+	helpers.Logger.Debug("[Lobby.SetState]: Lobby [%d] %s -> %s (%s)", lobby.ID, from, to, trigger)
+
+	runLobbyStateHooks(lobby, from, to)
+	lobbyChanged(lobby.ID)
+}
+
+func (lobby *Lobby) GetStateEvents() ([]LobbyStateEvent, error) {
+	var events []LobbyStateEvent
+	err := db.DB.Where("lobby_id = ?", lobby.ID).Order("id").Find(&events).Error
+
+	return events, err
+}
+
+// the server isn't needed once the lobby is over
+func endLobbyServer(lobby *Lobby, from LobbyState, to LobbyState) {
+	if !to.IsFinished() {
+		return
+	}
+
+	Servers.Teardown(lobby.ID)
+	lobby.ServerInfo.Release()
+}
+
+func init() {
+	OnLobbyStateChange(endLobbyServer)
+}
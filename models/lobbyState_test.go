@@ -0,0 +1,111 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/TF2Stadium/Helen/database/migrations"
+	"github.com/TF2Stadium/Helen/helpers"
+	"github.com/TF2Stadium/Helen/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	helpers.InitLogger()
+}
+
+func TestLobbyStateTransitions(t *testing.T) {
+	migrations.TestCleanup()
+	lobby := models.NewLobby("cp_badlands", models.LobbyTypeSixes, models.ServerRecord{}, 0)
+	lobby.Save()
+
+	player, _ := models.NewPlayer("0")
+	player.Save()
+
+	// can't skip the ready up
+	tperr := lobby.SetState(models.LobbyStateInProgress, "test", 0)
+	assert.NotNil(t, tperr)
+	assert.Equal(t, models.LobbyStateErrorIllegal, tperr.Code)
+	assert.Equal(t, models.LobbyStateInitializing, lobby.State)
+
+	assert.Nil(t, lobby.SetState(models.LobbyStateWaiting, "server set up", 0))
+	assert.Nil(t, lobby.SetState(models.LobbyStateReadyingUp, "lobby full", 0))
+	assert.Nil(t, lobby.SetState(models.LobbyStateInProgress, "round start", 0))
+
+	started, _ := lobby.IsStarted()
+	assert.True(t, started)
+
+	lobby2, _ := models.GetLobbyById(lobby.ID)
+	assert.Equal(t, models.LobbyStateInProgress, lobby2.State)
+
+	assert.Nil(t, lobby.Cancel(player))
+	assert.True(t, lobby.State.IsFinished())
+
+	// finished lobbies stay finished
+	tperr = lobby.SetState(models.LobbyStateWaiting, "test", 0)
+	assert.NotNil(t, tperr)
+	assert.Equal(t, models.LobbyStateErrorIllegal, tperr.Code)
+
+	events, err := lobby.GetStateEvents()
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(events))
+	assert.Equal(t, models.LobbyStateInitializing, events[0].From)
+	assert.Equal(t, models.LobbyStateWaiting, events[0].To)
+	assert.Equal(t, "server set up", events[0].Trigger)
+	assert.Equal(t, models.LobbyStateCancelled, events[3].To)
+	assert.Equal(t, player.ID, events[3].PlayerId)
+}
+
+func TestLobbyStateChanged(t *testing.T) {
+	migrations.TestCleanup()
+	lobby := models.NewLobby("cp_badlands", models.LobbyTypeSixes, models.ServerRecord{}, 0)
+	lobby.Save()
+
+	stale, _ := models.GetLobbyById(lobby.ID)
+
+	assert.Nil(t, lobby.SetState(models.LobbyStateWaiting, "server set up", 0))
+
+	// the other copy still thinks the lobby is initializing
+	tperr := stale.SetState(models.LobbyStateFailed, "server setup failed", 0)
+	assert.NotNil(t, tperr)
+	assert.Equal(t, models.LobbyStateErrorChanged, tperr.Code)
+
+	events, _ := lobby.GetStateEvents()
+	assert.Equal(t, 1, len(events))
+}
+
+func TestLobbyStateHook(t *testing.T) {
+	migrations.TestCleanup()
+	lobby := models.NewLobby("cp_badlands", models.LobbyTypeSixes, models.ServerRecord{}, 0)
+	lobby.Save()
+
+	var changes []models.LobbyState
+	models.OnLobbyStateChange(func(l *models.Lobby, from models.LobbyState, to models.LobbyState) {
+		if l.ID == lobby.ID {
+			changes = append(changes, to)
+		}
+	})
+
+	lobby.SetState(models.LobbyStateWaiting, "server set up", 0)
+	lobby.SetState(models.LobbyStateInProgress, "test", 0)
+	lobby.Close()
+
+	assert.Equal(t, []models.LobbyState{models.LobbyStateWaiting, models.LobbyStateCancelled}, changes)
+}
+
+func TestLobbyStateEndsServer(t *testing.T) {
+	migrations.TestCleanup()
+	lobby := models.NewLobby("cp_badlands", models.LobbyTypeSixes, models.ServerRecord{}, 0)
+	lobby.Save()
+
+	server, ok := models.Servers.Get(lobby.ID)
+	assert.True(t, ok)
+	assert.Equal(t, lobby.Server, server)
+
+	// loading the lobby again uses the same server
+	lobby2, _ := models.GetLobbyById(lobby.ID)
+	assert.Equal(t, server, lobby2.Server)
+
+	assert.Nil(t, lobby.Close())
+	_, ok = models.Servers.Get(lobby.ID)
+	assert.False(t, ok)
+}
@@ -1,13 +1,19 @@
 package models_test
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/TF2Stadium/Helen/config"
 	db "github.com/TF2Stadium/Helen/database"
 	"github.com/TF2Stadium/Helen/database/migrations"
 	"github.com/TF2Stadium/Helen/helpers"
+	"github.com/TF2Stadium/Helen/helpers/rcontest"
 	"github.com/TF2Stadium/Helen/models"
 	"github.com/stretchr/testify/assert"
 )
@@ -18,7 +24,7 @@ func init() {
 
 func TestLobbyCreation(t *testing.T) {
 	migrations.TestCleanup()
-	lobby := models.NewLobby("cp_badlands", models.LobbyTypeSixes, models.ServerRecord{0, "testip", ""}, 0)
+	lobby := models.NewLobby("cp_badlands", models.LobbyTypeSixes, models.ServerRecord{Host: "testip"}, 0)
 	lobby.Save()
 
 	lobby2, _ := models.GetLobbyById(lobby.ID)
@@ -28,7 +34,7 @@ func TestLobbyCreation(t *testing.T) {
 	assert.Equal(t, lobby.ServerInfo.ID, lobby2.ServerInfo.ID)
 	//testing password creation
 	assert.Equal(t, len(lobby.Server.ServerPassword), 8)
-	lobby3 := models.NewLobby("cp_process_final", models.LobbyTypeSixes, models.ServerRecord{0, "testip", ""}, 0)
+	lobby3 := models.NewLobby("cp_process_final", models.LobbyTypeSixes, models.ServerRecord{Host: "testip"}, 0)
 	lobby3.Save()
 	assert.NotEqual(t, lobby.Server.ServerPassword, lobby3.Server.ServerPassword)
 
@@ -39,9 +45,27 @@ func TestLobbyCreation(t *testing.T) {
 	assert.Equal(t, "cp_granary", lobby2.MapName)
 }
 
+func TestLobbyLeague(t *testing.T) {
+	migrations.TestCleanup()
+
+	lobby := models.NewLobby("cp_badlands", models.LobbyTypeSixes, models.ServerRecord{}, 0)
+	assert.Equal(t, models.LeagueEtf2l, lobby.League)
+
+	lobby.League = models.LeagueUgc
+	lobby.RulesVariant = "overtime"
+	lobby.Save()
+
+	lobby2, err := models.GetLobbyById(lobby.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, models.LeagueUgc, lobby2.League)
+	assert.Equal(t, "overtime", lobby2.RulesVariant)
+	assert.Equal(t, models.LeagueUgc, lobby2.Server.League)
+	assert.Equal(t, "overtime", lobby2.Server.RulesVariant)
+}
+
 func TestLobbyAdd(t *testing.T) {
 	migrations.TestCleanup()
-	lobby := models.NewLobby("cp_badlands", models.LobbyTypeSixes, models.ServerRecord{0, "", ""}, 0)
+	lobby := models.NewLobby("cp_badlands", models.LobbyTypeSixes, models.ServerRecord{}, 0)
 	lobby.Save()
 
 	var players []*models.Player
@@ -86,7 +110,7 @@ func TestLobbyAdd(t *testing.T) {
 	err = lobby.AddPlayer(players[2], 55)
 	assert.NotNil(t, err)
 
-	lobby2 := models.NewLobby("cp_granary", models.LobbyTypeSixes, models.ServerRecord{0, "", ""}, 0)
+	lobby2 := models.NewLobby("cp_granary", models.LobbyTypeSixes, models.ServerRecord{}, 0)
 	lobby2.Save()
 
 	// try to add a player while they're in another lobby
@@ -94,9 +118,37 @@ func TestLobbyAdd(t *testing.T) {
 	assert.NotNil(t, err)
 }
 
+func TestLobbyAddProlander(t *testing.T) {
+	migrations.TestCleanup()
+	lobby := models.NewLobby("pl_badwater", models.LobbyTypeProlander, models.ServerRecord{}, 0)
+	lobby.Save()
+
+	var players []*models.Player
+	for i := 0; i < 9; i++ {
+		player, playErr := models.NewPlayer("p" + fmt.Sprint(i))
+		assert.Nil(t, playErr)
+		player.Save()
+		players = append(players, player)
+	}
+
+	// red has a slot for every class, only 7 can be picked
+	for i := 0; i < 7; i++ {
+		assert.Nil(t, lobby.AddPlayer(players[i], i))
+	}
+	assert.NotNil(t, lobby.AddPlayer(players[7], 7))
+
+	// switching classes in a full team
+	assert.Nil(t, lobby.AddPlayer(players[0], 8))
+
+	// blu
+	assert.Nil(t, lobby.AddPlayer(players[7], 9+7))
+	assert.Equal(t, 8, lobby.GetPlayerNumber())
+	assert.False(t, lobby.IsFull())
+}
+
 func TestLobbyRemove(t *testing.T) {
 	migrations.TestCleanup()
-	lobby := models.NewLobby("cp_badlands", models.LobbyTypeSixes, models.ServerRecord{0, "", ""}, 0)
+	lobby := models.NewLobby("cp_badlands", models.LobbyTypeSixes, models.ServerRecord{}, 0)
 	lobby.Save()
 
 	player, playErr := models.NewPlayer("1235")
@@ -122,7 +174,7 @@ func TestLobbyRemove(t *testing.T) {
 
 func TestLobbyBan(t *testing.T) {
 	migrations.TestCleanup()
-	lobby := models.NewLobby("cp_badlands", models.LobbyTypeSixes, models.ServerRecord{0, "", ""}, 0)
+	lobby := models.NewLobby("cp_badlands", models.LobbyTypeSixes, models.ServerRecord{}, 0)
 	lobby.Save()
 
 	player, playErr := models.NewPlayer("1235")
@@ -149,7 +201,7 @@ func TestReadyPlayer(t *testing.T) {
 	assert.Nil(t, playErr)
 
 	player.Save()
-	lobby := models.NewLobby("cp_badlands", models.LobbyTypeSixes, models.ServerRecord{0, "", ""}, 0)
+	lobby := models.NewLobby("cp_badlands", models.LobbyTypeSixes, models.ServerRecord{}, 0)
 	lobby.Save()
 	lobby.AddPlayer(player, 0)
 
@@ -171,7 +223,7 @@ func TestIsEveryoneReady(t *testing.T) {
 	assert.Nil(t, playErr)
 
 	player.Save()
-	lobby := models.NewLobby("cp_badlands", models.LobbyTypeSixes, models.ServerRecord{0, "", ""}, 0)
+	lobby := models.NewLobby("cp_badlands", models.LobbyTypeSixes, models.ServerRecord{}, 0)
 	lobby.Save()
 	lobby.AddPlayer(player, 0)
 	lobby.ReadyPlayer(player)
@@ -193,7 +245,7 @@ func TestUnreadyPlayer(t *testing.T) {
 	assert.Nil(t, playErr)
 
 	player.Save()
-	lobby := models.NewLobby("cp_badlands", models.LobbyTypeSixes, models.ServerRecord{0, "", ""}, 0)
+	lobby := models.NewLobby("cp_badlands", models.LobbyTypeSixes, models.ServerRecord{}, 0)
 	lobby.Save()
 	lobby.AddPlayer(player, 0)
 
@@ -216,7 +268,7 @@ func TestSpectators(t *testing.T) {
 	assert.Nil(t, playErr2)
 	player2.Save()
 
-	lobby := models.NewLobby("cp_badlands", models.LobbyTypeSixes, models.ServerRecord{0, "", ""}, 0)
+	lobby := models.NewLobby("cp_badlands", models.LobbyTypeSixes, models.ServerRecord{}, 0)
 	lobby.Save()
 
 	err := lobby.AddSpectator(player)
@@ -260,3 +312,414 @@ func TestSpectators(t *testing.T) {
 	db.DB.Model(lobby).Association("Spectators").Find(&specs)
 	assert.Equal(t, 0, len(specs))
 }
+
+func TestReadyUpTimeout(t *testing.T) {
+	migrations.TestCleanup()
+	lobby := models.NewLobby("cp_badlands", models.LobbyTypeSixes, models.ServerRecord{}, 0)
+	lobby.Save()
+
+	var players []*models.Player
+	for i := 0; i < 12; i++ {
+		player, playErr := models.NewPlayer(strconv.Itoa(i))
+		assert.Nil(t, playErr)
+		player.Save()
+		players = append(players, player)
+
+		lobby.AddPlayer(player, i)
+		if i > 1 {
+			lobby.ReadyPlayer(player)
+		}
+	}
+	assert.True(t, lobby.IsFull())
+
+	assert.Nil(t, lobby.SetState(models.LobbyStateWaiting, "test", 0))
+	assert.Nil(t, lobby.StartReadyUp(time.Minute))
+	assert.True(t, lobby.IsReadyingUp())
+	assert.Equal(t, models.LobbyStateReadyingUp, lobby.State)
+
+	lobby2, _ := models.GetLobbyById(lobby.ID)
+	assert.True(t, lobby2.IsReadyingUp())
+
+	removed, err := lobby.RemoveUnreadyPlayers()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(removed))
+	assert.False(t, lobby.IsReadyingUp())
+	assert.Equal(t, models.LobbyStateWaiting, lobby.State)
+	assert.False(t, lobby.IsFull())
+	assert.False(t, lobby.IsSlotFilled(0))
+	assert.False(t, lobby.IsSlotFilled(1))
+	assert.True(t, lobby.IsSlotFilled(2))
+
+	// players on cooldown can't join
+	players[0].SetJoinCooldown(time.Minute)
+	err = lobby.AddPlayer(players[0], 0)
+	assert.NotNil(t, err)
+
+	players[1].SetJoinCooldown(0)
+	err = lobby.AddPlayer(players[1], 1)
+	assert.Nil(t, err)
+}
+
+func TestSubstitute(t *testing.T) {
+	migrations.TestCleanup()
+	lobby := models.NewLobby("cp_badlands", models.LobbyTypeSixes, models.ServerRecord{}, 0)
+	lobby.Save()
+
+	player, _ := models.NewPlayer("0")
+	player.Save()
+	sub, _ := models.NewPlayer("1")
+	sub.Save()
+
+	lobby.AddPlayer(player, 0)
+
+	// subs are only for lobbies in progress
+	_, err := lobby.RequestSubstitute(player, "red", "scout1")
+	assert.NotNil(t, err)
+
+	lobby.State = models.LobbyStateInProgress
+	lobby.Save()
+
+	_, err = lobby.RequestSubstitute(player, "red", "scout1")
+	assert.Nil(t, err)
+	assert.False(t, lobby.IsSlotFilled(0))
+	assert.True(t, lobby.IsSubstituteNeeded(0))
+
+	subs, _ := models.GetOpenSubstitutes()
+	assert.Equal(t, 1, len(subs))
+
+	// the lobby is running, only slots that need a sub can be joined
+	err = lobby.AddPlayer(sub, 1)
+	assert.NotNil(t, err)
+	err = lobby.FillSubstitute(sub, 1)
+	assert.NotNil(t, err)
+
+	err = lobby.FillSubstitute(sub, 0)
+	assert.Nil(t, err)
+	assert.True(t, lobby.IsSlotFilled(0))
+	assert.False(t, lobby.IsSubstituteNeeded(0))
+
+	subs, _ = models.GetOpenSubstitutes()
+	assert.Equal(t, 0, len(subs))
+
+	player2, _ := models.GetPlayerWithStats("0")
+	assert.Equal(t, 1, player2.Stats.SubbedOutCount)
+}
+
+func TestLobbyStart(t *testing.T) {
+	migrations.TestCleanup()
+	models.InitServerConfigs()
+
+	lobby := models.NewLobby("cp_badlands", models.LobbyTypeSixes, models.ServerRecord{}, 0)
+	lobby.Save()
+	lobby.SetState(models.LobbyStateWaiting, "test", 0)
+
+	var players []*models.Player
+	for i := 0; i < 12; i++ {
+		player, playErr := models.NewPlayer(strconv.Itoa(i))
+		assert.Nil(t, playErr)
+		player.Save()
+		players = append(players, player)
+
+		lobby.AddPlayer(player, i)
+		lobby.ReadyPlayer(player)
+	}
+
+	// the lobby has to go through the ready up
+	assert.NotNil(t, lobby.Start())
+
+	lobby.StartReadyUp(time.Minute)
+	lobby.StopReadyUp()
+	assert.Equal(t, models.LobbyStateReadyingUp, lobby.State)
+
+	// the lobby doesn't start if the server can't
+	rcon := rcontest.NewFakeRcon()
+	rcon.Errors["ExecConfig"] = errors.New("server is down")
+	lobby.Server.Rcon = rcon
+	assert.NotNil(t, lobby.Start())
+	assert.Equal(t, models.LobbyStateReadyingUp, lobby.State)
+
+	assert.Nil(t, lobby.UnreadyAllPlayers())
+	assert.False(t, lobby.IsEveryoneReady())
+
+	// everyone has to be ready again
+	rcon = rcontest.NewFakeRcon()
+	lobby.Server.Rcon = rcon
+	assert.NotNil(t, lobby.Start())
+	assert.Equal(t, 0, len(rcon.Commands()))
+
+	for _, player := range players {
+		lobby.ReadyPlayer(player)
+	}
+	assert.Nil(t, lobby.Start())
+	assert.Equal(t, models.LobbyStateInProgress, lobby.State)
+
+	// the config, the whitelist, then the announcement
+	commands := rcon.Commands()
+	assert.Equal(t, "exec", commands[0])
+	assert.True(t, strings.HasPrefix(commands[len(commands)-2], "mp_tournament_whitelist "))
+	assert.Equal(t, "say [tf2stadium.com]: Lobby #"+fmt.Sprint(lobby.ID)+" is live, good luck and have fun!",
+		commands[len(commands)-1])
+	assert.True(t, lobby.Server.IsPlayerAllowed(players[0].SteamId))
+
+	lobby2, _ := models.GetLobbyById(lobby.ID)
+	assert.False(t, lobby2.StartedAt.IsZero())
+
+	for _, player := range players {
+		player2, _ := models.GetPlayerWithStats(player.SteamId)
+		assert.Equal(t, 1, player2.Stats.PlayedCountGet(models.LobbyTypeSixes))
+	}
+
+	// can't start twice
+	assert.NotNil(t, lobby.Start())
+}
+
+func TestLobbyStartRace(t *testing.T) {
+	migrations.TestCleanup()
+	models.InitServerConfigs()
+
+	lobby := models.NewLobby("cp_badlands", models.LobbyTypeSixes, models.ServerRecord{}, 0)
+	lobby.Save()
+	lobby.SetState(models.LobbyStateWaiting, "test", 0)
+
+	for i := 0; i < 12; i++ {
+		player, playErr := models.NewPlayer(strconv.Itoa(i))
+		assert.Nil(t, playErr)
+		player.Save()
+
+		lobby.AddPlayer(player, i)
+		lobby.ReadyPlayer(player)
+	}
+	lobby.StartReadyUp(time.Minute)
+
+	rcon := rcontest.NewFakeRcon()
+	lobby.Server.Rcon = rcon
+
+	// the last players readying up at the same time
+	var wg sync.WaitGroup
+	errs := make([]*helpers.TPError, 4)
+	for i := range errs {
+		lob, _ := models.GetLobbyById(lobby.ID)
+		lob.Server = lobby.Server
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = lob.Start()
+		}(i)
+	}
+	wg.Wait()
+
+	started := 0
+	for _, err := range errs {
+		if err == nil {
+			started++
+		} else {
+			assert.Equal(t, models.LobbyStateErrorChanged, err.Code)
+		}
+	}
+	assert.Equal(t, 1, started)
+
+	// the server is only started once
+	execs := 0
+	for _, command := range rcon.Commands() {
+		if command == "exec" {
+			execs++
+		}
+	}
+	assert.Equal(t, 1, execs)
+
+	events, _ := lobby.GetStateEvents()
+	assert.Equal(t, models.LobbyStateInProgress, events[len(events)-1].To)
+	assert.Equal(t, models.LobbyStateReadyingUp, events[len(events)-2].To)
+}
+
+func TestLobbyRoundStart(t *testing.T) {
+	migrations.TestCleanup()
+	models.InitServerConfigs()
+
+	lobby := models.NewLobby("cp_badlands", models.LobbyTypeSixes, models.ServerRecord{}, 0)
+	lobby.Save()
+	lobby.SetState(models.LobbyStateWaiting, "test", 0)
+
+	var players []*models.Player
+	for i := 0; i < 12; i++ {
+		player, playErr := models.NewPlayer(strconv.Itoa(i))
+		assert.Nil(t, playErr)
+		player.Save()
+		players = append(players, player)
+
+		lobby.AddPlayer(player, i)
+	}
+
+	s := models.NewServer()
+	s.LobbyId = lobby.ID
+
+	// nothing happens before the ready up
+	s.HandleLogEvent(&models.LogEvent{Type: models.LogEventRoundStart})
+	lobby2, _ := models.GetLobbyById(lobby.ID)
+	assert.Equal(t, models.LobbyStateWaiting, lobby2.State)
+
+	// the match started on the server before everyone readied up
+	lobby.StartReadyUp(time.Minute)
+	s.HandleLogEvent(&models.LogEvent{Type: models.LogEventRoundStart})
+
+	lobby2, _ = models.GetLobbyById(lobby.ID)
+	assert.Equal(t, models.LobbyStateInProgress, lobby2.State)
+	assert.False(t, lobby2.StartedAt.IsZero())
+	assert.False(t, lobby2.IsReadyingUp())
+
+	player2, _ := models.GetPlayerWithStats(players[0].SteamId)
+	assert.Equal(t, 1, player2.Stats.PlayedCountGet(models.LobbyTypeSixes))
+
+	events, _ := lobby.GetStateEvents()
+	assert.Equal(t, "round start", events[len(events)-1].Trigger)
+}
+
+func TestLobbyChangeHooks(t *testing.T) {
+	migrations.TestCleanup()
+	lobby := models.NewLobby("cp_badlands", models.LobbyTypeSixes, models.ServerRecord{}, 0)
+	lobby.Save()
+
+	player, playErr := models.NewPlayer("1236")
+	assert.Nil(t, playErr)
+	player.Save()
+
+	changes := 0
+	models.OnLobbyChange(func(lobbyId uint) {
+		if lobbyId == lobby.ID {
+			changes++
+		}
+	})
+
+	assert.Nil(t, lobby.AddPlayer(player, 0))
+	assert.NotEqual(t, 0, changes)
+
+	changes = 0
+	assert.Nil(t, lobby.ReadyPlayer(player))
+	assert.Equal(t, 1, changes)
+
+	changes = 0
+	assert.Nil(t, lobby.RemovePlayer(player))
+	assert.Equal(t, 1, changes)
+
+	// nothing to remove
+	changes = 0
+	assert.Nil(t, lobby.RemovePlayer(player))
+	assert.Equal(t, 0, changes)
+
+	assert.Nil(t, lobby.SetState(models.LobbyStateWaiting, "test", 0))
+	assert.Equal(t, 1, changes)
+}
+
+// like players sending lobbyJoin at the same time, every request loads its own lobby
+func TestFillSubstituteRace(t *testing.T) {
+	migrations.TestCleanup()
+	lobby := models.NewLobby("cp_badlands", models.LobbyTypeSixes, models.ServerRecord{}, 0)
+	lobby.Save()
+	lobby.SetState(models.LobbyStateWaiting, "test", 0)
+
+	var players []*models.Player
+	for i := 0; i < 7; i++ {
+		player, playErr := models.NewPlayer("p" + fmt.Sprint(i))
+		assert.Nil(t, playErr)
+		player.Save()
+		players = append(players, player)
+	}
+
+	assert.Nil(t, lobby.AddPlayer(players[0], 0))
+	assert.Nil(t, lobby.SetState(models.LobbyStateReadyingUp, "test", 0))
+	assert.Nil(t, lobby.SetState(models.LobbyStateInProgress, "test", 0))
+	_, tperr := lobby.RequestSubstitute(players[0], "red", "scout")
+	assert.Nil(t, tperr)
+
+	var wg sync.WaitGroup
+	errs := make([]*helpers.TPError, len(players)-1)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			lob, _ := models.GetLobbyById(lobby.ID)
+			errs[i] = lob.FillSubstitute(players[i+1], 0)
+		}(i)
+	}
+	wg.Wait()
+
+	filled := 0
+	for _, err := range errs {
+		if err == nil {
+			filled++
+		}
+	}
+	assert.Equal(t, 1, filled)
+	assert.Equal(t, 1, lobby.GetPlayerNumber())
+	assert.False(t, lobby.IsSubstituteNeeded(0))
+}
+
+func TestLobbyServerRecovery(t *testing.T) {
+	migrations.TestCleanup()
+	lobby := models.NewLobby("cp_badlands", models.LobbyTypeSixes, models.ServerRecord{}, 0)
+	lobby.Save()
+	assert.Nil(t, lobby.SetState(models.LobbyStateWaiting, "server set up", 0))
+
+	player, playErr := models.NewPlayer("76561197999073985")
+	assert.Nil(t, playErr)
+	player.Save()
+	assert.Nil(t, lobby.AddPlayer(player, 0))
+
+	password := lobby.Server.ServerPassword
+	assert.NotEqual(t, "", password)
+
+	// restart
+	models.Servers.Shutdown()
+	_, ok := models.Servers.Get(lobby.ID)
+	assert.False(t, ok)
+
+	models.RecoverLobbyServers()
+	server, ok := models.Servers.Get(lobby.ID)
+	assert.True(t, ok)
+	assert.Equal(t, password, server.ServerPassword)
+	assert.True(t, server.IsPlayerAllowed(player.SteamId))
+
+	lobby2, _ := models.GetLobbyById(lobby.ID)
+	assert.Equal(t, server, lobby2.Server)
+	assert.Equal(t, player.SteamId, lobby2.ServerAllowedPlayers)
+	assert.False(t, lobby2.LogsPartial)
+
+	// the password isn't stored in cleartext
+	var stored string
+	db.DB.Raw("SELECT server_password FROM lobbies WHERE id = ?", lobby.ID).Row().Scan(&stored)
+	assert.NotEqual(t, password, stored)
+	assert.Equal(t, password, string(lobby2.ServerPassword))
+
+	// the logs from before the restart are lost once the match started
+	assert.Nil(t, lobby2.SetState(models.LobbyStateReadyingUp, "test", 0))
+	assert.Nil(t, lobby2.SetState(models.LobbyStateInProgress, "test", 0))
+	models.Servers.Shutdown()
+	models.RecoverLobbyServers()
+
+	server, _ = models.Servers.Get(lobby.ID)
+	assert.True(t, server.LogsPartial)
+	lobby3, _ := models.GetLobbyById(lobby.ID)
+	assert.True(t, lobby3.LogsPartial)
+}
+
+func TestLobbyServerLease(t *testing.T) {
+	migrations.TestCleanup()
+	models.Servers.Shutdown()
+
+	// the lobby's server belongs to another instance
+	assert.True(t, models.AcquireLease("lobby_server_1", "another instance", time.Minute))
+
+	lobby := models.NewLobby("cp_badlands", models.LobbyTypeSixes, models.ServerRecord{}, 0)
+	lobby.Save()
+	assert.Equal(t, uint(1), lobby.ID)
+	assert.Nil(t, lobby.Server)
+	assert.Equal(t, 0, models.Servers.Len())
+	assert.NotNil(t, lobby.TrySettingUp())
+
+	// taken over once it's given up
+	models.ReleaseLease("lobby_server_1", "another instance")
+	lobby2, _ := models.GetLobbyById(lobby.ID)
+	assert.NotNil(t, lobby2.Server)
+	assert.Equal(t, config.Constants.InstanceId, models.GetLeaseOwner("lobby_server_1"))
+}
@@ -0,0 +1,199 @@
+package models
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TF2Stadium/Helen/config"
+	"github.com/TF2Stadium/Helen/helpers"
+)
+
+// the address game servers send their logs to (logaddress_add)
+var ServerLogListener *LogListener
+
+type LogHandler func(*LogEvent)
+
+// LogListener receives srcds logs over UDP
+//
+// every server gets a different sv_logsecret, which is used to route
+// the log lines to the server's handler
+type LogListener struct {
+	conn *net.UDPConn
+
+	mutex    sync.RWMutex
+	handlers map[string]LogHandler // sv_logsecret -> handler
+}
+
+var logPacketHeader = []byte{0xff, 0xff, 0xff, 0xff}
+
+func InitLogListener() error {
+	var err error
+	ServerLogListener, err = NewLogListener(config.Constants.LogListenAddress)
+
+	if err != nil {
+		helpers.Logger.Warning("[LogListener]: Failed to listen on %s: %s", config.Constants.LogListenAddress, err.Error())
+		return err
+	}
+
+	helpers.Logger.Debug("[LogListener]: Listening for server logs on " + ServerLogListener.Addr().String())
+	return nil
+}
+
+func NewLogListener(address string) (*LogListener, error) {
+	addr, err := net.ResolveUDPAddr("udp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := net.ListenUDP("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &LogListener{
+		conn:     conn,
+		handlers: make(map[string]LogHandler),
+	}
+	go l.listen()
+
+	return l, nil
+}
+
+func (l *LogListener) Addr() net.Addr {
+	return l.conn.LocalAddr()
+}
+
+func (l *LogListener) Close() error {
+	return l.conn.Close()
+}
+
+func (l *LogListener) Register(secret string, handler LogHandler) {
+	l.mutex.Lock()
+	l.handlers[secret] = handler
+	l.mutex.Unlock()
+}
+
+func (l *LogListener) Unregister(secret string) {
+	l.mutex.Lock()
+	delete(l.handlers, secret)
+	l.mutex.Unlock()
+}
+
+// HandleLine parses the line and passes it to the handler registered with secret
+func (l *LogListener) HandleLine(secret string, line string) {
+	l.mutex.RLock()
+	handler, ok := l.handlers[secret]
+	l.mutex.RUnlock()
+
+	if !ok {
+		return
+	}
+
+	event, err := ParseLogLine(line)
+	if err != nil {
+		helpers.Logger.Debug("[LogListener]: %s -> %s", err.Error(), line)
+		return
+	}
+
+	handler(event)
+}
+
+func (l *LogListener) listen() {
+	buf := make([]byte, 2048)
+
+	for {
+		n, _, err := l.conn.ReadFromUDP(buf)
+		if err != nil {
+			if strings.Contains(err.Error(), "use of closed network connection") {
+				return
+			}
+			helpers.Logger.Warning("[LogListener]: %s", err.Error())
+			continue
+		}
+
+		secret, line, ok := parseLogPacket(buf[:n])
+		if !ok {
+			continue
+		}
+
+		l.HandleLine(secret, line)
+	}
+}
+
+// srcds log packets look like this:
+// without sv_logsecret -> "\xff\xff\xff\xffRL 10/17/2015 - 21:38:05: ...\n\x00"
+// with sv_logsecret    -> "\xff\xff\xff\xffS<secret>L 10/17/2015 - 21:38:05: ...\n\x00"
+func parseLogPacket(packet []byte) (string, string, bool) {
+	if !bytes.HasPrefix(packet, logPacketHeader) || len(packet) < 6 {
+		return "", "", false
+	}
+
+	data := strings.TrimRight(string(packet[len(logPacketHeader):]), "\x00\r\n")
+	if len(data) == 0 {
+		return "", "", false
+	}
+
+	switch data[0] {
+	case 'R':
+		return "", data[1:], true
+	case 'S':
+		idx := strings.Index(data, "L ")
+		if idx == -1 {
+			return "", "", false
+		}
+		return data[1:idx], data[idx:], true
+	}
+
+	return "", "", false
+}
+
+func buildLogPacket(secret string, line string) []byte {
+	var buf bytes.Buffer
+	buf.Write(logPacketHeader)
+
+	if secret == "" {
+		buf.WriteByte('R')
+	} else {
+		buf.WriteByte('S')
+		buf.WriteString(secret)
+	}
+
+	buf.WriteString(line)
+	buf.WriteString("\n\x00")
+
+	return buf.Bytes()
+}
+
+// ReplayLog sends every line from r to the listener at address,
+// the same way a game server with the given sv_logsecret would.
+// Useful for testing the lobby flow with recorded match logs.
+func ReplayLog(r io.Reader, address string, secret string, delay time.Duration) error {
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		if _, err := conn.Write(buildLogPacket(secret, line)); err != nil {
+			return err
+		}
+
+		if delay > 0 {
+			time.Sleep(delay)
+		}
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,164 @@
+package models
+
+import (
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TF2Stadium/Helen/helpers"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	helpers.InitLogger()
+}
+
+func TestParseLogLine(t *testing.T) {
+	e, err := ParseLogLine(`L 10/17/2015 - 21:31:00: World triggered "Round_Start"`)
+	assert.Nil(t, err)
+	assert.Equal(t, LogEventRoundStart, e.Type)
+	assert.Equal(t, 21, e.Time.Hour())
+
+	e, err = ParseLogLine(`L 10/17/2015 - 21:35:42: World triggered "Round_Win" (winner "Red")`)
+	assert.Nil(t, err)
+	assert.Equal(t, LogEventRoundWin, e.Type)
+	assert.Equal(t, "Red", e.Team)
+
+	e, err = ParseLogLine(`L 10/17/2015 - 21:42:00: World triggered "Game_Over" reason "Reached Win Limit"`)
+	assert.Nil(t, err)
+	assert.Equal(t, LogEventGameOver, e.Type)
+	assert.Equal(t, "Reached Win Limit", e.Message)
+
+	e, err = ParseLogLine(`L 10/17/2015 - 21:30:12: "Nonagono<2><[U:1:38808257]><>" connected, address "10.0.0.2:27005"`)
+	assert.Nil(t, err)
+	assert.Equal(t, LogEventPlayerConnected, e.Type)
+	assert.Equal(t, "Nonagono", e.Player.Name)
+	assert.Equal(t, 2, e.Player.UserId)
+	assert.Equal(t, "76561197999073985", e.Player.CommId)
+
+	e, err = ParseLogLine(`L 10/17/2015 - 21:41:20: "Kevin<3><[U:1:12345]><Blue>" disconnected (reason "Disconnect")`)
+	assert.Nil(t, err)
+	assert.Equal(t, LogEventPlayerDisconnected, e.Type)
+	assert.Equal(t, "Blue", e.Player.Team)
+	assert.Equal(t, "Disconnect", e.Message)
+
+	e, err = ParseLogLine(`L 10/17/2015 - 21:30:22: "Kevin<3><[U:1:12345]><Blue>" say_team "go "go" go"`)
+	assert.Nil(t, err)
+	assert.Equal(t, LogEventSay, e.Type)
+	assert.True(t, e.TeamOnly)
+	assert.Equal(t, `go "go" go`, e.Message)
+
+	e, err = ParseLogLine(`L 10/17/2015 - 21:30:01: Loading map "cp_badlands"`)
+	assert.Nil(t, err)
+	assert.Equal(t, LogEventUnknown, e.Type)
+
+	_, err = ParseLogLine("garbage")
+	assert.NotNil(t, err)
+}
+
+func TestParseLogPacket(t *testing.T) {
+	line := `L 10/17/2015 - 21:31:00: World triggered "Round_Start"`
+
+	secret, parsed, ok := parseLogPacket(buildLogPacket("1234", line))
+	assert.True(t, ok)
+	assert.Equal(t, "1234", secret)
+	assert.Equal(t, line, parsed)
+
+	secret, parsed, ok = parseLogPacket(buildLogPacket("", line))
+	assert.True(t, ok)
+	assert.Equal(t, "", secret)
+	assert.Equal(t, line, parsed)
+
+	_, _, ok = parseLogPacket([]byte("RL hello"))
+	assert.False(t, ok)
+
+	// only the header and padding
+	_, _, ok = parseLogPacket(append(append([]byte(nil), logPacketHeader...), "\n\x00\x00"...))
+	assert.False(t, ok)
+}
+
+func TestLogListenerEmptyPacket(t *testing.T) {
+	listener, err := NewLogListener("127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	events := make(chan *LogEvent, 1)
+	listener.Register("1234", func(e *LogEvent) {
+		events <- e
+	})
+
+	conn, err := net.Dial("udp", listener.Addr().String())
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	packet := append(append([]byte(nil), logPacketHeader...), "\x00\r\n"...)
+	_, err = conn.Write(packet)
+	assert.Nil(t, err)
+
+	// the listener is still running
+	line := `L 10/17/2015 - 21:31:00: World triggered "Round_Start"`
+	err = ReplayLog(strings.NewReader(line), listener.Addr().String(), "1234", 0)
+	assert.Nil(t, err)
+
+	select {
+	case e := <-events:
+		assert.Equal(t, LogEventRoundStart, e.Type)
+	case <-time.After(5 * time.Second):
+		t.Fatal("The listener stopped after an empty packet")
+	}
+}
+
+func TestLogListenerReplay(t *testing.T) {
+	listener, err := NewLogListener("127.0.0.1:0")
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	events := make(chan *LogEvent, 32)
+	listener.Register("1234", func(e *LogEvent) {
+		events <- e
+	})
+
+	// logs from other servers should be ignored
+	listener.Register("4321", func(e *LogEvent) {
+		t.Error("Received a log line with the wrong secret")
+	})
+
+	file, err := os.Open("testdata/logs/match.log")
+	assert.Nil(t, err)
+	defer file.Close()
+
+	err = ReplayLog(file, listener.Addr().String(), "1234", time.Millisecond)
+	assert.Nil(t, err)
+
+	var received []LogEventType
+	timeout := time.After(5 * time.Second)
+
+	for len(received) < 14 {
+		select {
+		case e := <-events:
+			received = append(received, e.Type)
+		case <-timeout:
+			t.Fatalf("Only received %d log lines", len(received))
+		}
+	}
+
+	expected := []LogEventType{
+		LogEventUnknown,
+		LogEventUnknown,
+		LogEventPlayerConnected,
+		LogEventPlayerConnected,
+		LogEventSay,
+		LogEventSay,
+		LogEventRoundStart,
+		LogEventRoundWin,
+		LogEventUnknown,
+		LogEventRoundStart,
+		LogEventRoundWin,
+		LogEventPlayerDisconnected,
+		LogEventGameOver,
+		LogEventUnknown,
+	}
+	assert.Equal(t, expected, received)
+}
@@ -0,0 +1,119 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"time"
+
+	"github.com/TF2Stadium/Helen/config"
+	"github.com/TF2Stadium/Helen/helpers"
+)
+
+const (
+	logsUploadRetries  = 3
+	logsTitleMaxLength = 40 // logs.tf won't accept longer titles
+)
+
+var logsUploadRetryDelay = 10 * time.Second
+
+// response from logs.tf/upload
+type logsUploadResponse struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error"`
+	LogId   int    `json:"log_id"`
+	Url     string `json:"url"`
+}
+
+func LogsTitle(lobbyId uint, mapName string) string {
+	return logsTitle(lobbyId, mapName, "")
+}
+
+// PartialLogsTitle is the title of logs that miss the beginning of the match
+func PartialLogsTitle(lobbyId uint, mapName string) string {
+	return logsTitle(lobbyId, mapName, " (partial)")
+}
+
+// the suffix is kept when the title is too long
+func logsTitle(lobbyId uint, mapName string, suffix string) string {
+	title := fmt.Sprintf("TF2Stadium #%d: %s", lobbyId, mapName)
+
+	if len(title)+len(suffix) > logsTitleMaxLength {
+		title = title[:logsTitleMaxLength-len(suffix)]
+	}
+
+	return title + suffix
+}
+
+// UploadLogs uploads the logs to config.Constants.LogsUploadUrl,
+// retrying if the upload fails. Returns the log id
+func UploadLogs(logs []byte, title string, mapName string) (int, error) {
+	var err error
+
+	for i := 0; i < logsUploadRetries; i++ {
+		if i != 0 {
+			time.Sleep(logsUploadRetryDelay)
+		}
+
+		var logId int
+		var retry bool
+		logId, retry, err = uploadLogs(logs, title, mapName)
+
+		if err == nil {
+			return logId, nil
+		}
+
+		helpers.Logger.Warning("[UploadLogs]: Failed to upload logs (attempt %d): %s", i+1, err.Error())
+
+		if !retry {
+			break
+		}
+	}
+
+	return 0, err
+}
+
+// returns the log id, and if the upload should be retried in case of error
+func uploadLogs(logs []byte, title string, mapName string) (int, bool, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	writer.WriteField("title", title)
+	writer.WriteField("map", mapName)
+	writer.WriteField("key", config.Constants.LogsApiKey)
+	writer.WriteField("uploader", "TF2Stadium")
+
+	file, err := writer.CreateFormFile("logfile", "log.log")
+	if err != nil {
+		return 0, false, err
+	}
+	file.Write(logs)
+
+	if err := writer.Close(); err != nil {
+		return 0, false, err
+	}
+
+	resp, err := http.Post(config.Constants.LogsUploadUrl, writer.FormDataContentType(), &body)
+	if err != nil {
+		return 0, true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 500 {
+		return 0, true, errors.New(resp.Status)
+	}
+
+	var result logsUploadResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, true, err
+	}
+
+	if !result.Success {
+		return 0, false, errors.New(result.Error)
+	}
+
+	return result.LogId, false, nil
+}
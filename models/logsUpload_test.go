@@ -0,0 +1,85 @@
+package models
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TF2Stadium/Helen/config"
+	"github.com/TF2Stadium/Helen/helpers"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	helpers.InitLogger()
+}
+
+func TestLogsTitle(t *testing.T) {
+	assert.Equal(t, "TF2Stadium #12: cp_badlands", LogsTitle(12, "cp_badlands"))
+	assert.Equal(t, 40, len(LogsTitle(12, "cp_a_very_long_map_name_that_nobody_plays")))
+
+	assert.Equal(t, "TF2Stadium #12: cp_badlands (partial)", PartialLogsTitle(12, "cp_badlands"))
+	title := PartialLogsTitle(12, "cp_a_very_long_map_name_that_nobody_plays")
+	assert.Equal(t, 40, len(title))
+	assert.True(t, strings.HasSuffix(title, " (partial)"))
+}
+
+func TestUploadLogs(t *testing.T) {
+	config.SetupConstants()
+	config.Constants.LogsApiKey = "testkey"
+	logsUploadRetryDelay = time.Millisecond
+
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+
+		// the first upload fails, should be retried
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		assert.Equal(t, "TF2Stadium #1: cp_badlands", r.FormValue("title"))
+		assert.Equal(t, "cp_badlands", r.FormValue("map"))
+		assert.Equal(t, "testkey", r.FormValue("key"))
+
+		file, _, err := r.FormFile("logfile")
+		assert.Nil(t, err)
+		logs, _ := ioutil.ReadAll(file)
+		assert.Equal(t, "L 10/17/2015 - 21:31:00: World triggered \"Round_Start\"\n", string(logs))
+
+		fmt.Fprint(w, `{"success": true, "log_id": 1337, "url": "/1337"}`)
+	}))
+	defer server.Close()
+	config.Constants.LogsUploadUrl = server.URL
+
+	logs := []byte("L 10/17/2015 - 21:31:00: World triggered \"Round_Start\"\n")
+	logId, err := UploadLogs(logs, LogsTitle(1, "cp_badlands"), "cp_badlands")
+	assert.Nil(t, err)
+	assert.Equal(t, 1337, logId)
+	assert.Equal(t, 2, attempts)
+}
+
+func TestUploadLogsRejected(t *testing.T) {
+	config.SetupConstants()
+	logsUploadRetryDelay = time.Millisecond
+
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		fmt.Fprint(w, `{"success": false, "error": "Invalid API key"}`)
+	}))
+	defer server.Close()
+	config.Constants.LogsUploadUrl = server.URL
+
+	_, err := UploadLogs([]byte("logs"), "title", "cp_badlands")
+	assert.NotNil(t, err)
+	assert.Equal(t, "Invalid API key", err.Error())
+
+	// no point in retrying if the upload was rejected
+	assert.Equal(t, 1, attempts)
+}
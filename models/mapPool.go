@@ -0,0 +1,297 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TF2Stadium/Helen/config"
+	db "github.com/TF2Stadium/Helen/database"
+	"github.com/TF2Stadium/Helen/helpers"
+)
+
+var mapNameValid = regexp.MustCompile("^[a-z0-9_]+$")
+
+// the maps.json entries ImportMapsJson skipped, so they're only warned about once
+var (
+	importSkipped      = make(map[string]bool)
+	importSkippedMutex sync.Mutex
+)
+
+// warns about a skipped maps.json entry the first time, after that it's only logged for debugging
+func warnImportSkipped(format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+
+	importSkippedMutex.Lock()
+	warned := importSkipped[msg]
+	importSkipped[msg] = true
+	importSkippedMutex.Unlock()
+
+	if warned {
+		helpers.Logger.Debug("[MapPool.Import]: %s", msg)
+	} else {
+		helpers.Logger.Warning("[MapPool.Import]: %s", msg)
+	}
+}
+
+// a map in the map pool. Lobbies can only be created on maps that aren't retired
+type GameMap struct {
+	ID        uint
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	Name    string `sql:"not null;unique"`
+	Retired bool   // kept for the lobbies that were played on it
+
+	Modes []GameMapMode
+}
+
+// the game mode a map is played with, for a format and league
+type GameMapMode struct {
+	ID        uint
+	GameMapId uint
+
+	Format string // as in maps.json, see Format.MapsKey
+	League League
+	Mode   string // one of the league's modes in leagues.json, example: koth
+}
+
+func (mode *GameMapMode) validate() *helpers.TPError {
+	if !IsLeagueValid(mode.League) {
+		return helpers.NewTPError("League invalid: "+string(mode.League), -1)
+	}
+
+	format, ok := GetConfigManifest()[mode.League].Formats[mode.Format]
+	if !ok {
+		return helpers.NewTPError(string(mode.League)+" doesn't have "+mode.Format+" configs", -1)
+	}
+
+	if _, ok := format.Modes[mode.Mode]; !ok {
+		return helpers.NewTPError(string(mode.League)+" "+mode.Format+" doesn't have a "+mode.Mode+" config", -1)
+	}
+
+	return nil
+}
+
+func validateMapModes(modes []GameMapMode) *helpers.TPError {
+	if len(modes) == 0 {
+		return helpers.NewTPError("The map needs at least one mode", -1)
+	}
+
+	for i := range modes {
+		if tperr := modes[i].validate(); tperr != nil {
+			return tperr
+		}
+	}
+
+	return nil
+}
+
+// AddMap adds a map to the pool with the modes it can be played with
+func AddMap(name string, modes []GameMapMode) (*GameMap, *helpers.TPError) {
+	if !mapNameValid.MatchString(name) {
+		return nil, helpers.NewTPError("Map name invalid", -1)
+	}
+
+	if tperr := validateMapModes(modes); tperr != nil {
+		return nil, tperr
+	}
+
+	if _, err := GetMapByName(name); err == nil {
+		return nil, helpers.NewTPError("The map is already in the pool", -1)
+	}
+
+	gameMap := &GameMap{Name: name, Modes: modes}
+	if err := db.DB.Create(gameMap).Error; err != nil {
+		return nil, helpers.NewTPError(err.Error(), -1)
+	}
+
+	LoadMapPool()
+	return gameMap, nil
+}
+
+func GetMapByName(name string) (*GameMap, error) {
+	gameMap := &GameMap{}
+	err := db.DB.Preload("Modes").Where("name = ?", name).First(gameMap).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return gameMap, nil
+}
+
+// GetMaps returns the maps in the pool, sorted by name
+func GetMaps(withRetired bool) ([]GameMap, error) {
+	var maps []GameMap
+
+	query := db.DB.Preload("Modes").Order("name")
+	if !withRetired {
+		query = query.Where("retired = ?", false)
+	}
+	err := query.Find(&maps).Error
+
+	return maps, err
+}
+
+// SetModes replaces the modes the map can be played with
+func (gameMap *GameMap) SetModes(modes []GameMapMode) *helpers.TPError {
+	if tperr := validateMapModes(modes); tperr != nil {
+		return tperr
+	}
+
+	tx := db.DB.Begin()
+	if err := tx.Where("game_map_id = ?", gameMap.ID).Delete(&GameMapMode{}).Error; err != nil {
+		tx.Rollback()
+		return helpers.NewTPError(err.Error(), -1)
+	}
+
+	for i := range modes {
+		modes[i].ID = 0
+		modes[i].GameMapId = gameMap.ID
+		if err := tx.Create(&modes[i]).Error; err != nil {
+			tx.Rollback()
+			return helpers.NewTPError(err.Error(), -1)
+		}
+	}
+	if err := tx.Commit().Error; err != nil {
+		return helpers.NewTPError(err.Error(), -1)
+	}
+
+	gameMap.Modes = modes
+	LoadMapPool()
+	return nil
+}
+
+// SetRetired takes the map out of the pool, or puts it back
+func (gameMap *GameMap) SetRetired(retired bool) *helpers.TPError {
+	err := db.DB.Model(gameMap).UpdateColumn("retired", retired).Error
+	if err != nil {
+		return helpers.NewTPError(err.Error(), -1)
+	}
+
+	gameMap.Retired = retired
+	return nil
+}
+
+// IsMapInPool returns true if lobbies of the type can be created on the map with the league's configs
+func IsMapInPool(name string, lobbyType LobbyType, league League) bool {
+	format := GetFormat(lobbyType)
+	if format == nil {
+		return false
+	}
+
+	count := 0
+	db.DB.Table("game_maps").
+		Joins("INNER JOIN game_map_modes ON game_map_modes.game_map_id = game_maps.id").
+		Where("game_maps.name = ? AND game_maps.retired = ? AND game_map_modes.format = ? AND game_map_modes.league = ?",
+			name, false, format.MapsKey(), league).
+		Count(&count)
+
+	return count > 0
+}
+
+// LoadMapPool replaces maps.json with the maps in the database, retired ones included
+// so the lobbies played on them still get their configs
+func LoadMapPool() error {
+	maps, err := GetMaps(true)
+	if err != nil {
+		return err
+	}
+
+	data := make(map[string]map[string]map[League]string)
+	for _, gameMap := range maps {
+		data[gameMap.Name] = make(map[string]map[League]string)
+
+		for _, mode := range gameMap.Modes {
+			if data[gameMap.Name][mode.Format] == nil {
+				data[gameMap.Name][mode.Format] = make(map[League]string)
+			}
+			data[gameMap.Name][mode.Format][mode.League] = mode.Mode
+		}
+	}
+
+	setMapPoolData(data)
+	return nil
+}
+
+// ImportMapsJson adds the maps in a maps.json file that aren't in the pool yet, the
+// maps that are keep their modes. Modes the league configs don't have are skipped.
+// Returns the number of maps added
+func ImportMapsJson(path string) (int, error) {
+	file, err := ioutil.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+
+	var data map[string]map[string]map[League]string
+	if err := json.Unmarshal(file, &data); err != nil {
+		return 0, err
+	}
+
+	// sorted, so the ids are the same every time
+	var names []string
+	for name := range data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	added := 0
+	var skipped []string
+	for _, name := range names {
+		if _, err := GetMapByName(name); err == nil {
+			skipped = append(skipped, name)
+			continue
+		}
+
+		var modes []GameMapMode
+		for format, leagues := range data[name] {
+			for league, modeName := range leagues {
+				mode := GameMapMode{Format: format, League: league, Mode: modeName}
+				if tperr := mode.validate(); tperr != nil {
+					warnImportSkipped("Skipping %s %s %s: %s", name, league, format, tperr.Error())
+					continue
+				}
+				modes = append(modes, mode)
+			}
+		}
+
+		if len(modes) == 0 {
+			warnImportSkipped("Skipping %s, no mode can be played", name)
+			continue
+		}
+
+		if _, tperr := AddMap(name, modes); tperr != nil {
+			return added, tperr
+		}
+		added++
+	}
+
+	// expected on every reload, the admins edit the maps in the pool
+	if len(skipped) != 0 {
+		helpers.Logger.Debug("[MapPool.Import]: Skipped %d maps already in the pool, change them with /admin/maps: %s",
+			len(skipped), strings.Join(skipped, ", "))
+	}
+
+	return added, nil
+}
+
+// InitMapPool fills an empty map pool from maps.json, and loads it
+func InitMapPool() error {
+	count := 0
+	db.DB.Model(&GameMap{}).Count(&count)
+
+	if count == 0 {
+		added, err := ImportMapsJson(config.Constants.StaticFileLocation + ConfigsPath + MapsFile)
+		if err != nil {
+			return err
+		}
+		helpers.Logger.Debug("[MapPool.Init]: Imported %d maps from %s", added, MapsFile)
+	}
+
+	return LoadMapPool()
+}
@@ -0,0 +1,100 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/TF2Stadium/Helen/config"
+	"github.com/TF2Stadium/Helen/database/migrations"
+	"github.com/TF2Stadium/Helen/helpers"
+	"github.com/TF2Stadium/Helen/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	helpers.InitLogger()
+}
+
+func TestMapPool(t *testing.T) {
+	migrations.TestCleanup()
+	models.InitServerConfigs()
+
+	_, tperr := models.AddMap("koth_product_rc8", []models.GameMapMode{
+		{Format: "6v6", League: models.LeagueEtf2l, Mode: "koth"},
+		{Format: "9v9", League: models.LeagueUgc, Mode: "koth"},
+	})
+	assert.Nil(t, tperr)
+
+	assert.True(t, models.IsMapInPool("koth_product_rc8", models.LobbyTypeSixes, models.LeagueEtf2l))
+	assert.True(t, models.IsMapInPool("koth_product_rc8", models.LobbyTypeFours, models.LeagueEtf2l))
+	assert.True(t, models.IsMapInPool("koth_product_rc8", models.LobbyTypeProlander, models.LeagueUgc))
+	assert.False(t, models.IsMapInPool("koth_product_rc8", models.LobbyTypeSixes, models.LeagueUgc))
+	assert.False(t, models.IsMapInPool("cp_granary", models.LobbyTypeSixes, models.LeagueEtf2l))
+
+	// the server configs use the pool
+	assert.Equal(t, "koth", models.GetMapModes("koth_product_rc8")["9v9"][models.LeagueUgc])
+
+	gameMap, err := models.GetMapByName("koth_product_rc8")
+	assert.Nil(t, err)
+	assert.Len(t, gameMap.Modes, 2)
+
+	assert.Nil(t, gameMap.SetModes([]models.GameMapMode{{Format: "6v6", League: models.LeagueUgc, Mode: "koth"}}))
+	assert.True(t, models.IsMapInPool("koth_product_rc8", models.LobbyTypeSixes, models.LeagueUgc))
+	assert.False(t, models.IsMapInPool("koth_product_rc8", models.LobbyTypeSixes, models.LeagueEtf2l))
+
+	assert.Nil(t, gameMap.SetRetired(true))
+	assert.False(t, models.IsMapInPool("koth_product_rc8", models.LobbyTypeSixes, models.LeagueUgc))
+
+	maps, _ := models.GetMaps(false)
+	assert.Len(t, maps, 0)
+	maps, _ = models.GetMaps(true)
+	assert.Len(t, maps, 1)
+
+	assert.Nil(t, gameMap.SetRetired(false))
+	assert.True(t, models.IsMapInPool("koth_product_rc8", models.LobbyTypeSixes, models.LeagueUgc))
+}
+
+func TestMapPoolValidation(t *testing.T) {
+	migrations.TestCleanup()
+	models.InitServerConfigs()
+
+	_, tperr := models.AddMap("koth_product_rc8", nil)
+	assert.NotNil(t, tperr)
+
+	_, tperr = models.AddMap("koth product", []models.GameMapMode{{Format: "6v6", League: models.LeagueEtf2l, Mode: "koth"}})
+	assert.NotNil(t, tperr)
+
+	// no such league, format or mode
+	_, tperr = models.AddMap("koth_product_rc8", []models.GameMapMode{{Format: "6v6", League: "esea", Mode: "koth"}})
+	assert.NotNil(t, tperr)
+	_, tperr = models.AddMap("koth_product_rc8", []models.GameMapMode{{Format: "ultiduo", League: models.LeagueUgc, Mode: "ultiduo"}})
+	assert.NotNil(t, tperr)
+	_, tperr = models.AddMap("koth_product_rc8", []models.GameMapMode{{Format: "6v6", League: models.LeagueEtf2l, Mode: "rc5"}})
+	assert.NotNil(t, tperr)
+
+	_, tperr = models.AddMap("koth_product_rc8", []models.GameMapMode{{Format: "6v6", League: models.LeagueEtf2l, Mode: "koth"}})
+	assert.Nil(t, tperr)
+	_, tperr = models.AddMap("koth_product_rc8", []models.GameMapMode{{Format: "6v6", League: models.LeagueEtf2l, Mode: "koth"}})
+	assert.NotNil(t, tperr)
+}
+
+func TestMapPoolImport(t *testing.T) {
+	migrations.TestCleanup()
+	models.InitServerConfigs()
+
+	path := config.Constants.StaticFileLocation + models.ConfigsPath + models.MapsFile
+	added, err := models.ImportMapsJson(path)
+	assert.Nil(t, err)
+	assert.NotEqual(t, 0, added)
+
+	assert.True(t, models.IsMapInPool("cp_badlands", models.LobbyTypeSixes, models.LeagueEtf2l))
+	assert.True(t, models.IsMapInPool("koth_ultiduo_r_b7", models.LobbyTypeUltiduo, models.LeagueEtf2l))
+
+	// etf2l doesn't have an rc5 config
+	assert.False(t, models.IsMapInPool("cp_metalworks_rc7", models.LobbyTypeSixes, models.LeagueEtf2l))
+	assert.True(t, models.IsMapInPool("cp_metalworks_rc7", models.LobbyTypeSixes, models.LeagueUgc))
+
+	// the maps already in the pool are skipped
+	added, err = models.ImportMapsJson(path)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, added)
+}
@@ -0,0 +1,190 @@
+package models
+
+import (
+	"sync"
+	"time"
+)
+
+// stats for a single player, while the match is running
+type playerMatchStats struct {
+	LobbyPlayerStats
+
+	active bool      // player is in the server
+	since  time.Time // when we started counting time played
+
+	class      string
+	classSince time.Time
+	classTime  map[string]time.Duration
+
+	played time.Duration
+}
+
+// matchStats collects the players' stats from a server's logs
+//
+// only events between the first round start and game over are counted,
+// so warmup kills don't show up in the stats
+type matchStats struct {
+	mutex   sync.Mutex
+	started bool
+	ended   bool
+	players map[string]*playerMatchStats // commid -> stats
+}
+
+func newMatchStats() *matchStats {
+	return &matchStats{players: make(map[string]*playerMatchStats)}
+}
+
+func (m *matchStats) player(p LogPlayer, t time.Time) *playerMatchStats {
+	if p.CommId == "" {
+		return nil
+	}
+
+	ps, ok := m.players[p.CommId]
+	if !ok {
+		ps = &playerMatchStats{classTime: make(map[string]time.Duration)}
+		m.players[p.CommId] = ps
+	}
+
+	if !ps.active {
+		ps.active = true
+		ps.since = t
+		ps.classSince = t
+	}
+
+	return ps
+}
+
+// stops counting the player's time played
+func (m *matchStats) stopClock(ps *playerMatchStats, t time.Time) {
+	if !ps.active {
+		return
+	}
+
+	if m.started {
+		ps.played += t.Sub(ps.since)
+		if ps.class != "" {
+			ps.classTime[ps.class] += t.Sub(ps.classSince)
+		}
+	}
+	ps.active = false
+}
+
+func (m *matchStats) HandleEvent(e *LogEvent) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.ended {
+		return
+	}
+
+	switch e.Type {
+	case LogEventRoundStart:
+		if m.started {
+			return
+		}
+
+		// the match starts now, don't count the warmup
+		m.started = true
+		for _, ps := range m.players {
+			ps.since = e.Time
+			ps.classSince = e.Time
+		}
+
+	case LogEventGameOver:
+		for _, ps := range m.players {
+			m.stopClock(ps, e.Time)
+		}
+		m.ended = true
+
+	case LogEventPlayerConnected:
+		m.player(e.Player, e.Time)
+
+	case LogEventPlayerDisconnected:
+		if ps := m.player(e.Player, e.Time); ps != nil {
+			m.stopClock(ps, e.Time)
+		}
+
+	case LogEventClassChange:
+		ps := m.player(e.Player, e.Time)
+		if ps == nil || ps.class == e.Class {
+			return
+		}
+
+		if m.started && ps.class != "" {
+			ps.classTime[ps.class] += e.Time.Sub(ps.classSince)
+		}
+		ps.class = e.Class
+		ps.classSince = e.Time
+	}
+
+	if !m.started {
+		return
+	}
+
+	switch e.Type {
+	case LogEventKill:
+		if ps := m.player(e.Player, e.Time); ps != nil {
+			ps.Kills++
+		}
+		if ps := m.player(e.Target, e.Time); ps != nil {
+			ps.Deaths++
+		}
+
+	case LogEventSuicide:
+		if ps := m.player(e.Player, e.Time); ps != nil {
+			ps.Deaths++
+		}
+
+	case LogEventKillAssist:
+		if ps := m.player(e.Player, e.Time); ps != nil {
+			ps.Assists++
+		}
+
+	case LogEventDamage:
+		if ps := m.player(e.Player, e.Time); ps != nil {
+			ps.Damage += e.Amount
+		}
+
+	case LogEventHeal:
+		if ps := m.player(e.Player, e.Time); ps != nil {
+			ps.Heals += e.Amount
+		}
+
+	case LogEventChargeDeployed:
+		if ps := m.player(e.Player, e.Time); ps != nil {
+			ps.Ubers++
+		}
+
+	case LogEventMedicDeath:
+		if ps := m.player(e.Target, e.Time); ps != nil && e.Amount == 1 {
+			ps.Drops++
+		}
+	}
+}
+
+// Results returns the stats for every player seen in the logs, by commid
+func (m *matchStats) Results() map[string]LobbyPlayerStats {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	results := make(map[string]LobbyPlayerStats)
+
+	for commId, ps := range m.players {
+		stats := ps.LobbyPlayerStats
+		stats.TimePlayed = int(ps.played.Seconds())
+		stats.Class = ps.class
+
+		// the class the player spent the most time as
+		var max time.Duration
+		for class, d := range ps.classTime {
+			if d > max {
+				max = d
+				stats.Class = class
+			}
+		}
+
+		results[commId] = stats
+	}
+
+	return results
+}
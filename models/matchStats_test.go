@@ -0,0 +1,82 @@
+package models
+
+import (
+	"bufio"
+	"os"
+	"testing"
+
+	"github.com/TF2Stadium/Helen/helpers"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	helpers.InitLogger()
+}
+
+func TestParseStatsLogLines(t *testing.T) {
+	e, err := ParseLogLine(`L 10/17/2015 - 21:31:26: "Nonagono<2><[U:1:38808257]><Red>" killed "Kevin<3><[U:1:12345]><Blue>" with "scattergun" (attacker_position "1 2 3") (victim_position "4 5 6")`)
+	assert.Nil(t, err)
+	assert.Equal(t, LogEventKill, e.Type)
+	assert.Equal(t, "Nonagono", e.Player.Name)
+	assert.Equal(t, "Kevin", e.Target.Name)
+	assert.Equal(t, "scattergun", e.Weapon)
+
+	e, err = ParseLogLine(`L 10/17/2015 - 21:31:25: "Nonagono<2><[U:1:38808257]><Red>" triggered "damage" against "Kevin<3><[U:1:12345]><Blue>" (damage "62") (weapon "scattergun")`)
+	assert.Nil(t, err)
+	assert.Equal(t, LogEventDamage, e.Type)
+	assert.Equal(t, 62, e.Amount)
+	assert.Equal(t, "Kevin", e.Target.Name)
+
+	// older servers don't log the victim
+	e, err = ParseLogLine(`L 10/17/2015 - 21:31:25: "Nonagono<2><[U:1:38808257]><Red>" triggered "damage" (damage "62")`)
+	assert.Nil(t, err)
+	assert.Equal(t, LogEventDamage, e.Type)
+	assert.Equal(t, 62, e.Amount)
+	assert.Equal(t, "", e.Target.Name)
+
+	e, err = ParseLogLine(`L 10/17/2015 - 21:31:26: "Nonagono<2><[U:1:38808257]><Red>" triggered "medic_death" against "Kevin<3><[U:1:12345]><Blue>" (healing "1200") (ubercharge "1")`)
+	assert.Nil(t, err)
+	assert.Equal(t, LogEventMedicDeath, e.Type)
+	assert.Equal(t, 1, e.Amount)
+	assert.Equal(t, "Kevin", e.Target.Name)
+
+	e, err = ParseLogLine(`L 10/17/2015 - 21:31:20: "Kevin<3><[U:1:12345]><Blue>" spawned as "Medic"`)
+	assert.Nil(t, err)
+	assert.Equal(t, LogEventClassChange, e.Type)
+	assert.Equal(t, "medic", e.Class)
+}
+
+func TestMatchStats(t *testing.T) {
+	file, err := os.Open("testdata/logs/stats.log")
+	assert.Nil(t, err)
+	defer file.Close()
+
+	stats := newMatchStats()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		e, err := ParseLogLine(scanner.Text())
+		assert.Nil(t, err)
+		stats.HandleEvent(e)
+	}
+
+	results := stats.Results()
+	assert.Equal(t, 2, len(results))
+
+	scout := results["76561197999073985"]
+	// warmup and post game kills don't count
+	assert.Equal(t, 1, scout.Kills)
+	assert.Equal(t, 1, scout.Deaths)
+	assert.Equal(t, 150, scout.Damage)
+	// 60s as scout, 540s as soldier
+	assert.Equal(t, "soldier", scout.Class)
+	assert.Equal(t, 600, scout.TimePlayed)
+
+	medic := results["76561197960278073"]
+	assert.Equal(t, 1, medic.Deaths)
+	assert.Equal(t, 1, medic.Assists)
+	assert.Equal(t, 40, medic.Heals)
+	assert.Equal(t, 1, medic.Ubers)
+	assert.Equal(t, 1, medic.Drops)
+	assert.Equal(t, "medic", medic.Class)
+	assert.Equal(t, 300, medic.TimePlayed)
+}
@@ -0,0 +1,250 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/TF2Stadium/Helen/config"
+	db "github.com/TF2Stadium/Helen/database"
+	"github.com/TF2Stadium/Helen/helpers"
+	"github.com/TF2Stadium/Helen/helpers/mumble"
+)
+
+// team subchannels, in the lobby's channel
+var mumbleTeamChannels = []string{"RED", "BLU"}
+
+const mumbleUsernameMaxLength = 32
+
+var mumbleUsernameInvalid = regexp.MustCompile("[^a-zA-Z0-9_-]+")
+
+// a player's mumble login for a lobby
+type MumbleUser struct {
+	ID        uint
+	CreatedAt time.Time
+
+	LobbyId  uint
+	PlayerId uint
+	Username string
+	Password EncryptedString
+}
+
+func newMumbleClient() *mumble.Client {
+	return mumble.NewClient(config.Constants.MumbleAdminUrl, config.Constants.MumbleAdminKey)
+}
+
+func MumbleChannelName(lobbyId uint) string {
+	return fmt.Sprintf("match%d", lobbyId)
+}
+
+// player name + id, mumble usernames have to be unique
+func mumbleUsername(player *Player) string {
+	suffix := fmt.Sprintf("_%d", player.ID)
+	name := mumbleUsernameInvalid.ReplaceAllString(player.Name, "")
+
+	if len(name)+len(suffix) > mumbleUsernameMaxLength {
+		name = name[:mumbleUsernameMaxLength-len(suffix)]
+	}
+	return name + suffix
+}
+
+// SetupMumble creates the lobby's channel with the team subchannels
+func (lobby *Lobby) SetupMumble() error {
+	if config.Constants.MumbleMockUp {
+		return nil
+	}
+
+	client := newMumbleClient()
+
+	channel, err := client.CreateChannel(MumbleChannelName(lobby.ID), mumble.RootChannel)
+	if err != nil {
+		return err
+	}
+
+	lobby.MumbleChannelId = channel
+	db.DB.Model(lobby).UpdateColumn("mumble_channel_id", channel)
+
+	for _, team := range mumbleTeamChannels {
+		if _, err := client.CreateChannel(team, channel); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetMumbleUser returns the player's mumble login for the lobby, registering it the first time
+func (lobby *Lobby) GetMumbleUser(player *Player) (*MumbleUser, error) {
+	user := &MumbleUser{}
+	err := db.DB.Where("lobby_id = ? AND player_id = ?", lobby.ID, player.ID).First(user).Error
+	if err == nil {
+		return user, nil
+	}
+
+	randBytes := make([]byte, 12)
+	rand.Read(randBytes)
+
+	user = &MumbleUser{
+		LobbyId:  lobby.ID,
+		PlayerId: player.ID,
+		Username: mumbleUsername(player),
+		Password: EncryptedString(base64.URLEncoding.EncodeToString(randBytes)),
+	}
+
+	if !config.Constants.MumbleMockUp {
+		err := newMumbleClient().RegisterUser(user.Username, string(user.Password))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = db.DB.Create(user).Error
+	return user, err
+}
+
+// how long the users of a mumble channel are kept, the broadcaster refreshes
+// the channels of the lobbies that are getting ready more often than that
+var MumblePresenceCacheTime = 10 * time.Second
+
+type mumbleChannelEntry struct {
+	names   map[string]bool // usernames in the channel
+	fetched time.Time
+}
+
+var mumbleChannelCache = make(map[int]mumbleChannelEntry)
+var mumbleChannelCacheMutex sync.Mutex
+
+// the users in the channel, nil if they were never fetched or are older than maxAge
+func cachedMumbleChannel(channel int, maxAge time.Duration) map[string]bool {
+	mumbleChannelCacheMutex.Lock()
+	defer mumbleChannelCacheMutex.Unlock()
+
+	entry, ok := mumbleChannelCache[channel]
+	if !ok || time.Since(entry.fetched) > maxAge {
+		return nil
+	}
+	return entry.names
+}
+
+// RefreshMumblePresence gets the users in the lobby's channel from the mumble server.
+// Returns true if they changed since the last time
+func (lobby *Lobby) RefreshMumblePresence() (bool, error) {
+	if config.Constants.MumbleMockUp {
+		return false, nil
+	}
+
+	connected, err := newMumbleClient().ChannelUsers(lobby.MumbleChannelId)
+	if err != nil {
+		return false, err
+	}
+
+	names := make(map[string]bool)
+	for _, user := range connected {
+		names[user.Name] = true
+	}
+
+	mumbleChannelCacheMutex.Lock()
+	old, ok := mumbleChannelCache[lobby.MumbleChannelId]
+	mumbleChannelCache[lobby.MumbleChannelId] = mumbleChannelEntry{names: names, fetched: time.Now()}
+	mumbleChannelCacheMutex.Unlock()
+
+	return !ok || !reflect.DeepEqual(old.names, names), nil
+}
+
+// GetMumblePresence returns the players in the lobby's slots, and if they're in the lobby's channel.
+// The channel's users are fetched if they're older than MumblePresenceCacheTime
+func (lobby *Lobby) GetMumblePresence() (map[uint]bool, error) {
+	if !config.Constants.MumbleMockUp && cachedMumbleChannel(lobby.MumbleChannelId, MumblePresenceCacheTime) == nil {
+		if _, err := lobby.RefreshMumblePresence(); err != nil {
+			return nil, err
+		}
+	}
+
+	return lobby.GetCachedMumblePresence(), nil
+}
+
+// GetCachedMumblePresence is GetMumblePresence without asking the mumble server, players
+// are only in the channel if the broadcaster saw them there
+func (lobby *Lobby) GetCachedMumblePresence() map[uint]bool {
+	presence := make(map[uint]bool)
+
+	var slots []LobbySlot
+	db.DB.Where("lobby_id = ?", lobby.ID).Find(&slots)
+	for _, slot := range slots {
+		presence[slot.PlayerId] = config.Constants.MumbleMockUp
+	}
+
+	if config.Constants.MumbleMockUp {
+		return presence
+	}
+
+	names := cachedMumbleChannel(lobby.MumbleChannelId, MumblePresenceCacheTime)
+	if names == nil {
+		return presence
+	}
+
+	var users []MumbleUser
+	db.DB.Joins("INNER JOIN lobby_slots ON lobby_slots.player_id = mumble_users.player_id").
+		Where("lobby_slots.lobby_id = ? AND mumble_users.lobby_id = ?", lobby.ID, lobby.ID).
+		Find(&users)
+
+	for _, user := range users {
+		if names[user.Username] {
+			presence[user.PlayerId] = true
+		}
+	}
+
+	return presence
+}
+
+func (lobby *Lobby) IsPlayerInMumble(player *Player) bool {
+	presence, err := lobby.GetMumblePresence()
+	if err != nil {
+		helpers.Logger.Warning("[Lobby.IsPlayerInMumble]: %s", err.Error())
+		return false
+	}
+
+	return presence[player.ID]
+}
+
+// CloseMumble deletes the lobby's channel and the players' logins
+func (lobby *Lobby) CloseMumble() error {
+	if config.Constants.MumbleMockUp || lobby.MumbleChannelId == 0 {
+		return nil
+	}
+
+	client := newMumbleClient()
+	err := client.DeleteChannel(lobby.MumbleChannelId)
+
+	mumbleChannelCacheMutex.Lock()
+	delete(mumbleChannelCache, lobby.MumbleChannelId)
+	mumbleChannelCacheMutex.Unlock()
+
+	var users []MumbleUser
+	db.DB.Where("lobby_id = ?", lobby.ID).Find(&users)
+	for _, user := range users {
+		if userErr := client.UnregisterUser(user.Username); userErr != nil {
+			helpers.Logger.Warning("[Lobby.CloseMumble]: %s", userErr.Error())
+		}
+	}
+
+	return err
+}
+
+func closeLobbyMumble(lobby *Lobby, from LobbyState, to LobbyState) {
+	if !to.IsFinished() {
+		return
+	}
+
+	if err := lobby.CloseMumble(); err != nil {
+		helpers.Logger.Warning("[Lobby.CloseMumble]: Lobby [%d] %s", lobby.ID, err.Error())
+	}
+}
+
+func init() {
+	OnLobbyStateChange(closeLobbyMumble)
+}
@@ -0,0 +1,93 @@
+package models_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/TF2Stadium/Helen/config"
+	"github.com/TF2Stadium/Helen/database/migrations"
+	"github.com/TF2Stadium/Helen/helpers"
+	"github.com/TF2Stadium/Helen/helpers/mumble"
+	"github.com/TF2Stadium/Helen/helpers/mumble/mumbletest"
+	"github.com/TF2Stadium/Helen/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	helpers.InitLogger()
+}
+
+func TestLobbyMumble(t *testing.T) {
+	migrations.TestCleanup()
+
+	server := mumbletest.NewServer("key")
+	defer server.Close()
+	config.Constants.MumbleMockUp = false
+	config.Constants.MumbleAdminUrl = server.URL
+	config.Constants.MumbleAdminKey = "key"
+	defer func() { config.Constants.MumbleMockUp = true }()
+
+	lobby := models.NewLobby("cp_badlands", models.LobbyTypeSixes, models.ServerRecord{}, 0)
+	lobby.MumbleRequired = true
+	lobby.Save()
+
+	assert.Nil(t, lobby.SetupMumble())
+	channel := server.ChannelId("match"+strconv.FormatUint(uint64(lobby.ID), 10), mumble.RootChannel)
+	assert.Equal(t, lobby.MumbleChannelId, channel)
+	assert.NotEqual(t, -1, server.ChannelId("RED", channel))
+	assert.NotEqual(t, -1, server.ChannelId("BLU", channel))
+
+	var users []*models.MumbleUser
+	for i := 0; i < 12; i++ {
+		player, playErr := models.NewPlayer(strconv.Itoa(i))
+		assert.Nil(t, playErr)
+		player.Save()
+
+		lobby.AddPlayer(player, i)
+		lobby.ReadyPlayer(player)
+
+		user, err := lobby.GetMumbleUser(player)
+		assert.Nil(t, err)
+		assert.True(t, server.IsRegistered(user.Username))
+		users = append(users, user)
+
+		// the same login every time
+		user2, _ := lobby.GetMumbleUser(player)
+		assert.Equal(t, user.Username, user2.Username)
+		assert.Equal(t, string(user.Password), string(user2.Password))
+	}
+
+	// everyone is ready, but not in mumble
+	assert.False(t, lobby.IsEveryoneReady())
+
+	for i, user := range users {
+		if i == 0 {
+			continue
+		}
+		assert.Nil(t, server.Connect(user.Username, string(user.Password), server.ChannelId("RED", channel)))
+	}
+
+	// cached until the broadcaster refreshes it
+	assert.False(t, lobby.GetCachedMumblePresence()[users[1].PlayerId])
+	changed, err := lobby.RefreshMumblePresence()
+	assert.Nil(t, err)
+	assert.True(t, changed)
+	changed, _ = lobby.RefreshMumblePresence()
+	assert.False(t, changed)
+
+	presence, err := lobby.GetMumblePresence()
+	assert.Nil(t, err)
+	assert.Equal(t, 12, len(presence))
+	assert.False(t, presence[users[0].PlayerId])
+	assert.True(t, presence[users[1].PlayerId])
+	assert.False(t, lobby.IsEveryoneReady())
+
+	assert.Nil(t, server.Connect(users[0].Username, string(users[0].Password), channel))
+	lobby.RefreshMumblePresence()
+	assert.True(t, lobby.IsEveryoneReady())
+
+	// the channel and the logins are deleted with the lobby
+	lobby.Close()
+	assert.Equal(t, -1, server.ChannelId("RED", channel))
+	assert.False(t, server.IsRegistered(users[0].Username))
+}
@@ -1,10 +1,13 @@
 package models
 
 import (
+	"time"
+
 	"github.com/TF2Stadium/PlayerStatsScraper"
 	"github.com/TF2Stadium/Helen/config"
 	db "github.com/TF2Stadium/Helen/database"
 	"github.com/TF2Stadium/Helen/helpers"
+	"github.com/TF2Stadium/Helen/helpers/authority"
 	"github.com/jinzhu/gorm"
 )
 
@@ -28,10 +31,17 @@ type Player struct {
 	Name       string // Player name
 
 	Settings []PlayerSetting
+
+	Role authority.AuthRole `sql:"not null;default:0"` // see role.go
+
+	JoinCooldownUntil time.Time // can't join lobbies until then, set when the player doesn't ready up
 }
 
 func NewPlayer(steamId string) (*Player, error) {
 	player := &Player{SteamId: steamId}
+	if isConfigAdmin(steamId) {
+		player.Role = RoleAdmin
+	}
 
 	if !config.Constants.SteamApiMockUp {
 		player.Stats = NewPlayerStats()
@@ -78,7 +88,7 @@ func GetPlayerWithStats(steamid string) (*Player, *helpers.TPError) {
 func (player *Player) GetLobbyId() (uint, *helpers.TPError) {
 	playerSlot := &LobbySlot{}
 	err := db.DB.Joins("INNER JOIN lobbies ON lobbies.id = lobby_slots.lobby_id").
-		Where("lobby_slots.player_id = ? AND lobbies.state <> ?", player.ID, LobbyStateEnded).
+		Where("lobby_slots.player_id = ? AND lobbies.state NOT IN (?)", player.ID, finishedLobbyStates).
 		Find(playerSlot).Error
 
 	// if the player is not in any lobby, return error
@@ -131,6 +141,15 @@ func (player *Player) UpdatePlayerInfo() error {
 	return nil
 }
 
+func (player *Player) SetJoinCooldown(d time.Duration) {
+	player.JoinCooldownUntil = time.Now().Add(d)
+	db.DB.Model(player).UpdateColumn("join_cooldown_until", player.JoinCooldownUntil)
+}
+
+func (player *Player) HasJoinCooldown() bool {
+	return player.JoinCooldownUntil.After(time.Now())
+}
+
 func (player *Player) SetSetting(key string, value string) error {
 	setting := PlayerSetting{}
 	err := db.DB.Where("player_id = ? AND key = ?", player.ID, key).First(&setting).Error
@@ -0,0 +1,206 @@
+package models
+
+import (
+	"time"
+
+	db "github.com/TF2Stadium/Helen/database"
+	"github.com/TF2Stadium/Helen/helpers"
+	"github.com/jinzhu/gorm"
+)
+
+type PlayerBanType int
+
+// what a banned player can't do. A full ban is all of them, and the player can't log in
+const (
+	PlayerBanJoin   PlayerBanType = iota // join lobbies
+	PlayerBanCreate PlayerBanType = iota // create lobbies
+	PlayerBanChat   PlayerBanType = iota
+	PlayerBanFull   PlayerBanType = iota
+)
+
+var playerBanTypeNames = map[PlayerBanType]string{
+	PlayerBanJoin:   "join",
+	PlayerBanCreate: "create",
+	PlayerBanChat:   "chat",
+	PlayerBanFull:   "full",
+}
+
+func (banType PlayerBanType) String() string {
+	return playerBanTypeNames[banType]
+}
+
+func GetPlayerBanTypeByName(name string) (PlayerBanType, bool) {
+	for banType, typeName := range playerBanTypeNames {
+		if typeName == name {
+			return banType, true
+		}
+	}
+	return PlayerBanJoin, false
+}
+
+// used as the expiry time of bans that don't expire
+var PermanentBanUntil = time.Date(9999, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// a site wide ban. Bans are never deleted, lifted and expired bans are kept as the player's history
+type PlayerBan struct {
+	ID        uint
+	CreatedAt time.Time
+
+	PlayerID   uint
+	Player     Player
+	Type       PlayerBanType
+	Until      time.Time // the ban lapses then
+	Reason     string    `sql:"size:1024"`
+	BannedByID uint      // the moderator that issued it
+	BannedBy   Player
+
+	Lifted     bool // lifted by a moderator before it expired
+	LiftedByID uint
+
+	Appeal string `sql:"size:2048"` // what the player had to say about it
+}
+
+// Ban bans the player until then, bannedBy is the moderator that issued the ban
+func (player *Player) Ban(banType PlayerBanType, until time.Time, reason string, bannedBy *Player) (*PlayerBan, *helpers.TPError) {
+	if _, ok := playerBanTypeNames[banType]; !ok {
+		return nil, helpers.NewTPError("Invalid ban type", -1)
+	}
+
+	if !until.After(time.Now()) {
+		return nil, helpers.NewTPError("The ban would already be over", -1)
+	}
+
+	ban := &PlayerBan{
+		PlayerID:   player.ID,
+		Type:       banType,
+		Until:      until,
+		Reason:     reason,
+		BannedByID: bannedBy.ID,
+	}
+
+	if err := db.DB.Create(ban).Error; err != nil {
+		return nil, helpers.NewTPError(err.Error(), -1)
+	}
+
+	return ban, nil
+}
+
+func activeBans() *gorm.DB {
+	return db.DB.Where("lifted = ? AND until > ?", false, time.Now())
+}
+
+// GetActiveBan returns the ban stopping the player from doing banType that lasts the longest.
+// Full bans stop everything
+func (player *Player) GetActiveBan(banType PlayerBanType) (*PlayerBan, bool) {
+	ban := &PlayerBan{}
+	err := activeBans().
+		Where("player_id = ? AND type IN (?)", player.ID, []PlayerBanType{banType, PlayerBanFull}).
+		Order("until desc").First(ban).Error
+
+	return ban, err == nil
+}
+
+// IsBanned returns true if the player can't do banType right now
+func (player *Player) IsBanned(banType PlayerBanType) bool {
+	_, banned := player.GetActiveBan(banType)
+	return banned
+}
+
+// BanError returns the error for players that can't do banType, or nil if they can
+func (player *Player) BanError(banType PlayerBanType) *helpers.TPError {
+	ban, banned := player.GetActiveBan(banType)
+	if !banned {
+		return nil
+	}
+	return ban.TPError()
+}
+
+// TPError returns the error the banned player gets for the things they can't do
+func (ban *PlayerBan) TPError() *helpers.TPError {
+	message := "Player is banned"
+	if ban.Until.Before(PermanentBanUntil) {
+		message += " until " + ban.Until.Format(time.RFC1123)
+	}
+	if ban.Reason != "" {
+		message += ": " + ban.Reason
+	}
+
+	return helpers.NewTPError(message, 4)
+}
+
+// GetBans returns all the player's bans, lifted and expired ones included, newest first
+func (player *Player) GetBans() ([]PlayerBan, error) {
+	var bans []PlayerBan
+	err := db.DB.Preload("BannedBy").Where("player_id = ?", player.ID).
+		Order("created_at desc, id desc").Find(&bans).Error
+
+	return bans, err
+}
+
+// GetActiveBans returns every ban that hasn't lapsed, newest first
+func GetActiveBans() ([]PlayerBan, error) {
+	var bans []PlayerBan
+	err := activeBans().Preload("Player").Preload("BannedBy").
+		Order("created_at desc, id desc").Find(&bans).Error
+
+	return bans, err
+}
+
+func GetPlayerBanById(id uint) (*PlayerBan, *helpers.TPError) {
+	ban := &PlayerBan{}
+	if err := db.DB.Preload("Player").First(ban, id).Error; err != nil {
+		return nil, helpers.NewTPError("Ban not in the database", -1)
+	}
+	return ban, nil
+}
+
+func (ban *PlayerBan) IsActive() bool {
+	return !ban.Lifted && ban.Until.After(time.Now())
+}
+
+// Lift ends the ban before it expires
+func (ban *PlayerBan) Lift(liftedBy *Player) *helpers.TPError {
+	if !ban.IsActive() {
+		return helpers.NewTPError("The ban is already over", -1)
+	}
+
+	err := db.DB.Model(ban).UpdateColumns(map[string]interface{}{
+		"lifted":       true,
+		"lifted_by_id": liftedBy.ID,
+	}).Error
+	if err != nil {
+		return helpers.NewTPError(err.Error(), -1)
+	}
+
+	ban.Lifted = true
+	ban.LiftedByID = liftedBy.ID
+	return nil
+}
+
+// LiftBans lifts all the player's bans of the type, full bans aren't lifted unless banType is full
+func (player *Player) LiftBans(banType PlayerBanType, liftedBy *Player) *helpers.TPError {
+	err := activeBans().Model(&PlayerBan{}).
+		Where("player_id = ? AND type = ?", player.ID, banType).
+		UpdateColumns(map[string]interface{}{
+			"lifted":       true,
+			"lifted_by_id": liftedBy.ID,
+		}).Error
+	if err != nil {
+		return helpers.NewTPError(err.Error(), -1)
+	}
+	return nil
+}
+
+// SetAppeal saves the banned player's appeal, the moderators see it with the ban
+func (ban *PlayerBan) SetAppeal(appeal string) *helpers.TPError {
+	if !ban.IsActive() {
+		return helpers.NewTPError("The ban is already over", -1)
+	}
+
+	if err := db.DB.Model(ban).UpdateColumn("appeal", appeal).Error; err != nil {
+		return helpers.NewTPError(err.Error(), -1)
+	}
+
+	ban.Appeal = appeal
+	return nil
+}
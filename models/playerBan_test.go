@@ -0,0 +1,125 @@
+package models_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/TF2Stadium/Helen/database"
+	"github.com/TF2Stadium/Helen/database/migrations"
+	"github.com/TF2Stadium/Helen/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlayerBan(t *testing.T) {
+	migrations.TestCleanup()
+
+	moderator, _ := models.NewPlayer("mod")
+	moderator.Save()
+	player, _ := models.NewPlayer("banned")
+	player.Save()
+
+	assert.False(t, player.IsBanned(models.PlayerBanChat))
+	assert.Nil(t, player.BanError(models.PlayerBanChat))
+
+	_, tperr := player.Ban(models.PlayerBanChat, time.Now().Add(-time.Minute), "", moderator)
+	assert.NotNil(t, tperr)
+
+	ban, tperr := player.Ban(models.PlayerBanChat, time.Now().Add(time.Hour), "spam", moderator)
+	assert.Nil(t, tperr)
+	assert.True(t, player.IsBanned(models.PlayerBanChat))
+	assert.False(t, player.IsBanned(models.PlayerBanJoin))
+	assert.Equal(t, 4, player.BanError(models.PlayerBanChat).Code)
+
+	active, ok := player.GetActiveBan(models.PlayerBanChat)
+	assert.True(t, ok)
+	assert.Equal(t, ban.ID, active.ID)
+	assert.Equal(t, "spam", active.Reason)
+	assert.Equal(t, moderator.ID, active.BannedByID)
+
+	// full bans stop everything
+	player.Ban(models.PlayerBanFull, models.PermanentBanUntil, "", moderator)
+	assert.True(t, player.IsBanned(models.PlayerBanJoin))
+	assert.True(t, player.IsBanned(models.PlayerBanCreate))
+	active, _ = player.GetActiveBan(models.PlayerBanChat)
+	assert.Equal(t, models.PlayerBanFull, active.Type)
+
+	bans, err := models.GetActiveBans()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(bans))
+	assert.Equal(t, "banned", bans[0].Player.SteamId)
+	assert.Equal(t, "mod", bans[0].BannedBy.SteamId)
+
+	assert.Nil(t, active.SetAppeal("sorry"))
+	assert.Nil(t, active.Lift(moderator))
+	assert.NotNil(t, active.Lift(moderator))
+	assert.NotNil(t, active.SetAppeal("please"))
+	assert.False(t, player.IsBanned(models.PlayerBanJoin))
+	assert.True(t, player.IsBanned(models.PlayerBanChat))
+
+	// lifted bans stay in the history
+	lifted, tperr := models.GetPlayerBanById(active.ID)
+	assert.Nil(t, tperr)
+	assert.True(t, lifted.Lifted)
+	assert.Equal(t, moderator.ID, lifted.LiftedByID)
+	assert.Equal(t, "sorry", lifted.Appeal)
+
+	history, err := player.GetBans()
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(history))
+}
+
+func TestPlayerBanExpires(t *testing.T) {
+	migrations.TestCleanup()
+
+	moderator, _ := models.NewPlayer("mod")
+	moderator.Save()
+	player, _ := models.NewPlayer("banned")
+	player.Save()
+
+	ban, _ := player.Ban(models.PlayerBanJoin, time.Now().Add(time.Hour), "", moderator)
+	assert.True(t, player.IsBanned(models.PlayerBanJoin))
+
+	database.DB.Model(ban).UpdateColumn("until", time.Now().Add(-time.Second))
+	assert.False(t, player.IsBanned(models.PlayerBanJoin))
+
+	bans, _ := models.GetActiveBans()
+	assert.Equal(t, 0, len(bans))
+	history, _ := player.GetBans()
+	assert.Equal(t, 1, len(history))
+}
+
+func TestLobbyAddBannedPlayer(t *testing.T) {
+	migrations.TestCleanup()
+	lobby := models.NewLobby("cp_badlands", models.LobbyTypeSixes, models.ServerRecord{}, 0)
+	lobby.Save()
+
+	moderator, _ := models.NewPlayer("mod")
+	moderator.Save()
+	player, _ := models.NewPlayer("banned")
+	player.Save()
+
+	ban, _ := player.Ban(models.PlayerBanJoin, time.Now().Add(time.Hour), "", moderator)
+	tperr := lobby.AddPlayer(player, 0)
+	assert.NotNil(t, tperr)
+	assert.Equal(t, 4, tperr.Code)
+
+	ban.Lift(moderator)
+	assert.Nil(t, lobby.AddPlayer(player, 0))
+}
+
+func TestPlayerLiftBans(t *testing.T) {
+	migrations.TestCleanup()
+
+	moderator, _ := models.NewPlayer("mod")
+	moderator.Save()
+	player, _ := models.NewPlayer("banned")
+	player.Save()
+
+	player.Ban(models.PlayerBanChat, time.Now().Add(time.Hour), "", moderator)
+	player.Ban(models.PlayerBanChat, time.Now().Add(2*time.Hour), "", moderator)
+	player.Ban(models.PlayerBanCreate, time.Now().Add(time.Hour), "", moderator)
+
+	assert.Nil(t, player.LiftBans(models.PlayerBanChat, moderator))
+	assert.False(t, player.IsBanned(models.PlayerBanChat))
+	assert.True(t, player.IsBanned(models.PlayerBanCreate))
+}
@@ -4,6 +4,22 @@ type PlayerStats struct {
 	ID                    uint
 	PlayedSixesCount      int `sql:"played_sixes_count",default:"0"`
 	PlayedHighlanderCount int `sql:"played_highlander_count",default:"0"`
+	PlayedFoursCount      int
+	PlayedUltiduoCount    int
+	PlayedBballCount      int
+	PlayedProlanderCount  int
+
+	// lifetime totals from the server logs
+	Kills      int
+	Deaths     int
+	Assists    int
+	Damage     int
+	Heals      int
+	Ubers      int
+	Drops      int
+	TimePlayed int // seconds
+
+	SubbedOutCount int // times the player left a lobby in progress
 }
 
 func NewPlayerStats() PlayerStats {
@@ -12,30 +28,51 @@ func NewPlayerStats() PlayerStats {
 	return stats
 }
 
-func (ps *PlayerStats) PlayedCountSet(lt LobbyType, value int) {
+// the played count for the lobby type, nil if there's none
+func (ps *PlayerStats) playedCount(lt LobbyType) *int {
 	switch lt {
 	case LobbyTypeSixes:
-		ps.PlayedSixesCount = value
+		return &ps.PlayedSixesCount
 	case LobbyTypeHighlander:
-		ps.PlayedHighlanderCount = value
+		return &ps.PlayedHighlanderCount
+	case LobbyTypeFours:
+		return &ps.PlayedFoursCount
+	case LobbyTypeUltiduo:
+		return &ps.PlayedUltiduoCount
+	case LobbyTypeBball:
+		return &ps.PlayedBballCount
+	case LobbyTypeProlander:
+		return &ps.PlayedProlanderCount
+	}
+	return nil
+}
+
+func (ps *PlayerStats) PlayedCountSet(lt LobbyType, value int) {
+	if count := ps.playedCount(lt); count != nil {
+		*count = value
 	}
 }
 
 func (ps *PlayerStats) PlayedCountGet(lt LobbyType) int {
-	switch lt {
-	case LobbyTypeSixes:
-		return ps.PlayedSixesCount
-	case LobbyTypeHighlander:
-		return ps.PlayedHighlanderCount
+	if count := ps.playedCount(lt); count != nil {
+		return *count
 	}
 	return 0
 }
 
 func (ps *PlayerStats) PlayedCountIncrease(lt LobbyType) {
-	switch lt {
-	case LobbyTypeSixes:
-		ps.PlayedSixesCount += 1
-	case LobbyTypeHighlander:
-		ps.PlayedHighlanderCount += 1
+	if count := ps.playedCount(lt); count != nil {
+		*count += 1
 	}
 }
+
+func (ps *PlayerStats) AddLobbyStats(s *LobbyPlayerStats) {
+	ps.Kills += s.Kills
+	ps.Deaths += s.Deaths
+	ps.Assists += s.Assists
+	ps.Damage += s.Damage
+	ps.Heals += s.Heals
+	ps.Ubers += s.Ubers
+	ps.Drops += s.Drops
+	ps.TimePlayed += s.TimePlayed
+}
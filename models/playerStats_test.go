@@ -34,3 +34,34 @@ func TestLobbiesPlayed(t *testing.T) {
 	assert.Equal(t, 6, stats2.PlayedCountGet(models.LobbyTypeSixes))
 	assert.Equal(t, 8, stats2.PlayedCountGet(models.LobbyTypeHighlander))
 }
+
+func TestSaveLobbyStats(t *testing.T) {
+	migrations.TestCleanup()
+
+	player, playErr := models.NewPlayer("76561197999073985")
+	assert.Nil(t, playErr)
+	player.Save()
+
+	lobby := models.NewLobby("cp_badlands", models.LobbyTypeSixes, models.ServerRecord{}, 0)
+	lobby.Save()
+
+	results := map[string]models.LobbyPlayerStats{
+		"76561197999073985": models.LobbyPlayerStats{Class: "scout", Kills: 10, Deaths: 3, TimePlayed: 1800},
+		"76561197960278073": models.LobbyPlayerStats{Class: "medic", Heals: 9000}, // not in the database
+	}
+	models.SaveLobbyStats(lobby, results)
+	models.SaveLobbyStats(lobby, results)
+
+	player2, err := models.GetPlayerWithStats(player.SteamId)
+	assert.Nil(t, err)
+	assert.Equal(t, 20, player2.Stats.Kills)
+	assert.Equal(t, 6, player2.Stats.Deaths)
+	assert.Equal(t, 3600, player2.Stats.TimePlayed)
+
+	recent, recentErr := models.GetPlayerRecentStats(player.ID, 10)
+	assert.Nil(t, recentErr)
+	assert.Equal(t, 2, len(recent))
+	assert.Equal(t, "scout", recent[0].Class)
+	assert.Equal(t, lobby.ID, recent[0].LobbyId)
+	assert.Equal(t, "cp_badlands", recent[0].Lobby.MapName)
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"github.com/TF2Stadium/Helen/config"
+	db "github.com/TF2Stadium/Helen/database"
+	"github.com/TF2Stadium/Helen/helpers"
+	"github.com/TF2Stadium/Helen/helpers/authority"
+)
+
+// what a player is allowed to do, see controllerhelpers for the actions of each role.
+// Every role has the permissions of the roles before it
+const (
+	RolePlayer    authority.AuthRole = iota
+	RoleModerator authority.AuthRole = iota
+	RoleAdmin     authority.AuthRole = iota
+	RoleDeveloper authority.AuthRole = iota
+)
+
+var roleNames = map[authority.AuthRole]string{
+	RolePlayer:    "player",
+	RoleModerator: "moderator",
+	RoleAdmin:     "admin",
+	RoleDeveloper: "developer",
+}
+
+func RoleName(role authority.AuthRole) string {
+	return roleNames[role]
+}
+
+// GetRoleByName returns the role called name, example: "moderator"
+func GetRoleByName(name string) (authority.AuthRole, bool) {
+	for role, roleName := range roleNames {
+		if roleName == name {
+			return role, true
+		}
+	}
+	return RolePlayer, false
+}
+
+// isConfigAdmin returns true if the player is in config.Constants.AdminSteamIds
+func isConfigAdmin(steamid string) bool {
+	for _, admin := range config.Constants.AdminSteamIds {
+		if admin == steamid {
+			return true
+		}
+	}
+	return false
+}
+
+// SetRole changes the player's role. The player has to be saved already
+func (player *Player) SetRole(role authority.AuthRole) *helpers.TPError {
+	if _, ok := roleNames[role]; !ok {
+		return helpers.NewTPError("Invalid role", -1)
+	}
+
+	err := db.DB.Model(player).UpdateColumn("role", role).Error
+	if err != nil {
+		return helpers.NewTPError(err.Error(), -1)
+	}
+
+	player.Role = role
+	return nil
+}
+
+// GetPlayersWithRole returns the players whose role is at least role, sorted by steam id
+func GetPlayersWithRole(role authority.AuthRole) ([]Player, error) {
+	var players []Player
+	err := db.DB.Where("role >= ?", role).Order("steam_id").Find(&players).Error
+
+	return players, err
+}
+
+// GrantConfigAdmins makes the players in config.Constants.AdminSteamIds admins.
+// Players that don't exist yet become admins when they first log in
+func GrantConfigAdmins() error {
+	if len(config.Constants.AdminSteamIds) == 0 {
+		return nil
+	}
+
+	return db.DB.Model(&Player{}).
+		Where("steam_id IN (?) AND role < ?", config.Constants.AdminSteamIds, RoleAdmin).
+		UpdateColumn("role", RoleAdmin).Error
+}
@@ -0,0 +1,66 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/TF2Stadium/Helen/config"
+	"github.com/TF2Stadium/Helen/database/migrations"
+	"github.com/TF2Stadium/Helen/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlayerRole(t *testing.T) {
+	migrations.TestCleanup()
+
+	player, _ := models.NewPlayer("role1")
+	player.Save()
+	assert.Equal(t, models.RolePlayer, player.Role)
+
+	assert.Nil(t, player.SetRole(models.RoleModerator))
+	player, _ = models.GetPlayerBySteamId("role1")
+	assert.Equal(t, models.RoleModerator, player.Role)
+	assert.Equal(t, "moderator", models.RoleName(player.Role))
+
+	assert.NotNil(t, player.SetRole(42))
+
+	other, _ := models.NewPlayer("role2")
+	other.Save()
+
+	players, err := models.GetPlayersWithRole(models.RoleModerator)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(players))
+	assert.Equal(t, "role1", players[0].SteamId)
+
+	role, ok := models.GetRoleByName("admin")
+	assert.True(t, ok)
+	assert.Equal(t, models.RoleAdmin, role)
+	_, ok = models.GetRoleByName("garbageman")
+	assert.False(t, ok)
+}
+
+func TestGrantConfigAdmins(t *testing.T) {
+	migrations.TestCleanup()
+	config.Constants.AdminSteamIds = []string{"admin1", "admin2"}
+	defer func() { config.Constants.AdminSteamIds = nil }()
+
+	existing, _ := models.NewPlayer("admin1")
+	existing.Role = models.RolePlayer
+	existing.Save()
+	developer, _ := models.NewPlayer("admin2")
+	developer.Role = models.RoleDeveloper
+	developer.Save()
+
+	assert.Nil(t, models.GrantConfigAdmins())
+
+	existing, _ = models.GetPlayerBySteamId("admin1")
+	assert.Equal(t, models.RoleAdmin, existing.Role)
+	// nobody is demoted
+	developer, _ = models.GetPlayerBySteamId("admin2")
+	assert.Equal(t, models.RoleDeveloper, developer.Role)
+
+	// new players in the list start as admins
+	player, _ := models.NewPlayer("admin1")
+	assert.Equal(t, models.RoleAdmin, player.Role)
+	player, _ = models.NewPlayer("someone")
+	assert.Equal(t, models.RolePlayer, player.Role)
+}
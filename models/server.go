@@ -1,60 +1,109 @@
 package models
 
 import (
+	"bytes"
+	"context"
+	"crypto/rand"
 	"fmt"
-	"log"
+	"math/big"
+	"sync"
 	"time"
 
 	"github.com/TF2Stadium/PlayerStatsScraper/steamid"
 	"github.com/TF2Stadium/Helen/config"
+	db "github.com/TF2Stadium/Helen/database"
 	"github.com/TF2Stadium/Helen/helpers"
 	"github.com/TF2Stadium/TF2RconWrapper"
 )
 
-var LobbyServerMap = make(map[uint]*Server)
-var LobbyServerSettingUp = make(map[uint]time.Time)
+// the instance holding the lease owns the lobby's server: it sets it up and verifies it.
+// Renewed every time the verifier runs
+const serverLeaseTTL = 30 * time.Second
+
+func serverLeaseName(lobbyId uint) string {
+	return fmt.Sprintf("lobby_server_%d", lobbyId)
+}
 
 type ServerRecord struct {
 	ID           uint
 	Host         string
-	RconPassword string
+	RconPassword EncryptedString
+
+	// server pool
+	Pooled      bool // managed by the admins, any lobby can reserve it
+	Region      string
+	Capacity    int  // max number of players
+	Healthy     bool // answered the last rcon probe
+	Reserved    bool // a lobby is using the server
+	LastChecked time.Time
+}
+
+// the rcon commands used by Server, implemented by TF2RconWrapper.TF2RconConnection
+type RconClient interface {
+	Query(req string) (string, error)
+	GetPlayers() ([]TF2RconWrapper.Player, error)
+	KickPlayer(p TF2RconWrapper.Player, message string) error
+	Say(message string) error
+	ChangeServerPassword(password string) error
+	ChangeMap(mapname string) error
+	ExecConfig(config string) error
+	Close()
+}
+
+// DialRcon connects to a game server's rcon, tests replace it to use a fake server
+var DialRcon = func(host string, password string) (RconClient, error) {
+	rcon, err := TF2RconWrapper.NewTF2RconConnection(host, password)
+	if err != nil {
+		return nil, err
+	}
+	return rcon, nil
 }
 
 type Server struct {
 	Map  string // lobby map
 	Name string // server name
 
-	League League
-	Type   LobbyType // 9v9 6v6 4v4...
+	League       League
+	RulesVariant string
+	Type         LobbyType // 9v9 6v6 4v4...
+	Whitelist    Whitelist // whitelist.tf ID
 
 	LobbyId uint
 
 	Players        []TF2RconWrapper.Player // current number of players in the server
 	AllowedPlayers map[string]bool
+	allowedMutex   sync.RWMutex
 
 	Config *ServerConfig // config that should run before the lobby starts
-	Ticker verifyTicker  // timer that will verify()
+
+	// cancelled by End, stops the verifier
+	ctx          context.Context
+	cancel       context.CancelFunc
+	verifierOnce sync.Once
 
 	//ChatListener  *TF2RconWrapper.RconChatListener
 
-	Rcon           *TF2RconWrapper.TF2RconConnection
+	Rcon           RconClient
 	Info           ServerRecord
 	ServerPassword string // will store the new server password from the lobby
-}
+	LogSecret      string // sv_logsecret, identifies this server's logs in ServerLogListener
 
-// timer used in verify()
-type verifyTicker struct {
-	Ticker *time.Ticker
-	Quit   chan bool
-}
+	whitelistFile string // the uploaded whitelist, in the game directory
 
-func (t *verifyTicker) Close() {
-	t.Quit <- true
+	logs      bytes.Buffer // log lines received from the server, uploaded when the lobby ends
+	logsMutex sync.Mutex
+
+	// the match started before this instance had the server, logs and stats miss the beginning
+	LogsPartial bool
+
+	stats *matchStats // players' stats from the logs
 }
 
 func NewServer() *Server {
 	s := &Server{}
 	s.AllowedPlayers = make(map[string]bool)
+	s.stats = newMatchStats()
+	s.ctx, s.cancel = context.WithCancel(context.Background())
 
 	return s
 }
@@ -74,7 +123,7 @@ func (s *Server) VerifyInfo() error {
 	}
 
 	var err error
-	s.Rcon, err = TF2RconWrapper.NewTF2RconConnection(s.Info.Host, s.Info.RconPassword)
+	s.Rcon, err = DialRcon(s.Info.Host, string(s.Info.RconPassword))
 
 	if err != nil {
 		return helpers.NewTPError(err.Error(), -1)
@@ -82,27 +131,32 @@ func (s *Server) VerifyInfo() error {
 	return nil
 }
 
+// SetupObject starts the verifier, it runs until End
 func (s *Server) SetupObject() error {
-	// If the ticker is initialized, the verifier is running
-	if s.Ticker.Quit != nil {
-		return nil
-	}
-	s.Ticker.Ticker = time.NewTicker(10 * time.Second)
-	s.Ticker.Quit = make(chan bool)
-	go func() {
-		for {
-			select {
-			case <-s.Ticker.Ticker.C:
+	s.verifierOnce.Do(func() {
+		go s.verifier()
+	})
+
+	return nil
+}
+
+func (s *Server) verifier() {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// the players could have joined through another instance
+			if AcquireLease(serverLeaseName(s.LobbyId), config.Constants.InstanceId, serverLeaseTTL) {
+				s.SetAllowedPlayers(getLobbySteamIds(s.LobbyId))
 				s.Verify()
-			case <-s.Ticker.Quit:
-				log.Println("Stopping verifier")
-				s.Ticker.Ticker.Stop()
-				return
 			}
+		case <-s.ctx.Done():
+			helpers.Logger.Debug("[Server.verifier]: Stopping verifier of lobby [%d]", s.LobbyId)
+			return
 		}
-	}()
-
-	return nil
+	}
 }
 
 func (s *Server) Setup() error {
@@ -115,7 +169,7 @@ func (s *Server) Setup() error {
 	// connect to rcon if not connected before
 	if s.Rcon == nil {
 		var err error
-		s.Rcon, err = TF2RconWrapper.NewTF2RconConnection(s.Info.Host, s.Info.RconPassword)
+		s.Rcon, err = DialRcon(s.Info.Host, string(s.Info.RconPassword))
 
 		if err != nil {
 			return err
@@ -129,6 +183,13 @@ func (s *Server) Setup() error {
 		return passErr
 	}
 
+	// send logs to us
+	logErr := s.SetupLogs()
+
+	if logErr != nil {
+		return logErr
+	}
+
 	// kick players
 	helpers.Logger.Debug("[Server.Setup]: Connected to server, getting players...")
 	kickErr := s.KickAll()
@@ -140,21 +201,10 @@ func (s *Server) Setup() error {
 	}
 
 	// run config
-	config := NewServerConfig()
-	config.League = s.League
-	config.Type = s.Type
-	config.Map = s.Map
-	cfg, cfgErr := config.Get()
-
-	if cfgErr == nil {
-		config.Data = cfg
-		configErr := s.ExecConfig(config)
+	configErr := s.ExecLobbyConfig()
 
-		if configErr != nil {
-			return configErr
-		}
-	} else {
-		return cfgErr
+	if configErr != nil {
+		return configErr
 	}
 
 	// change map
@@ -179,7 +229,11 @@ func (s *Server) Verify() {
 	s.Players, err = s.Rcon.GetPlayers()
 
 	for err != nil {
-		time.Sleep(time.Second)
+		select {
+		case <-time.After(time.Second):
+		case <-s.ctx.Done():
+			return
+		}
 		helpers.Logger.Warning("Failed to get players in server %s: %s", s.LobbyId, err.Error())
 		s.Players, err = s.Rcon.GetPlayers()
 	}
@@ -208,6 +262,32 @@ func (s *Server) Verify() {
 	}
 }
 
+// KickPlayer takes the player off the allowed players and kicks them if they're in the server
+func (s *Server) KickPlayer(commId string, message string) error {
+	s.DisallowPlayer(commId)
+
+	if config.Constants.ServerMockUp || s.Rcon == nil {
+		return nil
+	}
+
+	players, err := s.Rcon.GetPlayers()
+	if err != nil {
+		return err
+	}
+
+	for i := range players {
+		if players[i].SteamID == "BOT" {
+			continue
+		}
+
+		if playerCommId, idErr := steamid.SteamIdToCommId(players[i].SteamID); idErr == nil && playerCommId == commId {
+			return s.Rcon.KickPlayer(players[i], message)
+		}
+	}
+
+	return nil
+}
+
 // check if the given commId is in the server
 func (s *Server) IsPlayerInServer(playerCommId string) (bool, error) {
 	for i := range s.Players {
@@ -225,18 +305,152 @@ func (s *Server) IsPlayerInServer(playerCommId string) (bool, error) {
 	return false, nil
 }
 
-// TODO: get end event from logs
-// `World triggered "Game_Over"`
 func (s *Server) End() {
+	s.cancel()
+
+	if ServerLogListener != nil && s.LogSecret != "" {
+		ServerLogListener.Unregister(s.LogSecret)
+	}
+	ReleaseLease(serverLeaseName(s.LobbyId), config.Constants.InstanceId)
+
 	if config.Constants.ServerMockUp {
 		return
 	}
 
 	helpers.Logger.Debug("[Server.End]: Ending server -> [" + s.Info.Host + "] from lobby [" + fmt.Sprint(s.LobbyId) + "]")
-	// TODO: upload logs
+	go s.UploadLogs()
 
 	s.Rcon.Close()
-	s.Ticker.Close()
+}
+
+func (s *Server) Logs() []byte {
+	s.logsMutex.Lock()
+	defer s.logsMutex.Unlock()
+
+	return append([]byte(nil), s.logs.Bytes()...)
+}
+
+// uploads the server's logs and saves the log id in the lobby
+func (s *Server) UploadLogs() {
+	logs := s.Logs()
+	if len(logs) == 0 {
+		helpers.Logger.Debug("[Server.UploadLogs]: No logs received from lobby [" + fmt.Sprint(s.LobbyId) + "]")
+		return
+	}
+
+	title := LogsTitle(s.LobbyId, s.Map)
+	if s.LogsPartial {
+		title = PartialLogsTitle(s.LobbyId, s.Map)
+	}
+
+	logId, err := UploadLogs(logs, title, s.Map)
+	if err != nil {
+		helpers.Logger.Warning("[Server.UploadLogs]: Couldn't upload logs from lobby %d: %s", s.LobbyId, err.Error())
+		return
+	}
+
+	helpers.Logger.Debug("[Server.UploadLogs]: Logs from lobby [%d] uploaded -> %d", s.LobbyId, logId)
+	db.DB.Table("lobbies").Where("id = ?", s.LobbyId).UpdateColumn("logs_id", logId)
+	lobbyChanged(s.LobbyId)
+}
+
+// listens to the logs of a server set up before a restart, it still sends them
+func (s *Server) resumeLogs() {
+	if ServerLogListener != nil && s.LogSecret != "" {
+		ServerLogListener.Register(s.LogSecret, s.HandleLogEvent)
+	}
+}
+
+// makes the server send its logs to ServerLogListener
+func (s *Server) SetupLogs() error {
+	if ServerLogListener == nil {
+		helpers.Logger.Warning("[Server.SetupLogs]: Log listener isn't running, lobby %d won't end automatically", s.LobbyId)
+		return nil
+	}
+
+	if s.LogSecret == "" {
+		secret, err := rand.Int(rand.Reader, big.NewInt(1<<31-1))
+		if err != nil {
+			return err
+		}
+		s.LogSecret = secret.String()
+		db.DB.Table("lobbies").Where("id = ?", s.LobbyId).UpdateColumn("server_log_secret", s.LogSecret)
+	}
+
+	ServerLogListener.Register(s.LogSecret, s.HandleLogEvent)
+
+	commands := []string{
+		"log on",
+		"sv_logsecret " + s.LogSecret,
+		"logaddress_add " + config.Constants.LogAddress,
+	}
+
+	for _, command := range commands {
+		_, err := s.Rcon.Query(command)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	helpers.Logger.Debug("[Server.SetupLogs]: Server logs from lobby [" + fmt.Sprint(s.LobbyId) + "] will be sent to " + config.Constants.LogAddress)
+	return nil
+}
+
+// called by ServerLogListener for every log line the server sends
+func (s *Server) HandleLogEvent(e *LogEvent) {
+	s.logsMutex.Lock()
+	s.logs.WriteString(e.Line + "\n")
+	s.logsMutex.Unlock()
+
+	s.stats.HandleEvent(e)
+
+	switch e.Type {
+	case LogEventRoundStart:
+		lobby, err := GetLobbyById(s.LobbyId)
+		if err != nil {
+			helpers.Logger.Warning("[Server.HandleLogEvent]: %s", err.Error())
+			return
+		}
+
+		// the players started the match on the server before everyone readied up on the site
+		if lobby.State == LobbyStateReadyingUp {
+			tperr := lobby.start("round start", false)
+			if tperr != nil && tperr.Code != LobbyStateErrorChanged {
+				helpers.Logger.Warning("[Server.HandleLogEvent]: Lobby [%d] %s", s.LobbyId, tperr.Error())
+			}
+		}
+
+	case LogEventRoundWin:
+		helpers.Logger.Debug("[Server.HandleLogEvent]: Lobby [%d] round won by %s", s.LobbyId, e.Team)
+
+	case LogEventGameOver:
+		lobby, err := GetLobbyById(s.LobbyId)
+		if err != nil {
+			helpers.Logger.Warning("[Server.HandleLogEvent]: %s", err.Error())
+			return
+		}
+
+		if lobby.State == LobbyStateInProgress {
+			helpers.Logger.Debug("[Server.HandleLogEvent]: Lobby [%d] ended (%s)", s.LobbyId, e.Message)
+			if s.LogsPartial {
+				// the players' lifetime stats would be short of the rounds that weren't seen
+				helpers.Logger.Warning("[Server.HandleLogEvent]: Lobby [%d] only has partial logs, not saving stats", s.LobbyId)
+			} else {
+				SaveLobbyStats(lobby, s.stats.Results())
+			}
+			lobby.SetState(LobbyStateEnded, "game over: "+e.Message, 0)
+		}
+
+	case LogEventPlayerConnected:
+		helpers.Logger.Debug("[Server.HandleLogEvent]: Lobby [%d] %s (%s) connected", s.LobbyId, e.Player.Name, e.Player.CommId)
+
+	case LogEventPlayerDisconnected:
+		helpers.Logger.Debug("[Server.HandleLogEvent]: Lobby [%d] %s (%s) disconnected: %s", s.LobbyId, e.Player.Name, e.Player.CommId, e.Message)
+
+	case LogEventSay:
+		helpers.Logger.Debug("[Server.HandleLogEvent]: Lobby [%d] %s: %s", s.LobbyId, e.Player.Name, e.Message)
+	}
 }
 
 func (s *Server) ExecConfig(config *ServerConfig) error {
@@ -252,13 +466,116 @@ func (s *Server) ExecConfig(config *ServerConfig) error {
 	return nil
 }
 
+// runs the config for the lobby's league, type and map
+func (s *Server) ExecLobbyConfig() error {
+	config := NewServerConfig()
+	config.League = s.League
+	config.Type = s.Type
+	config.Map = s.Map
+	config.RulesVariant = s.RulesVariant
+	cfg, cfgErr := config.Get()
+
+	if cfgErr != nil {
+		return cfgErr
+	}
+
+	config.Data = cfg
+	if err := s.ExecConfig(config); err != nil {
+		return err
+	}
+
+	// after the config, so it replaces the whitelist set by the league configs
+	return s.LoadWhitelist()
+}
+
+// LoadWhitelist writes the lobby's whitelist to a file in the game server's cfg/
+// directory and loads it. The console is logged to the file while the lines are
+// echoed, so it's uploaded once, during the setup after the players were kicked,
+// and only loaded again after that. con_logfile appends, every upload gets a new file
+func (s *Server) LoadWhitelist() error {
+	if s.whitelistFile == "" {
+		data := WhitelistData(s.Whitelist, s.League, s.Type)
+		if data == "" {
+			return nil
+		}
+
+		file := fmt.Sprintf("cfg/helen_whitelist_%d_%d.txt", s.LobbyId, time.Now().UnixNano())
+		if err := s.uploadWhitelist(file, data); err != nil {
+			helpers.Logger.Warning("[Server.LoadWhitelist]: Lobby %d: %s", s.LobbyId, err.Error())
+			return err
+		}
+		s.whitelistFile = file
+	}
+
+	_, err := s.Rcon.Query(fmt.Sprintf("mp_tournament_whitelist \"%s\"", s.whitelistFile))
+	return err
+}
+
+// echoes the whitelist to file, the cvars it changes are put back even if it fails
+func (s *Server) uploadWhitelist(file string, data string) error {
+	saved := make(map[string]string)
+	for _, cvar := range whitelistUploadCvars {
+		response, err := s.Rcon.Query(cvar.Name)
+		if err != nil {
+			return err
+		}
+
+		value, ok := parseCvarValue(response)
+		if !ok {
+			value = cvar.Default
+		}
+		saved[cvar.Name] = value
+	}
+
+	defer func() {
+		for i := len(whitelistUploadCvars) - 1; i >= 0; i-- {
+			name := whitelistUploadCvars[i].Name
+			if _, err := s.Rcon.Query(fmt.Sprintf("%s \"%s\"", name, saved[name])); err != nil {
+				helpers.Logger.Warning("[Server.LoadWhitelist]: Lobby %d: Couldn't put %s back: %s", s.LobbyId, name, err.Error())
+			}
+		}
+	}()
+
+	commands := []string{"sv_logecho 0", "con_timestamp 0", fmt.Sprintf("con_logfile \"%s\"", file)}
+	commands = append(commands, WhitelistLines(data)...)
+
+	for _, command := range commands {
+		if _, err := s.Rcon.Query(command); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Start is called when everyone in the lobby is ready, the match config
+// is run again in case it was changed since the server was set up
+func (s *Server) Start() error {
+	if s.Rcon == nil {
+		return nil
+	}
+
+	helpers.Logger.Debug("[Server.Start]: Starting lobby [" + fmt.Sprint(s.LobbyId) + "] on server -> [" + s.Info.Host + "]")
+
+	configErr := s.ExecLobbyConfig()
+
+	if configErr != nil {
+		return configErr
+	}
+
+	return s.Rcon.Say(fmt.Sprintf("[tf2stadium.com]: Lobby #%d is live, good luck and have fun!", s.LobbyId))
+}
+
 func (s *Server) KickAll() error {
 	helpers.Logger.Debug("[Server.KickAll]: Kicking players...")
 	var err error
 	s.Players, err = s.Rcon.GetPlayers()
 
 	for err != nil {
-		time.Sleep(time.Second)
+		select {
+		case <-time.After(time.Second):
+		case <-s.ctx.Done():
+			return s.ctx.Err()
+		}
 		helpers.Logger.Warning("Failed to get players in server %s: %s", s.LobbyId, err.Error())
 		s.Players, err = s.Rcon.GetPlayers()
 	}
@@ -275,27 +592,34 @@ func (s *Server) KickAll() error {
 }
 
 func (s *Server) SetAllowedPlayers(commIds []string) {
-	s.AllowedPlayers = make(map[string]bool)
-
+	allowed := make(map[string]bool)
 	for _, commId := range commIds {
-		s.AllowedPlayers[commId] = true
+		allowed[commId] = true
 	}
+
+	s.allowedMutex.Lock()
+	s.AllowedPlayers = allowed
+	s.allowedMutex.Unlock()
 }
 
 func (s *Server) AllowPlayer(commId string) {
+	s.allowedMutex.Lock()
+	defer s.allowedMutex.Unlock()
+
 	s.AllowedPlayers[commId] = true
 }
 
 func (s *Server) DisallowPlayer(commId string) {
-	if s.IsPlayerAllowed(commId) {
-		delete(s.AllowedPlayers, commId)
-	}
+	s.allowedMutex.Lock()
+	defer s.allowedMutex.Unlock()
+
+	delete(s.AllowedPlayers, commId)
 }
 
 func (s *Server) IsPlayerAllowed(commId string) bool {
-	if _, ok := s.AllowedPlayers[commId]; ok {
-		return true
-	}
+	s.allowedMutex.RLock()
+	defer s.allowedMutex.RUnlock()
 
-	return false
+	_, ok := s.AllowedPlayers[commId]
+	return ok
 }
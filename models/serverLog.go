@@ -0,0 +1,229 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TF2Stadium/PlayerStatsScraper/steamid"
+)
+
+type LogEventType int
+
+const (
+	LogEventUnknown            LogEventType = 0
+	LogEventRoundStart         LogEventType = 1
+	LogEventRoundWin           LogEventType = 2
+	LogEventGameOver           LogEventType = 3
+	LogEventPlayerConnected    LogEventType = 4
+	LogEventPlayerDisconnected LogEventType = 5
+	LogEventSay                LogEventType = 6
+	LogEventKill               LogEventType = 7
+	LogEventKillAssist         LogEventType = 8
+	LogEventSuicide            LogEventType = 9
+	LogEventDamage             LogEventType = 10
+	LogEventHeal               LogEventType = 11
+	LogEventChargeDeployed     LogEventType = 12
+	LogEventMedicDeath         LogEventType = 13
+	LogEventClassChange        LogEventType = 14
+)
+
+// srcds log timestamp, example: 10/17/2015 - 21:38:05
+const logTimeLayout = "01/02/2006 - 15:04:05"
+
+// player as it appears in a log line
+// example: "Name<2><[U:1:12345]><Red>"
+type LogPlayer struct {
+	Name    string
+	UserId  int
+	SteamId string // as written in the log ([U:1:12345] or STEAM_0:1:6172)
+	CommId  string // 64 bit steam community id
+	Team    string // Red, Blue or empty
+}
+
+type LogEvent struct {
+	Type LogEventType
+	Time time.Time
+	Line string // the whole log line
+	Raw  string // line without the "L <date>: " prefix
+
+	Player LogPlayer // connected, disconnected, say, kill (attacker), medic death (killer)...
+	Target LogPlayer // kill, assist, damage, heal (the victim/patient), medic death (the medic)
+
+	Team     string // round win: the winner team
+	Message  string // say: the message, disconnected/game over: the reason
+	TeamOnly bool   // say: true for say_team
+	Weapon   string // kill, suicide, damage
+	Class    string // class change: the new class, lowercase
+	Amount   int    // damage, heal: the amount, medic death: 1 if the medic dropped
+}
+
+var (
+	logLineRegex = regexp.MustCompile(`^L (\d{2}/\d{2}/\d{4} - \d{2}:\d{2}:\d{2}): (.*)$`)
+	logPlayer    = `"(.*?)<(\d+)><(.*?)><(.*?)>"`
+
+	roundStartRegex   = regexp.MustCompile(`^World triggered "Round_Start"`)
+	roundWinRegex     = regexp.MustCompile(`^World triggered "Round_Win" \(winner "(\w+)"\)`)
+	gameOverRegex     = regexp.MustCompile(`^World triggered "Game_Over" reason "(.*?)"`)
+	connectedRegex    = regexp.MustCompile(`^` + logPlayer + ` connected, address "(.*?)"`)
+	disconnectedRegex = regexp.MustCompile(`^` + logPlayer + ` disconnected \(reason "(.*?)"\)`)
+	sayRegex          = regexp.MustCompile(`^` + logPlayer + ` (say|say_team) "(.*)"$`)
+	killRegex         = regexp.MustCompile(`^` + logPlayer + ` killed ` + logPlayer + ` with "(.*?)"`)
+	suicideRegex      = regexp.MustCompile(`^` + logPlayer + ` committed suicide with "(.*?)"`)
+	classRegex        = regexp.MustCompile(`^` + logPlayer + ` (?:changed role to|spawned as) "(\w+)"`)
+	triggeredRegex    = regexp.MustCompile(`^` + logPlayer + ` triggered "(.*?)"(?: against ` + logPlayer + `)?(.*)$`)
+
+	// properties at the end of a line, example: (damage "62") (weapon "scattergun")
+	propertyRegex = regexp.MustCompile(`\((\w+) "(.*?)"\)`)
+)
+
+var ErrInvalidLogLine = errors.New("[ServerLog]: Invalid log line")
+
+// ParseLogLine parses a single srcds log line, example:
+// L 10/17/2015 - 21:38:05: World triggered "Round_Start"
+//
+// Lines that are valid but not handled return an event of type LogEventUnknown
+func ParseLogLine(line string) (*LogEvent, error) {
+	line = strings.TrimRight(line, "\x00\r\n")
+
+	m := logLineRegex.FindStringSubmatch(line)
+	if m == nil {
+		return nil, ErrInvalidLogLine
+	}
+
+	t, timeErr := time.Parse(logTimeLayout, m[1])
+	if timeErr != nil {
+		return nil, ErrInvalidLogLine
+	}
+
+	e := &LogEvent{Type: LogEventUnknown, Time: t, Line: line, Raw: m[2]}
+	msg := m[2]
+
+	switch {
+	case roundStartRegex.MatchString(msg):
+		e.Type = LogEventRoundStart
+
+	case roundWinRegex.MatchString(msg):
+		e.Type = LogEventRoundWin
+		e.Team = roundWinRegex.FindStringSubmatch(msg)[1]
+
+	case gameOverRegex.MatchString(msg):
+		e.Type = LogEventGameOver
+		e.Message = gameOverRegex.FindStringSubmatch(msg)[1]
+
+	case connectedRegex.MatchString(msg):
+		sm := connectedRegex.FindStringSubmatch(msg)
+		e.Type = LogEventPlayerConnected
+		e.Player = newLogPlayer(sm[1:5])
+
+	case disconnectedRegex.MatchString(msg):
+		sm := disconnectedRegex.FindStringSubmatch(msg)
+		e.Type = LogEventPlayerDisconnected
+		e.Player = newLogPlayer(sm[1:5])
+		e.Message = sm[5]
+
+	case sayRegex.MatchString(msg):
+		sm := sayRegex.FindStringSubmatch(msg)
+		e.Type = LogEventSay
+		e.Player = newLogPlayer(sm[1:5])
+		e.TeamOnly = sm[5] == "say_team"
+		e.Message = sm[6]
+
+	case killRegex.MatchString(msg):
+		sm := killRegex.FindStringSubmatch(msg)
+		e.Type = LogEventKill
+		e.Player = newLogPlayer(sm[1:5])
+		e.Target = newLogPlayer(sm[5:9])
+		e.Weapon = sm[9]
+
+	case suicideRegex.MatchString(msg):
+		sm := suicideRegex.FindStringSubmatch(msg)
+		e.Type = LogEventSuicide
+		e.Player = newLogPlayer(sm[1:5])
+		e.Weapon = sm[5]
+
+	case classRegex.MatchString(msg):
+		sm := classRegex.FindStringSubmatch(msg)
+		e.Type = LogEventClassChange
+		e.Player = newLogPlayer(sm[1:5])
+		e.Class = strings.ToLower(sm[5])
+
+	case triggeredRegex.MatchString(msg):
+		parseTriggered(e, triggeredRegex.FindStringSubmatch(msg))
+	}
+
+	return e, nil
+}
+
+// "player" triggered "event" against "target" (property "value")...
+func parseTriggered(e *LogEvent, sm []string) {
+	properties := make(map[string]string)
+	for _, property := range propertyRegex.FindAllStringSubmatch(sm[10], -1) {
+		properties[property[1]] = property[2]
+	}
+
+	e.Player = newLogPlayer(sm[1:5])
+	if sm[7] != "" {
+		e.Target = newLogPlayer(sm[6:10])
+	}
+
+	switch sm[5] {
+	case "kill assist":
+		e.Type = LogEventKillAssist
+
+	case "damage":
+		e.Type = LogEventDamage
+		e.Amount, _ = strconv.Atoi(properties["damage"])
+		e.Weapon = properties["weapon"]
+
+	case "healed":
+		e.Type = LogEventHeal
+		e.Amount, _ = strconv.Atoi(properties["healing"])
+
+	case "chargedeployed":
+		e.Type = LogEventChargeDeployed
+
+	case "medic_death":
+		e.Type = LogEventMedicDeath
+		e.Amount, _ = strconv.Atoi(properties["ubercharge"])
+	}
+}
+
+// fields: name, user id, steam id, team
+func newLogPlayer(fields []string) LogPlayer {
+	userId, _ := strconv.Atoi(fields[1])
+
+	return LogPlayer{
+		Name:    fields[0],
+		UserId:  userId,
+		SteamId: fields[2],
+		CommId:  logSteamIdToCommId(fields[2]),
+		Team:    fields[3],
+	}
+}
+
+// converts both the [U:1:12345] and STEAM_0:1:6172 formats,
+// returns an empty string for bots and invalid ids
+func logSteamIdToCommId(id string) string {
+	if strings.HasPrefix(id, "[U:1:") && strings.HasSuffix(id, "]") {
+		accountId, err := strconv.ParseUint(id[5:len(id)-1], 10, 32)
+		if err != nil {
+			return ""
+		}
+
+		return strconv.FormatUint(accountId+76561197960265728, 10)
+	}
+
+	if strings.HasPrefix(id, "STEAM_") {
+		commId, err := steamid.SteamIdToCommId(id)
+		if err != nil {
+			return ""
+		}
+
+		return commId
+	}
+
+	return ""
+}
@@ -0,0 +1,149 @@
+package models
+
+import (
+	"time"
+
+	"github.com/TF2Stadium/Helen/config"
+	db "github.com/TF2Stadium/Helen/database"
+	"github.com/TF2Stadium/Helen/helpers"
+)
+
+// how often the free servers in the pool are probed
+var ServerHealthCheckInterval = time.Minute
+
+var serverPoolTicker *time.Ticker
+
+// AddPoolServer adds a server to the pool, it can be reserved once it passes a health check
+func AddPoolServer(host string, rconPassword string, region string, capacity int) (*ServerRecord, *helpers.TPError) {
+	record := &ServerRecord{
+		Host:         host,
+		RconPassword: EncryptedString(rconPassword),
+		Pooled:       true,
+		Region:       region,
+		Capacity:     capacity,
+	}
+
+	err := db.DB.Create(record).Error
+	if err != nil {
+		return nil, helpers.NewTPError(err.Error(), -1)
+	}
+
+	record.CheckHealth()
+	return record, nil
+}
+
+// RemovePoolServer takes the server out of the pool. The record is kept for old lobbies
+func RemovePoolServer(id uint) *helpers.TPError {
+	err := db.DB.Model(&ServerRecord{}).Where("id = ? AND pooled = ?", id, true).
+		UpdateColumn("pooled", false).Error
+	if err != nil {
+		return helpers.NewTPError(err.Error(), -1)
+	}
+
+	return nil
+}
+
+func GetPoolServers() ([]ServerRecord, error) {
+	var records []ServerRecord
+	err := db.DB.Where("pooled = ?", true).Order("region, id").Find(&records).Error
+
+	return records, err
+}
+
+// regions with free and healthy servers
+func GetPoolRegions() ([]string, error) {
+	var regions []string
+	err := db.DB.Model(&ServerRecord{}).
+		Where("pooled = ? AND healthy = ? AND reserved = ?", true, true, false).
+		Order("region").Pluck("DISTINCT region", &regions).Error
+
+	return regions, err
+}
+
+// ReserveServer picks a free healthy server with room for the given number of players.
+// An empty region means any region.
+func ReserveServer(region string, players int) (*ServerRecord, *helpers.TPError) {
+	var candidates []ServerRecord
+
+	query := db.DB.Where("pooled = ? AND healthy = ? AND reserved = ? AND capacity >= ?", true, true, false, players)
+	if region != "" {
+		query = query.Where("region = ?", region)
+	}
+	query.Order("last_checked desc").Find(&candidates)
+
+	for _, record := range candidates {
+		// another lobby might have reserved the server since the query,
+		// only one of the updates can affect the row
+		result := db.DB.Model(&ServerRecord{}).Where("id = ? AND reserved = ?", record.ID, false).
+			UpdateColumn("reserved", true)
+
+		if result.Error == nil && result.RowsAffected == 1 {
+			record.Reserved = true
+			return &record, nil
+		}
+	}
+
+	return nil, helpers.NewTPError("No server available in this region", -1)
+}
+
+// Release puts the server back in the pool
+func (record *ServerRecord) Release() {
+	if !record.Pooled || !record.Reserved {
+		return
+	}
+
+	record.Reserved = false
+	db.DB.Model(&ServerRecord{}).Where("id = ?", record.ID).UpdateColumn("reserved", false)
+}
+
+// CheckHealth connects to the server with rcon, servers that don't answer can't be reserved
+func (record *ServerRecord) CheckHealth() bool {
+	var err error
+
+	if !config.Constants.ServerMockUp {
+		var rcon RconClient
+		rcon, err = DialRcon(record.Host, string(record.RconPassword))
+
+		if err == nil {
+			_, err = rcon.Query("status")
+			rcon.Close()
+		}
+	}
+
+	if err != nil {
+		helpers.Logger.Warning("[ServerPool]: Server %d is down: %s", record.ID, err.Error())
+	} else if !record.Healthy {
+		helpers.Logger.Debug("[ServerPool]: Server %d is up", record.ID)
+	}
+
+	record.Healthy = err == nil
+	record.LastChecked = time.Now()
+
+	db.DB.Model(&ServerRecord{}).Where("id = ?", record.ID).UpdateColumns(map[string]interface{}{
+		"healthy":      record.Healthy,
+		"last_checked": record.LastChecked,
+	})
+
+	return record.Healthy
+}
+
+// probes the servers that aren't being used by a lobby
+func CheckPoolHealth() {
+	var records []ServerRecord
+	db.DB.Where("pooled = ? AND reserved = ?", true, false).Find(&records)
+
+	for i := range records {
+		records[i].CheckHealth()
+	}
+}
+
+func InitServerPoolChecker() {
+	serverPoolTicker = time.NewTicker(ServerHealthCheckInterval)
+
+	go func() {
+		CheckPoolHealth()
+		for range serverPoolTicker.C {
+			CheckPoolHealth()
+		}
+	}()
+}
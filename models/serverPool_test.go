@@ -0,0 +1,137 @@
+package models_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/TF2Stadium/Helen/config"
+	"github.com/TF2Stadium/Helen/database"
+	"github.com/TF2Stadium/Helen/database/migrations"
+	"github.com/TF2Stadium/Helen/helpers"
+	"github.com/TF2Stadium/Helen/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	helpers.InitLogger()
+}
+
+func TestServerPoolReserve(t *testing.T) {
+	migrations.TestCleanup()
+
+	eu, err := models.AddPoolServer("eu.tf2stadium.com:27015", "rcon", "eu", 24)
+	assert.Nil(t, err)
+	assert.True(t, eu.Healthy)
+	_, err = models.AddPoolServer("na.tf2stadium.com:27015", "rcon", "na", 24)
+	assert.Nil(t, err)
+
+	regions, regionErr := models.GetPoolRegions()
+	assert.Nil(t, regionErr)
+	assert.Equal(t, []string{"eu", "na"}, regions)
+
+	// too small for highlander
+	_, err = models.AddPoolServer("small.tf2stadium.com:27015", "rcon", "eu", 12)
+	assert.Nil(t, err)
+	_, err = models.ReserveServer("eu", 18)
+	assert.Nil(t, err)
+	_, err = models.ReserveServer("eu", 18)
+	assert.NotNil(t, err)
+
+	record, err := models.ReserveServer("", 12)
+	assert.Nil(t, err)
+	assert.True(t, record.Reserved)
+
+	lobby := models.NewLobby("cp_badlands", models.LobbyTypeSixes, *record, 0)
+	lobby.Save()
+	assert.Equal(t, record.ID, lobby.ServerInfoID)
+
+	// closing the lobby puts the server back in the pool
+	lobby.Close()
+	var released models.ServerRecord
+	database.DB.First(&released, record.ID)
+	assert.False(t, released.Reserved)
+
+	record2, err := models.ReserveServer("", 12)
+	assert.Nil(t, err)
+	assert.Equal(t, record.ID, record2.ID)
+}
+
+func TestServerPoolUnhealthy(t *testing.T) {
+	migrations.TestCleanup()
+
+	record, _ := models.AddPoolServer("eu.tf2stadium.com:27015", "rcon", "eu", 24)
+	database.DB.Model(record).UpdateColumn("healthy", false)
+
+	_, err := models.ReserveServer("eu", 12)
+	assert.NotNil(t, err)
+
+	models.CheckPoolHealth()
+	_, err = models.ReserveServer("eu", 12)
+	assert.Nil(t, err)
+
+	// retired servers can't be reserved
+	record2, _ := models.AddPoolServer("eu2.tf2stadium.com:27015", "rcon", "eu", 24)
+	models.RemovePoolServer(record2.ID)
+	_, err = models.ReserveServer("eu", 12)
+	assert.NotNil(t, err)
+}
+
+func TestServerPoolConcurrentReserve(t *testing.T) {
+	migrations.TestCleanup()
+
+	for i := 0; i < 3; i++ {
+		models.AddPoolServer("eu.tf2stadium.com:27015", "rcon", "eu", 24)
+	}
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	reserved := make(map[uint]int)
+
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			record, err := models.ReserveServer("eu", 12)
+			if err == nil {
+				mutex.Lock()
+				reserved[record.ID]++
+				mutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// every server is reserved once
+	assert.Equal(t, 3, len(reserved))
+	for _, count := range reserved {
+		assert.Equal(t, 1, count)
+	}
+}
+
+func TestReencryptServerRecords(t *testing.T) {
+	migrations.TestCleanup()
+
+	database.DB.Exec("INSERT INTO server_records (host, rcon_password) VALUES (?, ?)", "localhost", "cleartext")
+	assert.Nil(t, models.ReencryptServerRecords())
+
+	var passwords []string
+	database.DB.Table("server_records").Where("host = ?", "localhost").Pluck("rcon_password", &passwords)
+	assert.Equal(t, 1, len(passwords))
+	assert.NotContains(t, passwords[0], "cleartext")
+
+	var record models.ServerRecord
+	database.DB.Where("host = ?", "localhost").First(&record)
+	assert.Equal(t, "cleartext", string(record.RconPassword))
+
+	// rotate the key
+	oldKey := config.Constants.EncryptionKey
+	config.Constants.EncryptionKey = "a new key"
+	config.Constants.OldEncryptionKeys = []string{oldKey}
+	assert.Nil(t, models.ReencryptServerRecords())
+
+	config.Constants.OldEncryptionKeys = nil
+	record = models.ServerRecord{}
+	err := database.DB.Where("host = ?", "localhost").First(&record).Error
+	assert.Nil(t, err)
+	assert.Equal(t, "cleartext", string(record.RconPassword))
+}
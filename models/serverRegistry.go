@@ -0,0 +1,171 @@
+package models
+
+import (
+	"sync"
+	"time"
+
+	"github.com/TF2Stadium/Helen/config"
+	db "github.com/TF2Stadium/Helen/database"
+	"github.com/TF2Stadium/Helen/helpers"
+)
+
+// a lobby's server setup can be tried again after this long, in case the first try hangs
+const serverSetupTimeout = 2 * time.Minute
+
+// ServerRegistry has the game servers of the lobbies this instance has loaded.
+// It's safe to use from several goroutines
+type ServerRegistry struct {
+	mutex     sync.Mutex
+	servers   map[uint]*Server
+	settingUp map[uint]time.Time // when the setup started
+}
+
+func NewServerRegistry() *ServerRegistry {
+	return &ServerRegistry{
+		servers:   make(map[uint]*Server),
+		settingUp: make(map[uint]time.Time),
+	}
+}
+
+// the servers of the lobbies, filled by Lobby.AfterSave
+var Servers = NewServerRegistry()
+
+func (r *ServerRegistry) Get(lobbyId uint) (*Server, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	s, ok := r.servers[lobbyId]
+	return s, ok
+}
+
+// Register adds the lobby's server and returns true. If another one was registered
+// first, that one is returned with false and s isn't used
+func (r *ServerRegistry) Register(lobbyId uint, s *Server) (*Server, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if registered, ok := r.servers[lobbyId]; ok {
+		return registered, false
+	}
+
+	r.servers[lobbyId] = s
+	return s, true
+}
+
+// StartSetup marks the lobby's server as being set up. Returns false if
+// it already is, unless the other setup started more than serverSetupTimeout ago
+func (r *ServerRegistry) StartSetup(lobbyId uint) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if started, ok := r.settingUp[lobbyId]; ok && time.Since(started) < serverSetupTimeout {
+		return false
+	}
+
+	r.settingUp[lobbyId] = time.Now()
+	return true
+}
+
+func (r *ServerRegistry) FinishSetup(lobbyId uint) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	delete(r.settingUp, lobbyId)
+}
+
+func (r *ServerRegistry) IsSettingUp(lobbyId uint) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	started, ok := r.settingUp[lobbyId]
+	return ok && time.Since(started) < serverSetupTimeout
+}
+
+// Teardown removes the lobby's server and ends it, once the lobby is over
+func (r *ServerRegistry) Teardown(lobbyId uint) {
+	r.mutex.Lock()
+	s, ok := r.servers[lobbyId]
+	delete(r.servers, lobbyId)
+	delete(r.settingUp, lobbyId)
+	r.mutex.Unlock()
+
+	if ok {
+		s.End()
+	}
+}
+
+func (r *ServerRegistry) Len() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return len(r.servers)
+}
+
+// Shutdown stops the verifiers and gives up the servers when the instance stops,
+// the lobbies aren't over so another instance takes their servers over
+func (r *ServerRegistry) Shutdown() {
+	r.mutex.Lock()
+	servers := r.servers
+	r.servers = make(map[uint]*Server)
+	r.settingUp = make(map[uint]time.Time)
+	r.mutex.Unlock()
+
+	for lobbyId, s := range servers {
+		s.cancel()
+		ReleaseLease(serverLeaseName(lobbyId), config.Constants.InstanceId)
+	}
+}
+
+// RecoverLobbyServers takes the servers of the running lobbies back after a restart.
+// Loading the lobbies registers their servers with the saved password, allowed players
+// and log secret, and starts the verifiers. Setups that were cut off are tried again
+func RecoverLobbyServers() {
+	var lobbies []Lobby
+	states := []LobbyState{LobbyStateInitializing, LobbyStateWaiting, LobbyStateReadyingUp, LobbyStateInProgress}
+	if err := db.DB.Preload("ServerInfo").Where("state IN (?)", states).Find(&lobbies).Error; err != nil {
+		helpers.Logger.Warning("[RecoverLobbyServers]: %s", err.Error())
+		return
+	}
+
+	recovered := 0
+	for i := range lobbies {
+		lobby := &lobbies[i]
+		if lobby.Server == nil {
+			if owner := GetLeaseOwner(serverLeaseName(lobby.ID)); owner != "" && owner != config.Constants.InstanceId {
+				// another instance has it
+				continue
+			}
+			helpers.Logger.Warning("[RecoverLobbyServers]: Couldn't connect to the server of lobby %d", lobby.ID)
+			continue
+		}
+
+		// the lobbies that were set up keep their server as it is
+		if lobby.State == LobbyStateInitializing && !lobby.ServerSetUp {
+			go func() {
+				if tperr := lobby.TrySettingUp(); tperr != nil {
+					helpers.Logger.Warning("[RecoverLobbyServers]: Lobby %d: %s", lobby.ID, tperr.Error())
+				}
+			}()
+		}
+		recovered++
+	}
+
+	helpers.Logger.Debug("[RecoverLobbyServers]: Recovered %d of %d lobby servers", recovered, len(lobbies))
+}
+
+// a lobby that was readying up when helen stopped
+type ReadyUpDeadline struct {
+	ID              uint
+	ReadyUpDeadline time.Time
+}
+
+// GetReadyUpDeadlines returns the deadlines of the lobbies readying up, the ready up
+// timers have to be started again after a restart. The lobbies aren't loaded, loading
+// one connects to its server
+func GetReadyUpDeadlines() ([]ReadyUpDeadline, error) {
+	var deadlines []ReadyUpDeadline
+	err := db.DB.Table("lobbies").Select("id, ready_up_deadline").
+		Where("state = ? AND ready_up_deadline > ?", LobbyStateReadyingUp, time.Time{}).Scan(&deadlines).Error
+
+	return deadlines, err
+}
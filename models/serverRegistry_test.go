@@ -0,0 +1,121 @@
+package models
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TF2Stadium/Helen/helpers/rcontest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServerRegistryRegister(t *testing.T) {
+	r := NewServerRegistry()
+
+	var wg sync.WaitGroup
+	servers := make([]*Server, 20)
+	registered := make([]bool, len(servers))
+	for i := range servers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			servers[i], registered[i] = r.Register(1, NewServer())
+			r.Get(1)
+			r.Len()
+		}(i)
+	}
+	wg.Wait()
+
+	count := 0
+	for i := range servers {
+		if registered[i] {
+			count++
+		}
+		assert.Equal(t, servers[0], servers[i])
+	}
+	assert.Equal(t, 1, count)
+
+	s, ok := r.Get(1)
+	assert.True(t, ok)
+	assert.Equal(t, servers[0], s)
+	assert.Equal(t, 1, r.Len())
+
+	_, ok = r.Get(2)
+	assert.False(t, ok)
+}
+
+func TestServerRegistrySetup(t *testing.T) {
+	r := NewServerRegistry()
+
+	var wg sync.WaitGroup
+	started := make([]bool, 20)
+	for i := range started {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			started[i] = r.StartSetup(1)
+			r.IsSettingUp(1)
+		}(i)
+	}
+	wg.Wait()
+
+	count := 0
+	for _, ok := range started {
+		if ok {
+			count++
+		}
+	}
+	assert.Equal(t, 1, count)
+	assert.True(t, r.IsSettingUp(1))
+	assert.False(t, r.IsSettingUp(2))
+
+	r.FinishSetup(1)
+	assert.False(t, r.IsSettingUp(1))
+	assert.True(t, r.StartSetup(1))
+
+	// the setup hung
+	r.settingUp[1] = time.Now().Add(-serverSetupTimeout)
+	assert.False(t, r.IsSettingUp(1))
+	assert.True(t, r.StartSetup(1))
+}
+
+func TestServerVerifyCancel(t *testing.T) {
+	rcon := rcontest.NewFakeRcon(fakePlayers...)
+	rcon.Errors["GetPlayers"] = errors.New("connection lost")
+	s, restore := newFakeServer(rcon)
+	defer restore()
+	s.VerifyInfo()
+
+	done := make(chan bool)
+	go func() {
+		s.Verify()
+		done <- true
+	}()
+
+	s.cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Verify didn't stop")
+	}
+}
+
+func TestServerAllowedPlayersConcurrent(t *testing.T) {
+	s := NewServer()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.SetAllowedPlayers([]string{"1", "2"})
+			s.AllowPlayer("3")
+			s.DisallowPlayer("2")
+			s.IsPlayerAllowed("1")
+		}()
+	}
+	wg.Wait()
+
+	assert.True(t, s.IsPlayerAllowed("1"))
+}
@@ -1,11 +1,15 @@
 package models
 
 import (
+	"errors"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/TF2Stadium/Helen/config"
 	"github.com/TF2Stadium/Helen/helpers"
+	"github.com/TF2Stadium/Helen/helpers/rcontest"
+	"github.com/TF2Stadium/TF2RconWrapper"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -32,7 +36,7 @@ func TestServerSetup(t *testing.T) {
 
 		info := ServerRecord{
 			Host:         host,
-			RconPassword: password,
+			RconPassword: EncryptedString(password),
 		}
 
 		svr = NewServer()
@@ -58,3 +62,132 @@ func TestServerSetup(t *testing.T) {
 		svr.End()
 	}
 }
+
+// a server that connects to the given fake instead of a real tf2 server
+// the returned func puts DialRcon back, defer it
+func newFakeServer(rcon *rcontest.FakeRcon) (*Server, func()) {
+	config.SetupConstants()
+	config.Constants.ServerMockUp = false
+	InitServerConfigs()
+
+	dialRcon := DialRcon
+	DialRcon = func(host string, password string) (RconClient, error) {
+		return rcon, nil
+	}
+
+	s := NewServer()
+	s.Map = "cp_badlands"
+	s.Type = LobbyTypeSixes
+	s.League = LeagueEtf2l
+	s.ServerPassword = "12345"
+	s.LobbyId = 1
+	s.Info = ServerRecord{Host: "fake:27015", RconPassword: "rcon"}
+
+	return s, func() { DialRcon = dialRcon }
+}
+
+var fakePlayers = []TF2RconWrapper.Player{
+	{UserID: "2", Username: "allowed", SteamID: "STEAM_0:1:19404128"},
+	{UserID: "3", Username: "not allowed", SteamID: "STEAM_0:0:1"},
+	{UserID: "4", Username: "SourceTV", SteamID: "BOT"},
+}
+
+func TestServerSetupFake(t *testing.T) {
+	rcon := rcontest.NewFakeRcon(fakePlayers[:2]...)
+	s, restore := newFakeServer(rcon)
+	defer restore()
+
+	assert.Nil(t, s.VerifyInfo())
+	assert.Nil(t, s.Setup())
+
+	commands := rcon.Commands()
+	assert.Equal(t, []string{
+		"sv_password 12345",
+		"status",
+		"kickid 2 [tf2stadium.com]: Setting up lobby...",
+		"kickid 3 [tf2stadium.com]: Setting up lobby...",
+		"exec",
+	}, commands[:5])
+
+	// the league's whitelist is uploaded before the map changes
+	last := len(commands) - 1
+	assert.True(t, strings.HasPrefix(commands[last-1], `mp_tournament_whitelist "cfg/helen_whitelist_1_`))
+	assert.Equal(t, "changelevel cp_badlands", commands[last])
+}
+
+func TestServerSetupFakeError(t *testing.T) {
+	rcon := rcontest.NewFakeRcon()
+	rcon.Errors["ChangeMap"] = errors.New("map not found")
+	s, restore := newFakeServer(rcon)
+	defer restore()
+
+	s.VerifyInfo()
+	assert.NotNil(t, s.Setup())
+}
+
+func TestServerKickAllFake(t *testing.T) {
+	rcon := rcontest.NewFakeRcon(fakePlayers...)
+	s, restore := newFakeServer(rcon)
+	defer restore()
+	s.VerifyInfo()
+
+	assert.Nil(t, s.KickAll())
+	players, _ := rcon.GetPlayers()
+	assert.Equal(t, 0, len(players))
+
+	rcon = rcontest.NewFakeRcon(fakePlayers...)
+	rcon.Errors["KickPlayer"] = errors.New("no such player")
+	s.Rcon = rcon
+	assert.NotNil(t, s.KickAll())
+}
+
+func TestServerVerifyFake(t *testing.T) {
+	rcon := rcontest.NewFakeRcon(fakePlayers...)
+	s, restore := newFakeServer(rcon)
+	defer restore()
+	s.VerifyInfo()
+
+	s.AllowPlayer("76561197999073985")
+	s.Verify()
+
+	// only the player that isn't in the lobby is kicked, bots are left alone
+	assert.Equal(t, []string{
+		"status",
+		"kickid 3 [tf2stadium.com]: You're not in this lobby...",
+	}, rcon.Commands())
+	players, _ := rcon.GetPlayers()
+	assert.Equal(t, 2, len(players))
+}
+
+func TestServerKickPlayerFake(t *testing.T) {
+	rcon := rcontest.NewFakeRcon(fakePlayers...)
+	s, restore := newFakeServer(rcon)
+	defer restore()
+	s.VerifyInfo()
+
+	s.AllowPlayer("76561197999073985")
+	assert.Nil(t, s.KickPlayer("76561197999073985", "[tf2stadium.com]: You're banned"))
+	assert.False(t, s.IsPlayerAllowed("76561197999073985"))
+
+	assert.Equal(t, []string{
+		"status",
+		"kickid 2 [tf2stadium.com]: You're banned",
+	}, rcon.Commands())
+
+	// players that aren't in the server are only disallowed
+	assert.Nil(t, s.KickPlayer("76561197960265728", "[tf2stadium.com]: You're banned"))
+	assert.Equal(t, 3, len(rcon.Commands()))
+}
+
+func TestServerRconStandIn(t *testing.T) {
+	standIn, err := rcontest.NewServer("rcon", nil)
+	assert.Nil(t, err)
+	defer standIn.Close()
+
+	rcon, err := TF2RconWrapper.NewTF2RconConnection(standIn.Addr(), "rcon")
+	assert.Nil(t, err)
+	defer rcon.Close()
+
+	rcon.ChangeServerPassword("12345")
+	assert.Contains(t, standIn.Commands(), "sv_password 12345")
+}
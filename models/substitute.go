@@ -0,0 +1,124 @@
+package models
+
+import (
+	"time"
+
+	db "github.com/TF2Stadium/Helen/database"
+	"github.com/TF2Stadium/Helen/helpers"
+	"github.com/jinzhu/gorm"
+)
+
+// a slot that needs a substitute, after a player left an in progress lobby
+type Substitute struct {
+	ID        uint
+	CreatedAt time.Time
+
+	LobbyId uint
+	Slot    int
+	Team    string // red, blu
+	Class   string // class name, as in GetPlayerSlot
+
+	PlayerId     uint // the player that left
+	Filled       bool
+	SubstituteId uint // the player that took the slot
+}
+
+// RequestSubstitute removes the player from the lobby and opens their slot for substitutes
+func (lobby *Lobby) RequestSubstitute(player *Player, team string, class string) (*Substitute, *helpers.TPError) {
+	sub := &Substitute{
+		LobbyId:  lobby.ID,
+		Team:     team,
+		Class:    class,
+		PlayerId: player.ID,
+	}
+
+	tperr := lobby.transaction(func(tx *gorm.DB) *helpers.TPError {
+		if lobby.State != LobbyStateInProgress {
+			return helpers.NewTPError("Lobby isn't in progress.", -1)
+		}
+
+		slot := &LobbySlot{}
+		err := tx.Where("player_id = ? AND lobby_id = ?", player.ID, lobby.ID).First(slot).Error
+		if err != nil {
+			return helpers.NewTPError("Player is not in the lobby.", 5)
+		}
+		sub.Slot = slot.Slot
+
+		if err := tx.Create(sub).Error; err != nil {
+			return helpers.NewTPError(err.Error(), -1)
+		}
+		if err := tx.Delete(slot).Error; err != nil {
+			return helpers.NewTPError(err.Error(), -1)
+		}
+		return nil
+	})
+	if tperr != nil {
+		return nil, tperr
+	}
+
+	lobby.updateServerAllowedPlayers()
+	lobbyChanged(lobby.ID)
+	db.DB.Exec("UPDATE player_stats SET subbed_out_count = subbed_out_count + 1 WHERE id = ?", player.StatsID)
+
+	return sub, nil
+}
+
+func (lobby *Lobby) IsSubstituteNeeded(slot int) bool {
+	return lobby.isSubstituteNeeded(&db.DB, slot)
+}
+
+func (lobby *Lobby) isSubstituteNeeded(tx *gorm.DB, slot int) bool {
+	count := 0
+	tx.Model(&Substitute{}).Where("lobby_id = ? AND slot = ? AND filled = ?", lobby.ID, slot, false).Count(&count)
+
+	return count != 0
+}
+
+// FillSubstitute adds the player to the slot, they're ready since the lobby is already running
+func (lobby *Lobby) FillSubstitute(player *Player, slot int) *helpers.TPError {
+	if tperr := lobby.canJoin(player); tperr != nil {
+		return tperr
+	}
+
+	// two players could try to take the slot at the same time
+	tperr := lobby.transaction(func(tx *gorm.DB) *helpers.TPError {
+		sub := &Substitute{}
+		err := tx.Where("lobby_id = ? AND slot = ? AND filled = ?", lobby.ID, slot, false).First(sub).Error
+		if err != nil {
+			return helpers.NewTPError("This slot doesn't need a substitute.", 8)
+		}
+
+		if tperr := lobby.addPlayer(tx, player, slot); tperr != nil {
+			return tperr
+		}
+		if tperr := lobby.setPlayerReady(tx, player, true); tperr != nil {
+			return tperr
+		}
+
+		err = tx.Model(sub).UpdateColumns(map[string]interface{}{
+			"filled":        true,
+			"substitute_id": player.ID,
+		}).Error
+		if err != nil {
+			return helpers.NewTPError(err.Error(), -1)
+		}
+		return nil
+	})
+	if tperr != nil {
+		return tperr
+	}
+
+	lobby.updateServerAllowedPlayers()
+	lobbyChanged(lobby.ID)
+	return nil
+}
+
+// substitutes needed in lobbies that are still running
+func GetOpenSubstitutes() ([]Substitute, error) {
+	var subs []Substitute
+	err := db.DB.Joins("INNER JOIN lobbies ON lobbies.id = substitutes.lobby_id").
+		Where("substitutes.filled = ? AND lobbies.state = ?", false, LobbyStateInProgress).
+		Order("substitutes.id").Find(&subs).Error
+
+	return subs, err
+}
@@ -0,0 +1,159 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TF2Stadium/Helen/config"
+	"github.com/TF2Stadium/Helen/helpers"
+)
+
+// how long fetched whitelists are kept
+var WhitelistCacheTime = time.Hour
+
+type whitelistCacheEntry struct {
+	data    string
+	fetched time.Time
+}
+
+var whitelistCache = make(map[Whitelist]whitelistCacheEntry)
+var whitelistCacheMutex sync.Mutex
+
+var whitelistHttpClient = &http.Client{Timeout: 10 * time.Second}
+
+// FetchWhitelist returns the whitelist's text from whitelist.tf, or from
+// config.Constants.WhitelistFixtures (<id>.txt) if it's set
+func FetchWhitelist(id Whitelist) (string, error) {
+	if id <= 0 {
+		return "", errors.New("[Whitelist]: Invalid whitelist id")
+	}
+
+	whitelistCacheMutex.Lock()
+	entry, ok := whitelistCache[id]
+	whitelistCacheMutex.Unlock()
+
+	if ok && time.Since(entry.fetched) < WhitelistCacheTime {
+		return entry.data, nil
+	}
+
+	data, err := fetchWhitelist(id)
+	if err != nil {
+		return "", err
+	}
+
+	whitelistCacheMutex.Lock()
+	whitelistCache[id] = whitelistCacheEntry{data: data, fetched: time.Now()}
+	whitelistCacheMutex.Unlock()
+
+	return data, nil
+}
+
+func fetchWhitelist(id Whitelist) (string, error) {
+	name := strconv.Itoa(int(id)) + ".txt"
+
+	if config.Constants.WhitelistFixtures != "" {
+		data, err := ioutil.ReadFile(filepath.Join(config.Constants.WhitelistFixtures, name))
+		return string(data), err
+	}
+
+	resp, err := whitelistHttpClient.Get(config.Constants.WhitelistUrl + "/" + name)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("[Whitelist]: whitelist %d: %s", id, resp.Status)
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	return string(data), err
+}
+
+// WhitelistData returns the text of the lobby's whitelist, the whitelist.tf one if it
+// can be fetched, else the bundled one for the league and type. "" if there's none
+func WhitelistData(id Whitelist, league League, lobbyType LobbyType) string {
+	if id > 0 {
+		data, err := FetchWhitelist(id)
+		if err == nil {
+			return data
+		}
+
+		helpers.Logger.Warning("[Whitelist]: Couldn't get whitelist %d, using the league's: %s", id, err.Error())
+	}
+
+	// the league's whitelist from the config manifest
+	cache := getConfigCache()
+	format := cache.formatManifest(league, lobbyType)
+	if format == nil || format.Whitelist == "" {
+		return ""
+	}
+
+	return cache.files[format.Whitelist]
+}
+
+// WhitelistLines returns the console commands that write the whitelist to a file on
+// the game server, with con_logfile. Comments and empty lines are left out, lines
+// with a ; can't be echoed and are skipped
+func WhitelistLines(data string) []string {
+	var lines []string
+
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(stripWhitelistComment(line))
+		if line == "" {
+			continue
+		}
+		if strings.Contains(line, ";") {
+			helpers.Logger.Warning("[Whitelist]: Skipping line %q", line)
+			continue
+		}
+
+		lines = append(lines, "echo "+line)
+	}
+
+	return lines
+}
+
+// removes a // comment that isn't in quotes, the console would drop it anyway
+func stripWhitelistComment(line string) string {
+	quoted := false
+	for i := 0; i < len(line); i++ {
+		switch {
+		case line[i] == '"':
+			quoted = !quoted
+		case !quoted && strings.HasPrefix(line[i:], "//"):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// the cvars changed while the whitelist is written, in that order, with their defaults.
+// They're put back after, in reverse. The defaults are used when they can't be read
+var whitelistUploadCvars = []struct {
+	Name, Default string
+}{
+	{"sv_logecho", "1"}, // the match logs are echoed to the console too
+	{"con_timestamp", "0"},
+	{"con_logfile", ""},
+}
+
+var cvarValueRegexp = regexp.MustCompile(`^"[^"]+" = "([^"]*)"`)
+
+// parseCvarValue reads the value out of the console's answer to a cvar's name,
+// like "sv_logecho" = "1" ( def. "1" )
+func parseCvarValue(response string) (string, bool) {
+	match := cvarValueRegexp.FindStringSubmatch(strings.TrimSpace(response))
+	if match == nil {
+		return "", false
+	}
+	return match[1], true
+}
@@ -0,0 +1,171 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/TF2Stadium/Helen/config"
+	"github.com/TF2Stadium/Helen/helpers"
+	"github.com/TF2Stadium/Helen/helpers/rcontest"
+	"github.com/stretchr/testify/assert"
+)
+
+func init() {
+	helpers.InitLogger()
+}
+
+func TestWhitelistFixtures(t *testing.T) {
+	config.SetupConstants()
+	config.Constants.WhitelistFixtures = "testdata/whitelists"
+
+	data, err := FetchWhitelist(4242)
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(data, "TF_WEAPON_ROCKETLAUNCHER"))
+
+	_, err = FetchWhitelist(4243)
+	assert.NotNil(t, err)
+	_, err = FetchWhitelist(0)
+	assert.NotNil(t, err)
+}
+
+func TestWhitelistFetch(t *testing.T) {
+	config.SetupConstants()
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path != "/1337.txt" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, "whitelist\n{\n}\n")
+	}))
+	defer server.Close()
+	config.Constants.WhitelistUrl = server.URL
+
+	data, err := FetchWhitelist(1337)
+	assert.Nil(t, err)
+	assert.Equal(t, "whitelist\n{\n}\n", data)
+
+	// cached
+	FetchWhitelist(1337)
+	assert.Equal(t, 1, requests)
+
+	_, err = FetchWhitelist(1338)
+	assert.NotNil(t, err)
+}
+
+func TestWhitelistData(t *testing.T) {
+	config.SetupConstants()
+	config.Constants.WhitelistFixtures = "testdata/whitelists"
+	InitServerConfigs()
+
+	assert.True(t, strings.Contains(WhitelistData(4242, LeagueUgc, LobbyTypeSixes), "TF_WEAPON_ROCKETLAUNCHER"))
+
+	// falls back to the league's whitelist
+	assert.Equal(t, getConfigCache().files["ugc/item_whitelist_ugc_HL.txt"],
+		WhitelistData(4243, LeagueUgc, LobbyTypeHighlander))
+	assert.Equal(t, getConfigCache().files["etf2l/etf2l_whitelist_6v6.txt"],
+		WhitelistData(0, LeagueEtf2l, LobbyTypeSixes))
+}
+
+func TestWhitelistLines(t *testing.T) {
+	data := "// comment\nwhitelist\n{\n\t\"The // Sword\"\t1 // allowed\n\n\t\"bad;quit\"\t1\n}\n"
+
+	assert.Equal(t, []string{
+		"echo whitelist",
+		"echo {",
+		"echo \"The // Sword\"\t1",
+		"echo }",
+	}, WhitelistLines(data))
+}
+
+func TestServerLoadWhitelist(t *testing.T) {
+	rcon := rcontest.NewFakeRcon()
+	s, restore := newFakeServer(rcon)
+	defer restore()
+	config.Constants.WhitelistFixtures = "testdata/whitelists"
+	s.Whitelist = 4242
+	s.VerifyInfo()
+	rcon.Responses["sv_logecho"] = `"sv_logecho" = "1" ( def. "1" )` + "\n - Echo log information to the console."
+	rcon.Responses["con_logfile"] = `"con_logfile" = "console.log" ( def. "" )`
+
+	assert.Nil(t, s.ExecLobbyConfig())
+
+	commands := rcon.Commands()
+	assert.Equal(t, []string{"exec", "sv_logecho", "con_timestamp", "con_logfile", "sv_logecho 0", "con_timestamp 0"}, commands[:6])
+
+	// the whitelist is written to a file, then loaded after the cvars are put back
+	assert.True(t, strings.HasPrefix(commands[6], `con_logfile "cfg/helen_whitelist_1_`))
+	file := strings.TrimPrefix(commands[6], "con_logfile ")
+	assert.Equal(t, []string{
+		"echo whitelist",
+		"echo {",
+		"echo \"Upgradeable TF_WEAPON_ROCKETLAUNCHER\"\t1",
+		"echo }",
+		`con_logfile "console.log"`,
+		`con_timestamp "0"`,
+		`sv_logecho "1"`,
+		"mp_tournament_whitelist " + file,
+	}, commands[7:])
+
+	// it's only loaded again when the lobby starts
+	assert.Nil(t, s.ExecLobbyConfig())
+	assert.Equal(t, []string{"exec", "mp_tournament_whitelist " + file}, rcon.Commands()[len(commands):])
+}
+
+func TestConfigWhitelist(t *testing.T) {
+	config.SetupConstants()
+	config.Constants.WhitelistFixtures = "testdata/whitelists"
+	InitServerConfigs()
+
+	c := NewServerConfig()
+	c.League = LeagueEtf2l
+	c.Type = LobbyTypeSixes
+	c.Map = "cp_badlands"
+	cfg, err := c.Get()
+
+	// the whitelist is loaded by the server after the config, see Server.LoadWhitelist
+	assert.Nil(t, err)
+	assert.False(t, strings.Contains(cfg, "tftrue_whitelist_id"))
+}
+
+func TestServerLoadWhitelistError(t *testing.T) {
+	rcon := rcontest.NewFakeRcon()
+	s, restore := newFakeServer(rcon)
+	defer restore()
+	config.Constants.WhitelistFixtures = "testdata/whitelists"
+	s.Whitelist = 4242
+	s.VerifyInfo()
+	rcon.Responses["sv_logecho"] = `"sv_logecho" = "0" ( def. "1" )`
+
+	// fails while the whitelist is echoed, the cvars are put back anyway
+	rcon.Errors["Query echo {"] = errors.New("connection reset")
+	assert.NotNil(t, s.LoadWhitelist())
+	assert.Equal(t, "", s.whitelistFile)
+
+	commands := rcon.Commands()
+	assert.Equal(t, []string{
+		"echo whitelist",
+		`con_logfile ""`,
+		`con_timestamp "0"`,
+		`sv_logecho "0"`,
+	}, commands[len(commands)-4:])
+}
+
+func TestParseCvarValue(t *testing.T) {
+	value, ok := parseCvarValue(`"sv_logecho" = "0" ( def. "1" )` + "\n - Echo log information to the console.")
+	assert.True(t, ok)
+	assert.Equal(t, "0", value)
+
+	value, ok = parseCvarValue(`"con_logfile" = "" ( def. "" )`)
+	assert.True(t, ok)
+	assert.Equal(t, "", value)
+
+	_, ok = parseCvarValue("Unknown command \"con_logfile\"")
+	assert.False(t, ok)
+}
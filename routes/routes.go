@@ -13,6 +13,15 @@ func SetupHTTPRoutes(router *mux.Router) {
 	router.HandleFunc("/openidcallback", controllers.LoginCallbackHandler)
 	router.HandleFunc("/startLogin", controllers.LoginHandler)
 	router.HandleFunc("/logout", controllers.LogoutHandler)
+
+	router.HandleFunc("/admin/maps", controllers.AdminMapListHandler).Methods("GET")
+	router.HandleFunc("/admin/maps", controllers.AdminMapAddHandler).Methods("POST")
+	router.HandleFunc("/admin/maps/import", controllers.AdminMapImportHandler).Methods("POST")
+	router.HandleFunc("/admin/maps/{name}", controllers.AdminMapEditHandler).Methods("PUT")
+	router.HandleFunc("/admin/maps/{name}/retire", controllers.AdminMapRetireHandler).Methods("POST")
+	router.HandleFunc("/admin/maps/{name}/restore", controllers.AdminMapRestoreHandler).Methods("POST")
+	router.HandleFunc("/admin/configs/reload", controllers.AdminConfigsReloadHandler).Methods("POST")
+
 	router.HandleFunc("/{param}", controllers.ExampleHandler)
 
 }
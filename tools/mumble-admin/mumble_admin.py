@@ -0,0 +1,237 @@
+#!/usr/bin/env python3
+"""The mumble admin api Helen talks to, see helpers/mumble and README.md.
+
+A small HTTP service that runs next to murmur and manages its channels and
+registered users through murmur's ICE interface. It needs ZeroC Ice for python
+(pip install zeroc-ice) and murmur's Murmur.ice, murmur has to be started with
+ice enabled (the ice= setting in murmur.ini).
+
+Configured with environment variables:
+
+    MUMBLE_ADMIN_LISTEN  address to listen on, 127.0.0.1:8090 by default
+    MUMBLE_ADMIN_KEY     key Helen has to send, Helen's MUMBLE_ADMIN_KEY. Required
+    MURMUR_ICE_HOST      murmur's ice host, 127.0.0.1 by default
+    MURMUR_ICE_PORT      murmur's ice port, 6502 by default
+    MURMUR_ICE_SECRET    murmur's icesecretwrite, empty if it isn't set
+    MURMUR_SERVER_ID     the virtual server, 1 by default
+    MURMUR_SLICE         path to Murmur.ice, /usr/share/slice/Murmur.ice by default
+"""
+
+import hmac
+import json
+import os
+import re
+import sys
+import threading
+from http.server import BaseHTTPRequestHandler, ThreadingHTTPServer
+from urllib.parse import unquote_plus
+
+ROOT_CHANNEL = 0
+
+
+class NotFound(Exception):
+    pass
+
+
+class BadRequest(Exception):
+    pass
+
+
+class Murmur:
+    """The murmur virtual server, calls are serialized"""
+
+    def __init__(self, host, port, secret, server_id, slice_path):
+        import Ice
+
+        slice_dir = Ice.getSliceDir()
+        args = ["-I" + slice_dir] if slice_dir else []
+        Ice.loadSlice("", args + [slice_path])
+        import Murmur as murmur
+
+        self.murmur = murmur
+
+        properties = Ice.createProperties()
+        properties.setProperty("Ice.ImplicitContext", "Shared")
+        properties.setProperty("Ice.Default.EncodingVersion", "1.0")
+        data = Ice.InitializationData()
+        data.properties = properties
+
+        self.communicator = Ice.initialize(data)
+        if secret:
+            self.communicator.getImplicitContext().put("secret", secret)
+
+        proxy = self.communicator.stringToProxy("Meta:tcp -h %s -p %d -t 10000" % (host, port))
+        meta = murmur.MetaPrx.checkedCast(proxy)
+        if meta is None:
+            raise RuntimeError("murmur's ice interface isn't at %s:%d" % (host, port))
+
+        self.server = meta.getServer(server_id)
+        if self.server is None:
+            raise RuntimeError("murmur doesn't have a virtual server %d" % server_id)
+
+        self.lock = threading.Lock()
+
+    def add_channel(self, name, parent):
+        with self.lock:
+            try:
+                return self.server.addChannel(name, parent)
+            except self.murmur.InvalidChannelException:
+                raise NotFound()
+
+    def remove_channel(self, id):
+        if id == ROOT_CHANNEL:
+            raise NotFound()
+
+        # murmur moves the users in it to the parent channel
+        with self.lock:
+            try:
+                self.server.removeChannel(id)
+            except self.murmur.InvalidChannelException:
+                raise NotFound()
+
+    def _registered_id(self, name):
+        # the filter matches parts of names, mumble names aren't case sensitive
+        for id, registered in self.server.getRegisteredUsers(name).items():
+            if registered.lower() == name.lower():
+                return id
+        return None
+
+    def register_user(self, name, password):
+        info = {
+            self.murmur.UserInfo.UserName: name,
+            self.murmur.UserInfo.UserPassword: password,
+        }
+
+        with self.lock:
+            id = self._registered_id(name)
+            if id is None:
+                self.server.registerUser(info)
+            else:
+                self.server.updateRegistration(id, info)
+
+    def unregister_user(self, name):
+        with self.lock:
+            id = self._registered_id(name)
+            if id is None:
+                return
+
+            for user in self.server.getUsers().values():
+                if user.userid == id:
+                    self.server.kickUser(user.session, "Your login was removed")
+            self.server.unregisterUser(id)
+
+    def channel_users(self, id):
+        with self.lock:
+            channels = self.server.getChannels()
+            users = self.server.getUsers().values()
+
+        if id not in channels:
+            raise NotFound()
+
+        def in_channel(channel):
+            while True:
+                if channel == id:
+                    return True
+                if channel == ROOT_CHANNEL or channel not in channels:
+                    return False
+                channel = channels[channel].parent
+
+        return [{"name": user.name, "channel": user.channel} for user in users if in_channel(user.channel)]
+
+
+def make_handler(murmur, key):
+    routes = [
+        ("POST", re.compile(r"^/channels$"), "add_channel"),
+        ("DELETE", re.compile(r"^/channels/(\d+)$"), "remove_channel"),
+        ("GET", re.compile(r"^/channels/(\d+)/users$"), "channel_users"),
+        ("PUT", re.compile(r"^/users/([^/]+)$"), "register_user"),
+        ("DELETE", re.compile(r"^/users/([^/]+)$"), "unregister_user"),
+    ]
+
+    class Handler(BaseHTTPRequestHandler):
+        def body(self):
+            length = int(self.headers.get("Content-Length") or 0)
+            try:
+                body = json.loads(self.rfile.read(length) or b"null")
+            except ValueError:
+                raise BadRequest()
+            if not isinstance(body, dict):
+                raise BadRequest()
+            return body
+
+        def send(self, status, out=None):
+            data = json.dumps(out).encode() if out is not None else b""
+            self.send_response(status)
+            self.send_header("Content-Type", "application/json")
+            self.send_header("Content-Length", str(len(data)))
+            self.end_headers()
+            self.wfile.write(data)
+
+        def add_channel(self):
+            body = self.body()
+            name, parent = body.get("name"), body.get("parent", ROOT_CHANNEL)
+            if not isinstance(name, str) or not name or not isinstance(parent, int):
+                raise BadRequest()
+            return {"id": murmur.add_channel(name, parent)}
+
+        def remove_channel(self, id):
+            murmur.remove_channel(int(id))
+
+        def channel_users(self, id):
+            return murmur.channel_users(int(id))
+
+        def register_user(self, name):
+            password = self.body().get("password")
+            if not isinstance(password, str):
+                raise BadRequest()
+            murmur.register_user(unquote_plus(name), password)
+
+        def unregister_user(self, name):
+            murmur.unregister_user(unquote_plus(name))
+
+        def route(self):
+            authorization = self.headers.get("Authorization", "")
+            if not hmac.compare_digest(authorization.encode(), ("Bearer " + key).encode()):
+                return self.send(401)
+
+            for method, path, action in routes:
+                match = path.match(self.path)
+                if method == self.command and match:
+                    break
+            else:
+                return self.send(404)
+
+            try:
+                self.send(200, getattr(self, action)(*match.groups()))
+            except BadRequest:
+                self.send(400)
+            except NotFound:
+                self.send(404)
+            except Exception as e:
+                self.log_error("%s %s: %r", self.command, self.path, e)
+                self.send(500)
+
+        do_GET = do_POST = do_PUT = do_DELETE = route
+
+    return Handler
+
+
+def main():
+    key = os.environ.get("MUMBLE_ADMIN_KEY", "")
+    if not key:
+        sys.exit("MUMBLE_ADMIN_KEY has to be set")
+
+    murmur = Murmur(
+        os.environ.get("MURMUR_ICE_HOST", "127.0.0.1"),
+        int(os.environ.get("MURMUR_ICE_PORT", "6502")),
+        os.environ.get("MURMUR_ICE_SECRET", ""),
+        int(os.environ.get("MURMUR_SERVER_ID", "1")),
+        os.environ.get("MURMUR_SLICE", "/usr/share/slice/Murmur.ice"),
+    )
+
+    host, _, port = os.environ.get("MUMBLE_ADMIN_LISTEN", "127.0.0.1:8090").rpartition(":")
+    ThreadingHTTPServer((host, int(port)), make_handler(murmur, key)).serve_forever()
+
+
+if __name__ == "__main__":
+    main()